@@ -5,20 +5,20 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/go-bolo/bolo"
-	"github.com/go-bolo/bolo/helpers"
 	files_helpers "github.com/go-bolo/files/helpers"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type FileListJSONResponse struct {
-	bolo.BaseListReponse
+	Meta    QueryListMeta `json:"meta"`
 	Records *[]*FileModel `json:"file"`
 }
 
@@ -30,12 +30,26 @@ type FileFindOneJSONResponse struct {
 	Record *FileModel `json:"file"`
 }
 
+// FileReplaceJSONResponse - File with the replaced contents and the revision with the previous contents
+type FileReplaceJSONResponse struct {
+	Record   *FileModel     `json:"file"`
+	Revision *RevisionModel `json:"revision"`
+}
+
+// RevisionListJSONResponse - Revisions of one file or image, newest first
+type RevisionListJSONResponse struct {
+	Records []*RevisionModel `json:"revisions"`
+}
+
 type FileBodyRequest struct {
 	Record *FileModel `json:"file"`
 }
 
 func NewFileController(cfgs *FileControllerConfiguration) *FileController {
-	return &FileController{App: cfgs.App}
+	return &FileController{
+		App:                cfgs.App,
+		UseExternalFileURL: cfgs.App.GetConfiguration().GetBoolF("FILE_USE_EXTERNAL_URL", true),
+	}
 }
 
 type FileControllerConfiguration struct {
@@ -44,11 +58,15 @@ type FileControllerConfiguration struct {
 
 type FileController struct {
 	App bolo.App
+	// Redirect to the storage url in FindOne, if false the file is served through the storage
+	UseExternalFileURL bool
 }
 
 type FileQueryOpts struct {
 	Records *[]*FileModel
 	Count   *int64
+	// Optional, set with the cursors of the pages around the loaded page
+	Cursors *QueryCursors
 	Limit   int
 	Offset  int
 	C       echo.Context
@@ -65,10 +83,12 @@ func (ctl *FileController) Query(c echo.Context) error {
 	}
 
 	var count int64
+	cursors := QueryCursors{}
 	records := make([]*FileModel, 0)
 	err = FileQueryAndCountReq(&FileQueryOpts{
 		Records: &records,
 		Count:   &count,
+		Cursors: &cursors,
 		Limit:   ctx.GetLimit(),
 		Offset:  ctx.GetOffset(),
 		C:       c,
@@ -77,6 +97,8 @@ func (ctl *FileController) Query(c echo.Context) error {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
 		}).Debug("FileController.Query Error on find records")
+
+		return err
 	}
 
 	ctx.Pager.Count = count
@@ -90,19 +112,110 @@ func (ctl *FileController) Query(c echo.Context) error {
 		records[i].LoadData()
 	}
 
+	err = LoadFilesTags(records)
+	if err != nil {
+		return errors.Wrap(err, "FileController.Query error on load tags")
+	}
+
 	resp := FileListJSONResponse{
 		Records: &records,
 	}
 
 	resp.Meta.Count = count
+	resp.Meta.QueryCursors = cursors
+
+	resp.Meta.Facets, err = FileFacetsReq(&FileQueryOpts{C: c})
+	if err != nil {
+		return errors.Wrap(err, "FileController.Query error on count facets")
+	}
 
 	return c.JSON(200, &resp)
 }
 
+// Create - Upload one file with multipart form data or with one data uri in JSON body
 func (ctl *FileController) Create(c echo.Context) error {
+	if isJSONRequest(c) {
+		return ctl.CreateFromDataURI(c)
+	}
+
 	return ctl.UploadFile(c)
 }
 
+// CreateFromDataURI - Upload one file sent as {"file": {"data": "data:<mime>;base64,<data>"}}
+func (ctl *FileController) CreateFromDataURI(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("create_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := struct {
+		File *DataURIUploadItem `json:"file"`
+	}{}
+
+	err := bindDataURIBody(c, filePlugin.MaxDataURISize, &body)
+	if err != nil {
+		return err
+	}
+
+	item := body.File
+	if item == nil || item.Data == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "file.data is required")
+	}
+
+	expiresAt, err := parseExpiresAt(item.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+	defer os.Remove(tmpFilePath)
+
+	mimeType, err := decodeDataURIToFile(item.Data, filePlugin.MaxDataURISize, tmpFilePath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Debug("FileController.CreateFromDataURI error on decode data uri")
+
+		return dataURIHTTPError(err)
+	}
+
+	// release the base64 data before processing
+	item.Data = ""
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	newFile := NewFileModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadFileFromLocalhost(dataURIFileName(item.Name, mimeType), item.Description, tmpFilePath, filePlugin.GetTenantFileStorageName(newFile.TenantID), newFile, ctl.App)
+	if err != nil {
+		return err
+	}
+
+	newFile.Label = getOptionalString(item.Label)
+
+	err = newFile.Save()
+	if err != nil {
+		return err
+	}
+
+	triggerFileAfterUpload(ctx, newFile)
+
+	return c.JSON(http.StatusOK, &FileFindOneJSONResponse{Record: newFile})
+}
+
 func (ctl *FileController) Update(c echo.Context) error {
 	var err error
 
@@ -120,7 +233,7 @@ func (ctl *FileController) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 	record := FileModel{}
-	err = FileFindOne(id, &record)
+	err = requestFileFindOne(RequestContext, id, &record)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"id":    id,
@@ -131,6 +244,22 @@ func (ctl *FileController) Update(c echo.Context) error {
 
 	record.LoadData()
 
+	err = checkRecordAccess(c, AccessActionUpdate, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	// size and owner are used in storage quotas, they only change with uploads or ownership transfers
+	size, creatorID := record.Size, record.CreatorID
+	// folder changes use the folder move endpoint, that checks the target folder
+	folderID := record.FolderID
+	// the expiration is only set and validated in uploads, expired records are purged
+	expiresAt := record.ExpiresAt
+	// records are moved to trash and restored with the delete and restore endpoints, that check the access
+	deletedAt := record.DeletedAt
+	// cleared so the body is bound in new pointers and doesn't change the kept values
+	record.Size, record.CreatorID, record.FolderID, record.ExpiresAt = nil, nil, nil, nil
+
 	body := FileFindOneJSONResponse{Record: &record}
 
 	if err := c.Bind(&body); err != nil {
@@ -145,6 +274,9 @@ func (ctl *FileController) Update(c echo.Context) error {
 		return c.NoContent(http.StatusNotFound)
 	}
 
+	record.Size, record.CreatorID, record.FolderID = size, creatorID, folderID
+	record.ExpiresAt, record.DeletedAt = expiresAt, deletedAt
+
 	err = record.Save()
 	if err != nil {
 		return err
@@ -202,7 +334,7 @@ func (ctl *FileController) FindOne(c echo.Context) error {
 	}).Debug("FileController.FindOne id from params")
 
 	record := FileModel{}
-	err := FileFindOne(id, &record)
+	err := requestFileFindOne(ctx, id, &record)
 	if err != nil {
 		return err
 	}
@@ -217,7 +349,182 @@ func (ctl *FileController) FindOne(c echo.Context) error {
 
 	record.LoadData()
 
-	return c.Redirect(http.StatusFound, record.GetUrl(style))
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	if ctl.UseExternalFileURL {
+		return c.Redirect(http.StatusFound, record.GetUrl(style))
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	return filePlugin.GetFileStorage(&record).SendFileThroughHTTP(c, &record, style, "")
+}
+
+// Download - Send the file as attachment with the original file name
+func (ctl *FileController) Download(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": id,
+	}).Debug("FileController.Download id from params")
+
+	record := FileModel{}
+	err := requestFileFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	return sendDownload(c, &downloadOptions{
+		Storage:      filePlugin.GetFileStorage(&record),
+		File:         &record,
+		Style:        "original",
+		FileName:     record.Originalname,
+		UseSignedURL: ctl.UseExternalFileURL,
+		Expires:      filePlugin.SignedURLExpiration,
+	})
+}
+
+// DownloadZip - Stream one zip with the files from ?ids=1,2,3 or with the files associated to one
+// record with ?modelName=&modelId=&field=, field is optional
+func (ctl *FileController) DownloadZip(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	ids := splitList(c.QueryParam("ids"))
+	modelName := c.QueryParam("modelName")
+	modelID := c.QueryParam("modelId")
+	field := c.QueryParam("field")
+
+	logrus.WithFields(logrus.Fields{
+		"ids":       ids,
+		"modelName": modelName,
+		"modelId":   modelID,
+		"field":     field,
+	}).Debug("FileController.DownloadZip params")
+
+	records := []FileModel{}
+
+	switch {
+	case len(ids) > 0:
+		if len(ids) > filePlugin.MaxZipFiles {
+			return echo.NewHTTPError(http.StatusBadRequest, "too many files, the limit is "+strconv.Itoa(filePlugin.MaxZipFiles))
+		}
+
+		tenantScope, err := getTenantScope(ctx)
+		if err != nil {
+			return err
+		}
+
+		found := []FileModel{}
+		err = FileFindManyByIds(ids, &found, tenantScope)
+		if err != nil {
+			return err
+		}
+
+		// keep the request order
+		for _, id := range ids {
+			for i := range found {
+				if found[i].GetIDString() != id {
+					continue
+				}
+
+				records = append(records, found[i])
+				break
+			}
+		}
+	case modelName != "" && modelID != "":
+		// only users that can see the record can download its files
+		if !ctx.Can("find_" + modelName) {
+			return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+		}
+
+		tenantScope, err := getTenantScope(ctx)
+		if err != nil {
+			return err
+		}
+
+		if field != "" {
+			err = FileFindManyInRecord(modelName, field, modelID, &records, tenantScope)
+		} else {
+			records, err = GetFilesInRecord(modelName, modelID, tenantScope)
+		}
+		if err != nil {
+			return err
+		}
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "ids or modelName and modelId are required")
+	}
+
+	// files that the user can not find are skipped like missing ones
+	allowedRecords := []FileModel{}
+	for i := range records {
+		allowed, err := canAccessRecord(ctx, AccessActionFind, records[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+		if allowed {
+			allowedRecords = append(allowedRecords, records[i])
+		}
+	}
+	records = allowedRecords
+
+	if len(records) == 0 {
+		return echo.NotFoundHandler(c)
+	}
+
+	if len(records) > filePlugin.MaxZipFiles {
+		return echo.NewHTTPError(http.StatusBadRequest, "too many files, the limit is "+strconv.Itoa(filePlugin.MaxZipFiles))
+	}
+
+	zipName := files_helpers.SanitizeFileName(c.QueryParam("name"))
+	if zipName == "" {
+		zipName = "files.zip"
+	}
+	if !strings.HasSuffix(strings.ToLower(zipName), ".zip") {
+		zipName += ".zip"
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "application/zip")
+	res.Header().Set(echo.HeaderContentDisposition, files_helpers.ContentDisposition("attachment", zipName))
+	res.WriteHeader(http.StatusOK)
+
+	err := writeFilesZip(c.Request().Context(), ctl.App, res, records)
+	if err != nil {
+		// the response is already sent
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("FileController.DownloadZip error on write zip")
+	}
+
+	return nil
 }
 
 func (ctl *FileController) FindOneData(c echo.Context) error {
@@ -228,13 +535,13 @@ func (ctl *FileController) FindOneData(c echo.Context) error {
 		"id": id,
 	}).Debug("FileController.FindOne id from params")
 
-	can := ctx.Can("find_image")
+	can := ctx.Can("find_file")
 	if !can {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
 	record := FileModel{}
-	err := FileFindOne(id, &record)
+	err := requestFileFindOne(ctx, id, &record)
 	if err != nil {
 		return err
 	}
@@ -249,6 +556,11 @@ func (ctl *FileController) FindOneData(c echo.Context) error {
 
 	record.LoadData()
 
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
 	resp := FileFindOneJSONResponse{
 		Record: &record,
 	}
@@ -265,6 +577,10 @@ func (ctl *FileController) UploadFile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
+	if isMultipleUpload(c, "files") {
+		return ctl.UploadFiles(c)
+	}
+
 	// file upload settings:
 	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
 
@@ -278,6 +594,11 @@ func (ctl *FileController) UploadFile(c echo.Context) error {
 		return err
 	}
 
+	expiresAt, err := parseExpiresAt(c.FormValue("expiresAt"))
+	if err != nil {
+		return err
+	}
+
 	err = files_helpers.CopyRequestFileToTMP(ctx, "file", tmpFilePath)
 	if err != nil {
 		return err
@@ -285,8 +606,20 @@ func (ctl *FileController) UploadFile(c echo.Context) error {
 
 	defer os.Remove(tmpFilePath)
 
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
 	newFile := NewFileModel()
-	err = UploadFileFromLocalhost(file.Filename, c.FormValue("description"), tmpFilePath, filePlugin.FileStorageName, newFile, ctl.App)
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadFileFromLocalhost(file.Filename, c.FormValue("description"), tmpFilePath, filePlugin.GetTenantFileStorageName(newFile.TenantID), newFile, ctl.App)
 	if err != nil {
 		return err
 	}
@@ -296,119 +629,611 @@ func (ctl *FileController) UploadFile(c echo.Context) error {
 		return err
 	}
 
+	triggerFileAfterUpload(ctx, newFile)
+
 	return c.JSON(http.StatusOK, &FileFindOneJSONResponse{Record: newFile})
 }
 
-func (ctl *FileController) Delete(c echo.Context) error {
-	app := ctl.App
-
-	id := c.Param("id")
+// Import - Download one file from the url in body and save it, the source url is saved in the extra data
+func (ctl *FileController) Import(c echo.Context) error {
 	ctx := c.(*bolo.RequestContext)
 
-	can := ctx.Can("delete_file")
+	can := ctx.Can("create_file")
 	if !can {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
-	record := FileModel{}
-	err := FileFindOne(id, &record)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := RemoteImportRequest{}
+	err := c.Bind(&body)
+	if err != nil || body.URL == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "url is required")
+	}
+
+	expiresAt, err := parseExpiresAt(body.ExpiresAt)
 	if err != nil {
 		return err
 	}
 
-	err, _ = app.GetEvents().Trigger("file-delete", map[string]any{
-		"echoContext": c,
-		"record":      &record,
-	})
+	logrus.WithFields(logrus.Fields{
+		"url": body.URL,
+	}).Debug("FileController.Import importing remote file")
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+	defer os.Remove(tmpFilePath)
 
+	remoteFile, err := DownloadRemoteFile(c.Request().Context(), &filePlugin.RemoteImport, body.URL, tmpFilePath)
 	if err != nil {
-		return &bolo.HTTPError{
-			Code:     http.StatusInternalServerError,
-			Message:  "error on delete image event",
-			Internal: err,
-		}
+		logrus.WithFields(logrus.Fields{
+			"url":   body.URL,
+			"error": err,
+		}).Debug("FileController.Import error on download remote file")
+
+		return remoteImportHTTPError(err)
 	}
 
-	err = record.Delete()
+	err = checkUploadQuota(ctx, tmpFilePath)
 	if err != nil {
 		return err
 	}
 
-	return c.NoContent(http.StatusNoContent)
-}
-
-func FileQueryAndCountReq(opts *FileQueryOpts) error {
-	db := bolo.GetDefaultDatabaseConnection()
-	c := opts.C
-	q := c.QueryParam("q")
-	query := db
-	ctx := c.(*bolo.RequestContext)
-
-	queryI, err := ctx.Query.SetDatabaseQueryForModel(query, &FileModel{})
+	newFile := NewFileModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": fmt.Sprintf("%+v\n", err),
-		}).Error("FileQueryAndCountReq error")
+		return err
 	}
-	query = queryI.(*gorm.DB)
 
-	if q != "" {
-		query = query.Where(
-			db.Where("name LIKE ?", "%"+q+"%").
-				Or(db.Where("label LIKE ?", "%"+q+"%")).
-				Or(db.Where("description LIKE ?", "%"+q+"%")),
-		)
+	err = UploadFileFromLocalhost(remoteFile.FileName, body.Description, tmpFilePath, filePlugin.GetTenantFileStorageName(newFile.TenantID), newFile, ctl.App)
+	if err != nil {
+		return err
 	}
 
-	orderColumn, orderIsDesc, orderValid := helpers.ParseUrlQueryOrder(c.QueryParam("order"), c.QueryParam("sort"), c.QueryParam("sortDirection"))
+	newFile.Label = getOptionalString(body.Label)
 
-	if orderValid {
-		query = query.Order(clause.OrderByColumn{
-			Column: clause.Column{Table: clause.CurrentTable, Name: orderColumn},
-			Desc:   orderIsDesc,
-		})
-	} else {
-		query = query.
-			Order("createdAt DESC").
-			Order("id DESC")
+	err = newFile.SetExtraDataKey("sourceURL", body.URL)
+	if err != nil {
+		return err
 	}
 
-	query = query.Limit(opts.Limit).
-		Offset(opts.Offset)
-
-	r := query.Find(opts.Records)
-	if r.Error != nil {
-		return r.Error
+	err = newFile.Save()
+	if err != nil {
+		return err
 	}
 
-	return FileCountReq(opts)
+	newFile.LoadData()
+
+	triggerFileAfterUpload(ctx, newFile)
+
+	return c.JSON(http.StatusOK, &FileFindOneJSONResponse{Record: newFile})
 }
 
-func FileCountReq(opts *FileQueryOpts) error {
-	db := bolo.GetDefaultDatabaseConnection()
-	c := opts.C
-	q := c.QueryParam("q")
+// UploadFiles - Upload many files sent in the files[] multipart field, with optional labels[] and
+// descriptions[] in same order. Returns one result for each file and associate the uploaded files
+// in one model field if modelName, modelId and field are set
+func (ctl *FileController) UploadFiles(c echo.Context) error {
 	ctx := c.(*bolo.RequestContext)
-	// Count ...
-	queryCount := db
 
-	if q != "" {
-		queryCount = queryCount.Or(
-			db.Where("label LIKE ?", "%"+q+"%"),
-			db.Where("name LIKE ?", "%"+q+"%"),
-			db.Where("description LIKE ?", "%"+q+"%"),
-		)
+	can := ctx.Can("create_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
-	queryICount, err := ctx.Query.SetDatabaseQueryForModel(queryCount, &FileModel{})
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	items, err := getMultipleUploadItems(c, "files", filePlugin.MaxUploadFiles)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": fmt.Sprintf("%+v\n", err),
-		}).Error("FileCountReq count error")
+		return err
 	}
-	queryCount = queryICount.(*gorm.DB)
 
-	return queryCount.
-		Table("files").
-		Count(opts.Count).Error
+	association, err := getMultipleUploadAssociation(ctx)
+	if err != nil {
+		return err
+	}
+
+	expiresAt, err := parseExpiresAt(c.FormValue("expiresAt"))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"count": len(items),
+	}).Debug("FileController.UploadFiles uploading files")
+
+	err = checkMultipleUploadQuota(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	results := runMultipleUpload(c, filePlugin.UploadConcurrency, items, func(item *multipleUploadItem, tmpFilePath string) (uploadedRecord, *UploadItemError) {
+		newFile := NewFileModel()
+
+		newFile.CreatorID = getCreatorID(ctx)
+		newFile.ExpiresAt = expiresAt
+
+		var err error
+		newFile.TenantID, err = getTenantID(ctx)
+		if err != nil {
+			return nil, &UploadItemError{Code: "upload_failed", Message: err.Error()}
+		}
+
+		err = UploadFileFromLocalhost(item.file.Filename, item.description, tmpFilePath, filePlugin.GetTenantFileStorageName(newFile.TenantID), newFile, ctl.App)
+		if err != nil {
+			return nil, &UploadItemError{Code: "upload_failed", Message: err.Error()}
+		}
+
+		newFile.Label = getOptionalString(item.label)
+
+		err = newFile.Save()
+		if err != nil {
+			return nil, &UploadItemError{Code: "save_failed", Message: err.Error()}
+		}
+
+		triggerFileAfterUpload(ctx, newFile)
+
+		return newFile, nil
+	})
+
+	resp := MultipleUploadJSONResponse{Results: results}
+
+	if association != nil {
+		cfg := NewFileFieldConfiguration(association.ModelName, association.Field)
+
+		err = AddFilesInFieldByIDs(association.ModelID, getUploadedIDs(results), cfg)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"modelName": association.ModelName,
+				"modelId":   association.ModelID,
+				"field":     association.Field,
+				"error":     err,
+			}).Error("FileController.UploadFiles error on associate files")
+
+			resp.AssociationError = &UploadItemError{Code: "association_failed", Message: err.Error()}
+		}
+	}
+
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// Delete - Move one file to trash or delete it permanently with the ?permanent=true query param
+func (ctl *FileController) Delete(c echo.Context) error {
+	app := ctl.App
+
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+	permanent := c.QueryParam("permanent") == "true"
+
+	can := ctx.Can("delete_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record := FileModel{}
+	err := requestFileFindOne(ctx, id, &record)
+	if err != nil && permanent && errors.Is(err, gorm.ErrRecordNotFound) {
+		// trashed records can only be deleted permanently
+		err = requestTrashedFileFindOne(ctx, id, &record)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionDelete, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	err, _ = app.GetEvents().Trigger("file-delete", map[string]any{
+		"echoContext": c,
+		"record":      &record,
+	})
+
+	if err != nil {
+		return &bolo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  "error on delete file event",
+			Internal: err,
+		}
+	}
+
+	if !permanent {
+		err = trashFileRecord(ctx, &record)
+		if err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	err = destroyFileRecord(app, ctx, &record)
+	if err != nil {
+		var destroyErr *DestroyError
+		if errors.As(err, &destroyErr) {
+			return &bolo.HTTPError{
+				Code: http.StatusInternalServerError,
+				Message: map[string]any{
+					"message":  "error on delete stored file, try again",
+					"failures": destroyErr.GetFailureMessages(),
+				},
+				Internal: err,
+			}
+		}
+
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ctl *FileController) QueryTrash(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	db := ctl.App.GetDB()
+
+	var count int64
+	records := make([]*FileModel, 0)
+
+	query, err := scopeQueryByTenant(ctx, db.Unscoped().Where("deletedAt IS NOT NULL").Scopes(NotExpiredScope("files")))
+	if err != nil {
+		return err
+	}
+
+	query, err = scopeQueryByAccessPolicy(ctx, AccessRecordTypeFile, query)
+	if err != nil {
+		return err
+	}
+
+	err = query.
+		Order("deletedAt DESC").
+		Order("id DESC").
+		Limit(ctx.GetLimit()).
+		Offset(ctx.GetOffset()).
+		Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	err = query.Model(&FileModel{}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	for i := range records {
+		records[i].LoadData()
+	}
+
+	resp := FileListJSONResponse{
+		Records: &records,
+	}
+
+	resp.Meta.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+func (ctl *FileController) Restore(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record := FileModel{}
+	err := requestTrashedFileFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionDelete, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	err = record.Restore()
+	if err != nil {
+		return err
+	}
+
+	record.LoadData()
+
+	return c.JSON(http.StatusOK, &FileFindOneJSONResponse{Record: &record})
+}
+
+// findRequestFile - Find the :id file and check the request access to run the action in it
+func findRequestFile(c echo.Context, action AccessAction) (*FileModel, error) {
+	ctx := c.(*bolo.RequestContext)
+
+	record := FileModel{}
+	err := requestFileFindOne(ctx, c.Param("id"), &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NotFoundHandler(c)
+		}
+		return nil, err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, action, record.GetAccessRecord())
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Replace - Replace the file contents with the uploaded "file", the file id, name and urls don't change and the
+// previous contents are kept as one revision
+func (ctl *FileController) Replace(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFile(c, AccessActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "file is required")
+	}
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+
+	err = files_helpers.CopyRequestFileToTMP(ctx, "file", tmpFilePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilePath)
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	revision, err := ReplaceFileContents(ctx, record, file.Filename, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &FileReplaceJSONResponse{Record: record, Revision: revision})
+}
+
+// QueryRevisions - List the previous contents of one file
+func (ctl *FileController) QueryRevisions(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFile(c, AccessActionFind)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := GetRecordRevisions(ctl.App.GetDB(), AccessRecordTypeFile, record.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &RevisionListJSONResponse{Records: revisions})
+}
+
+// DownloadRevision - Send the :number revision as attachment with the name it was uploaded with
+func (ctl *FileController) DownloadRevision(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFile(c, AccessActionFind)
+	if err != nil {
+		return err
+	}
+
+	revision, err := GetRecordRevision(ctl.App.GetDB(), AccessRecordTypeFile, record.ID, c.Param("number"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	return sendDownload(c, &downloadOptions{
+		Storage:      getRevisionStorage(filePlugin, revision, filePlugin.GetFileStorage(record)),
+		File:         record,
+		Style:        revision.GetStyle(),
+		FileName:     revision.Originalname,
+		UseSignedURL: ctl.UseExternalFileURL,
+		Expires:      filePlugin.SignedURLExpiration,
+	})
+}
+
+// RestoreRevision - Replace the file contents with the :number revision, the current contents are kept as
+// one new revision
+func (ctl *FileController) RestoreRevision(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_file")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFile(c, AccessActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	revision, err := GetRecordRevision(ctl.App.GetDB(), AccessRecordTypeFile, record.ID, c.Param("number"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	err = quotaHTTPError(CheckUploadQuota(ctx, revision.Size))
+	if err != nil {
+		return err
+	}
+
+	previous, err := RestoreFileRevision(ctx, record, revision)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &FileReplaceJSONResponse{Record: record, Revision: previous})
+}
+
+func FileQueryAndCountReq(opts *FileQueryOpts) error {
+	ctx := opts.C.(*bolo.RequestContext)
+
+	page, err := getQueryPage(ctx, &FileModel{}, opts.Limit, opts.Offset)
+	if err != nil {
+		return err
+	}
+
+	// search results are ordered by relevance in lists without order and cursor
+	query, err := fileFilterQuery(ctx, page.Rank)
+	if err != nil {
+		return err
+	}
+
+	query, err = page.Apply(query)
+	if err != nil {
+		return err
+	}
+
+	r := query.Find(opts.Records)
+	if r.Error != nil {
+		return r.Error
+	}
+
+	err = FileCountReq(opts)
+	if err != nil {
+		return err
+	}
+
+	cursors := finishQueryPage(page, opts.Records, *opts.Count)
+	if opts.Cursors != nil {
+		*opts.Cursors = *cursors
+	}
+
+	return nil
+}
+
+func FileCountReq(opts *FileQueryOpts) error {
+	queryCount, err := fileCountQuery(opts)
+	if err != nil {
+		return err
+	}
+
+	return queryCount.Count(opts.Count).Error
+}
+
+// FileFacetsReq - Count the files with the request filters by the facets requested with ?facets=
+func FileFacetsReq(opts *FileQueryOpts) (map[string][]*FacetValue, error) {
+	ctx := opts.C.(*bolo.RequestContext)
+
+	facets := getRequestedFacets(ctx, AccessRecordTypeFile)
+	if len(facets) == 0 {
+		return nil, nil
+	}
+
+	query, err := fileCountQuery(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return getFacets(query, &FileModel{}, AccessRecordTypeFile, facets)
+}
+
+// fileCountQuery - Build the files count query with the request filters, without pagination
+func fileCountQuery(opts *FileQueryOpts) (*gorm.DB, error) {
+	queryCount, err := fileFilterQuery(opts.C.(*bolo.RequestContext), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query parser sets one limit with filter params, counts are not paginated
+	return queryCount.
+		Model(&FileModel{}).
+		Limit(-1).
+		Offset(-1), nil
+}
+
+// fileFilterQuery - Build the files query with the request filters and search, used in lists and counts so
+// counts match the results
+func fileFilterQuery(ctx *bolo.RequestContext, rank bool) (*gorm.DB, error) {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	queryI, err := ctx.Query.SetDatabaseQueryForModel(db, &FileModel{})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": fmt.Sprintf("%+v\n", err),
+		}).Error("fileFilterQuery error")
+	}
+	query := queryI.(*gorm.DB)
+
+	query, err = scopeQueryByTenant(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = scopeQueryByAccessPolicy(ctx, AccessRecordTypeFile, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = applyOwnerSelector(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = applyFolderSelector(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = scopeQueryByFolderVisibility(ctx, query)
+
+	query, err = applyTagSelector(ctx, AccessRecordTypeFile, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = query.Scopes(NotExpiredScope("files"))
+
+	return applySearch(ctx, AccessRecordTypeFile, "files", query, rank), nil
 }
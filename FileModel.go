@@ -7,10 +7,10 @@ import (
 	"time"
 
 	"github.com/go-bolo/bolo"
-	"github.com/go-bolo/bolo/database"
 	"github.com/go-bolo/bolo/helpers"
 	files_database "github.com/go-bolo/files/database"
 	"github.com/pkg/errors"
+	"gorm.io/gorm"
 )
 
 func NewFileModel() *FileModel {
@@ -22,25 +22,33 @@ func NewFileModel() *FileModel {
 type FileModel struct {
 	ID uint64 `gorm:"column:id;primary_key"  json:"id" filter:"param:id;type:number"`
 
-	Label          *string            `gorm:"column:label;" json:"label" filter:"param:id;type:number"`
-	Description    *string            `gorm:"column:description;type:text" json:"description" filter:"param:description;type:string"`
-	Name           string             `gorm:"unique;column:name;type:varchar(255);not null" json:"name" filter:"param:name;type:string"`
-	Size           *int64             `gorm:"column:size;" json:"size" filter:"param:size;type:number"`
-	Encoding       string             `gorm:"column:encoding;type:varchar(255)" json:"encoding" filter:"param:encoding;type:string"`
-	Active         bool               `gorm:"column:active;type:tinyint(1);default:1" json:"active" filter:"param:active;type:boolean"`
-	Originalname   string             `gorm:"column:originalname;type:varchar(255)" json:"originalname" filter:"param:originalname;type:string"`
-	Mime           *string            `gorm:"column:mime;type:varchar(255)" json:"mime" filter:"param:mime;type:string"`
-	Extension      *string            `gorm:"column:extension;type:varchar(10)" json:"extension" filter:"param:extension;type:string"`
-	StorageName    string             `gorm:"column:storageName;type:varchar(255)" json:"storageName" filter:"param:storageName;type:string"`
-	IsLocalStorage bool               `gorm:"column:isLocalStorage;type:tinyint(1);default:1" json:"isLocalStorage" filter:"param:isLocalStorage;type:boolean"`
-	URLsRaw        database.JSONField `gorm:"column:urls;type:blob;not null" json:"-"`
-	ExtraDataRaw   database.JSONField `gorm:"column:extraData;type:blob" json:"-"`
-	CreatedAt      time.Time          `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
-	UpdatedAt      time.Time          `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
-	CreatorID      *int64             `gorm:"column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
-
-	URLs      files_database.ImageURLsField `gorm:"-" json:"urls"`
+	Label          *string                  `gorm:"column:label;" json:"label" filter:"param:id;type:number"`
+	Description    *string                  `gorm:"column:description;type:text" json:"description" filter:"param:description;type:string"`
+	Name           string                   `gorm:"unique;column:name;type:varchar(255);not null" json:"name" filter:"param:name;type:string"`
+	Size           *int64                   `gorm:"column:size;" json:"size" filter:"param:size;type:number"`
+	Checksum       string                   `gorm:"column:checksum;type:varchar(64)" json:"checksum"`
+	Encoding       string                   `gorm:"column:encoding;type:varchar(255)" json:"encoding" filter:"param:encoding;type:string"`
+	Active         bool                     `gorm:"column:active;type:tinyint(1);default:1" json:"active" filter:"param:active;type:boolean"`
+	Originalname   string                   `gorm:"column:originalname;type:varchar(255)" json:"originalname" filter:"param:originalname;type:string"`
+	Mime           *string                  `gorm:"column:mime;type:varchar(255)" json:"mime" filter:"param:mime;type:string"`
+	Extension      *string                  `gorm:"column:extension;type:varchar(10)" json:"extension" filter:"param:extension;type:string"`
+	StorageName    string                   `gorm:"column:storageName;type:varchar(255)" json:"storageName" filter:"param:storageName;type:string"`
+	IsLocalStorage bool                     `gorm:"column:isLocalStorage;type:tinyint(1);default:1" json:"isLocalStorage" filter:"param:isLocalStorage;type:boolean"`
+	ExtraDataRaw   files_database.JSONField `gorm:"column:extraData;type:blob" json:"-"`
+	CreatedAt      time.Time                `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
+	UpdatedAt      time.Time                `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
+	DeletedAt      gorm.DeletedAt           `gorm:"column:deletedAt;index" json:"deletedAt"`
+	CreatorID      *int64                   `gorm:"column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
+	TenantID       string                   `gorm:"column:tenantId;type:varchar(100);not null;default:''" json:"-"`
+	FolderID       *uint64                  `gorm:"column:folderId;index" json:"folderId" filter:"param:folderId;type:number"`
+	// Expired records are hidden and deleted by the expiration purge job, nil doesn't expire
+	ExpiresAt *time.Time `gorm:"column:expiresAt;type:datetime;index" json:"expiresAt"`
+
+	URLs      files_database.ImageURLsField `gorm:"column:urls;type:blob;not null" json:"urls"`
 	ExtraData *FileExtraData                `gorm:"-" json:"extraData"`
+	Tags      []*TagModel                   `gorm:"-" json:"tags,omitempty"`
+	// text extracted in the upload, saved in the search index
+	extractedText *string
 
 	LinkPermanent string `gorm:"-" json:"linkPermanent"`
 }
@@ -58,6 +66,16 @@ func (m *FileModel) GetIDString() string {
 	return strconv.FormatInt(int64(m.ID), 10)
 }
 
+// GetTenantID - Tenant of the record, empty without tenant
+func (m *FileModel) GetTenantID() string {
+	return m.TenantID
+}
+
+// GetAccessRecord - Get the data used by access policies
+func (m *FileModel) GetAccessRecord() *AccessRecord {
+	return &AccessRecord{Type: AccessRecordTypeFile, ID: m.ID, CreatorID: m.CreatorID, FolderID: m.FolderID}
+}
+
 func (m *FileModel) GetUrl(style string) string {
 	return m.URLs["original"]
 }
@@ -68,7 +86,6 @@ func (m *FileModel) GetURLs() files_database.ImageURLsField {
 
 func (m *FileModel) SetURLs(urls files_database.ImageURLsField) error {
 	m.URLs = urls
-	m.URLsRaw = []byte(urls.ToJSON())
 
 	return nil
 }
@@ -109,6 +126,11 @@ func (m *FileModel) Save() error {
 		}
 	}
 
+	err = IndexFileSearch(db, m)
+	if err != nil {
+		return errors.Wrap(err, "FileModel.Save error on index search")
+	}
+
 	return nil
 }
 
@@ -117,6 +139,28 @@ func (m *FileModel) LoadData() error {
 	return nil
 }
 
+// SetExtraDataKey - Set one extra data key, saved with the record
+func (m *FileModel) SetExtraDataKey(key, value string) error {
+	if m.ExtraData == nil {
+		m.ExtraData = &FileExtraData{}
+	}
+
+	if m.ExtraData.Keys == nil {
+		m.ExtraData.Keys = map[string]string{}
+	}
+
+	m.ExtraData.Keys[key] = value
+
+	raw, err := json.Marshal(m.ExtraData)
+	if err != nil {
+		return err
+	}
+
+	m.ExtraDataRaw = raw
+
+	return nil
+}
+
 func (m *FileModel) LoadTeaser() error {
 	return nil
 }
@@ -149,9 +193,35 @@ func (m *FileModel) ResetURLs(app bolo.App) error {
 	return nil
 }
 
+// Delete - Move the file to trash, use Destroy to remove it permanently
 func (m *FileModel) Delete() error {
 	db := bolo.GetDefaultDatabaseConnection()
-	return db.Unscoped().Delete(&m).Error
+	return db.Delete(m).Error
+}
+
+// Restore - Restore one file from trash
+func (m *FileModel) Restore() error {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	err := db.Unscoped().Model(m).Update("deletedAt", nil).Error
+	if err != nil {
+		return err
+	}
+
+	m.DeletedAt = gorm.DeletedAt{}
+
+	return nil
+}
+
+// Destroy - Delete the file record from database, including the trashed ones
+func (m *FileModel) Destroy() error {
+	db := bolo.GetDefaultDatabaseConnection()
+	return db.Unscoped().Delete(m).Error
+}
+
+// IsTrashed - Check if the file is in trash
+func (m *FileModel) IsTrashed() bool {
+	return m.DeletedAt.Valid
 }
 
 // GetFilesInField - Find files associated to record field
@@ -169,6 +239,8 @@ func GetFilesInField(modelName, fieldName, modelID string, limit int) ([]*FileMo
 			fieldName,
 			modelID,
 		).
+		Where("files.deletedAt IS NULL").
+		Scopes(NotExpiredScope("files")).
 		Scan(&files).Error; err != nil {
 		return nil, err
 	}
@@ -189,8 +261,8 @@ func GetFilesInField(modelName, fieldName, modelID string, limit int) ([]*FileMo
 	return files, nil
 }
 
-// GetFilesInRecord - Find all files associated to record
-func GetFilesInRecord(modelName string, modelID string) ([]FileModel, error) {
+// GetFilesInRecord - Find all files associated to record, scopes like TenantScope filter the files
+func GetFilesInRecord(modelName string, modelID string, scopes ...func(*gorm.DB) *gorm.DB) ([]FileModel, error) {
 	db := bolo.GetDefaultDatabaseConnection()
 
 	var files []FileModel
@@ -202,22 +274,14 @@ func GetFilesInRecord(modelName string, modelID string) ([]FileModel, error) {
 			modelName,
 			modelID,
 		).
+		Where("files.deletedAt IS NULL").
+		Scopes(NotExpiredScope("files")).
+		Scopes(scopes...).
 		Scan(&files).Error; err != nil {
 		return nil, err
 	}
 
 	for i := range files {
-		if len(files[i].URLsRaw) > 0 {
-			var url files_database.ImageURLsField
-			err := json.Unmarshal(files[i].URLsRaw, &url)
-			if err != nil {
-				log.Println("Error on parse file url", string(files[i].URLsRaw))
-				continue
-			}
-
-			files[i].URLs = url
-		}
-
 		if len(files[i].ExtraDataRaw) > 0 {
 			var extraData FileExtraData
 			err := json.Unmarshal(files[i].ExtraDataRaw, &extraData)
@@ -233,8 +297,9 @@ func GetFilesInRecord(modelName string, modelID string) ([]FileModel, error) {
 	return files, nil
 }
 
-func FileFindManyInRecord(modelName, fieldName, modelId string, target *[]FileModel) error {
-	db := bolo.GetDefaultDatabaseConnection()
+// FileFindManyInRecord - Find the files of one record field, scopes like TenantScope filter the files
+func FileFindManyInRecord(modelName, fieldName, modelId string, target *[]FileModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
 
 	err := db.
 		Joins(`INNER JOIN fileassocs AS A on
@@ -242,6 +307,7 @@ func FileFindManyInRecord(modelName, fieldName, modelId string, target *[]FileMo
 			A.modelName = ? AND
 			A.modelId = ? AND
 			A.fileId = files.id`, fieldName, modelName, modelId).
+		Scopes(NotExpiredScope("files")).
 		Order("'order' ASC").
 		Find(&target).Error
 	if err != nil {
@@ -252,8 +318,8 @@ func FileFindManyInRecord(modelName, fieldName, modelId string, target *[]FileMo
 }
 
 // FindOne - Find one file record by id
-func FileFindOne(id string, record *FileModel) error {
-	db := bolo.GetDefaultDatabaseConnection()
+func FileFindOne(id string, record *FileModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
 
 	n, err := strconv.ParseInt(id, 10, 64)
 	if err == nil || n == 0 {
@@ -267,10 +333,22 @@ func FileFindOne(id string, record *FileModel) error {
 	}
 }
 
-func FileFindManyByIds(fileIds []string, records *[]FileModel) error {
-	db := bolo.GetDefaultDatabaseConnection()
+// TrashedFileFindOne - Find one file record in trash by id
+func TrashedFileFindOne(id string, record *FileModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
+
+	return db.
+		Unscoped().
+		Where("deletedAt IS NOT NULL").
+		Where("id = ? OR name = ?", id, id).
+		First(record).Error
+}
+
+func FileFindManyByIds(fileIds []string, records *[]FileModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
 
 	err := db.Where("id IN ?", fileIds).
+		Scopes(NotExpiredScope("files")).
 		Find(records).Error
 	if err != nil {
 		return err
@@ -327,13 +405,14 @@ func UpdateFieldFilesById(modelId string, fileIds []string, cfg FieldConfigurati
 	}
 
 	// delete old items
-	err = RemoveFilesFromFieldByIds(modelId, itemsToDelete, cfg)
+	removed, err := removeFilesFromFieldByIds(modelId, itemsToDelete, cfg)
 	if err != nil {
 		return errors.Wrap(err, "UpdateFieldFilesById error on delete files")
 	}
 
 	// create not existent files and associate
-	err = AddFilesInFieldByIDs(modelId, itemsToAdd, cfg)
+	added, err := addFilesInFieldByIDs(modelId, itemsToAdd, cfg)
+	triggerAssociationChanged(AccessRecordTypeFile, modelId, cfg, added, removed)
 	if err != nil {
 		return errors.Wrap(err, "UpdateFieldFilesById error on add new assocs")
 	}
@@ -343,8 +422,15 @@ func UpdateFieldFilesById(modelId string, fileIds []string, cfg FieldConfigurati
 
 // Add many files in model field using fileId
 func AddFilesInFieldByIDs(modelId string, fileIds []string, cfg FieldConfigurationInterface) error {
+	added, err := addFilesInFieldByIDs(modelId, fileIds, cfg)
+	triggerAssociationChanged(AccessRecordTypeFile, modelId, cfg, added, nil)
+	return err
+}
+
+// addFilesInFieldByIDs - Associate the files without the association changed event, returns the added ids
+func addFilesInFieldByIDs(modelId string, fileIds []string, cfg FieldConfigurationInterface) ([]uint64, error) {
 	if len(fileIds) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	db := bolo.GetDefaultDatabaseConnection()
@@ -353,7 +439,7 @@ func AddFilesInFieldByIDs(modelId string, fileIds []string, cfg FieldConfigurati
 
 	err := FileFindManyByIds(fileIds, &files)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// create assocs
@@ -383,15 +469,28 @@ func AddFilesInFieldByIDs(modelId string, fileIds []string, cfg FieldConfigurati
 
 	err = db.Create(&assocsToCreate).Error
 	if err != nil {
-		return errors.Wrap(err, "AddFilesInFieldById error on create assocs")
+		return nil, errors.Wrap(err, "AddFilesInFieldById error on create assocs")
 	}
 
-	return nil
+	added := []uint64{}
+	for i := range assocsToCreate {
+		added = append(added, uint64(assocsToCreate[i].FileID))
+	}
+
+	return added, nil
 }
 
 func RemoveFilesFromFieldByIds(modelId string, fileIds []string, cfg FieldConfigurationInterface) error {
+	removed, err := removeFilesFromFieldByIds(modelId, fileIds, cfg)
+	triggerAssociationChanged(AccessRecordTypeFile, modelId, cfg, nil, removed)
+	return err
+}
+
+// removeFilesFromFieldByIds - Remove the files from the field without the association changed event,
+// returns the removed ids
+func removeFilesFromFieldByIds(modelId string, fileIds []string, cfg FieldConfigurationInterface) ([]uint64, error) {
 	if len(fileIds) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	db := bolo.GetDefaultDatabaseConnection()
@@ -404,7 +503,7 @@ func RemoveFilesFromFieldByIds(modelId string, fileIds []string, cfg FieldConfig
 		Select("id").
 		Find(&filesWithIds).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ids := []string{}
@@ -414,22 +513,27 @@ func RemoveFilesFromFieldByIds(modelId string, fileIds []string, cfg FieldConfig
 
 	err = db.
 		Where("modelName = ? AND field = ? AND modelId = ? AND fileId IN ?", cfg.GetModelName(), cfg.GetFieldName(), modelId, ids).
-		Select("id AS id").
+		Select("id", "fileId").
 		Find(&assocs).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(assocs) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	r := db.
 		Delete(&assocs)
 
 	if r.Error != nil {
-		return r.Error
+		return nil, r.Error
 	}
 
-	return nil
+	removed := []uint64{}
+	for i := range assocs {
+		removed = append(removed, uint64(assocs[i].FileID))
+	}
+
+	return removed, nil
 }
@@ -1,6 +1,8 @@
 package files
 
 import (
+	"time"
+
 	"github.com/go-bolo/bolo"
 	"github.com/go-bolo/files/migrations"
 	files_processor "github.com/go-bolo/files/processor"
@@ -11,9 +13,12 @@ import (
 type FilePlugin struct {
 	bolo.Pluginer
 
-	Name            string
-	FileController  *FileController
-	ImageController *ImageController
+	Name                  string
+	FileController        *FileController
+	ImageController       *ImageController
+	FolderController      *FolderController
+	TagController         *TagController
+	MaintenanceController *MaintenanceController
 
 	Storages         map[string]Storager
 	FileStorageName  string
@@ -27,6 +32,47 @@ type FilePlugin struct {
 	ImageFormat         string
 	ImageFormatToIgnore string
 	ImageStyles         map[string]ImageStyleCfg
+
+	// How long deleted files and images stay in trash before being purged
+	TrashRetention time.Duration
+	// Interval between trash purge job runs, the job is disabled if < 0
+	TrashPurgeInterval time.Duration
+	// Interval between runs of the job that deletes expired files and images, the job is disabled if < 0
+	ExpiredPurgeInterval time.Duration
+
+	// Files processed at same time in multiple uploads
+	UploadConcurrency int
+	// Max files in one multiple upload request
+	MaxUploadFiles int
+
+	RemoteImport RemoteImportCfg
+	// Max decoded size in bytes of files sent as data uri in JSON bodies
+	MaxDataURISize int64
+	// Expiration of signed urls used in downloads
+	SignedURLExpiration time.Duration
+	// Max files in one zip download
+	MaxZipFiles int
+	// Max records in one bulk request, like folder moves and bulk tagging
+	MaxBulkItems int
+	// Revisions kept for each file and image when the contents are replaced, older revisions are deleted.
+	// All revisions are kept if < 0
+	MaxRevisions int
+
+	// Per record authorization, defaults to AssociationAccessPolicy
+	AccessPolicy AccessPolicy
+	// Optional, required by queries with seletor=team
+	TeamResolver TeamResolver
+	// Optional, records are isolated by the request tenant
+	TenantResolver TenantResolver
+	// Optional storages used in uploads of each tenant
+	TenantStorages map[string]TenantStorageCfg
+
+	Quota QuotaCfg
+
+	// Search of the ?q= param in queries, defaults to LikeSearchBackend
+	SearchBackend SearchBackend
+	// Text of uploaded files saved in the search index, defaults to PlainTextExtractor
+	TextExtractor TextExtractor
 }
 
 func (p *FilePlugin) GetName() string {
@@ -37,6 +83,17 @@ func (p *FilePlugin) GetStorage(fileTypeName string) Storager {
 	return p.Storages[fileTypeName]
 }
 
+// GetFileStorage - Get the storage where the file is saved, fallback to the default file storage
+func (p *FilePlugin) GetFileStorage(record *FileModel) Storager {
+	if record.StorageName != "" {
+		if storage := p.GetStorage(record.StorageName); storage != nil {
+			return storage
+		}
+	}
+
+	return p.GetStorage(p.FileStorageName)
+}
+
 func (p *FilePlugin) SetStorage(fileTypeName string, s Storager) error {
 	p.Storages[fileTypeName] = s
 	return nil
@@ -51,6 +108,15 @@ func (p *FilePlugin) Init(app bolo.App) error {
 	p.ImageController = NewImageController(&ImageControllerConfiguration{
 		App: app,
 	})
+	p.FolderController = NewFolderController(&FolderControllerConfiguration{
+		App: app,
+	})
+	p.TagController = NewTagController(&TagControllerConfiguration{
+		App: app,
+	})
+	p.MaintenanceController = NewMaintenanceController(&MaintenanceControllerConfiguration{
+		App: app,
+	})
 
 	app.GetEvents().On("bindRoutes", event.ListenerFunc(func(e event.Event) error {
 		return p.BindRoutes(app)
@@ -60,6 +126,12 @@ func (p *FilePlugin) Init(app bolo.App) error {
 		return p.setTemplateFunctions(app)
 	}), event.Normal)
 
+	app.GetEvents().On("bootstrap", event.ListenerFunc(func(e event.Event) error {
+		p.StartTrashPurgeJob(app)
+		p.StartExpiredPurgeJob(app)
+		return nil
+	}), event.Normal)
+
 	return nil
 }
 
@@ -71,24 +143,27 @@ func (p *FilePlugin) BindRoutes(app bolo.App) error {
 
 	routerAvatar := app.SetRouterGroup("avatar", "/avatar")
 	routerAvatar.GET("/:userID", ctl.GetAvatar)
+	routerAvatar.POST("/:userID", ctl.SetAvatar)
 
 	routerAPI := app.SetRouterGroup("image-api", "/api/v1/image")
 	routerAPI.GET("", ctl.Query)
 	routerAPI.GET("/:id", ctl.FindOne)
 	routerAPI.POST("/:id", ctl.Update)
 	routerAPI.POST("/:id/reprocess", ctl.UpdateImageToReprocess)
-	// routerAPI.GET("/:id", ctl.Delete)
+	routerAPI.DELETE("/:id", ctl.Delete)
 	routerAPI.GET("/:style/:id", ctl.FindOne)
 	routerAPI.GET("/:id/data", ctl.FindOneData)
+	routerAPI.GET("/:id/download", ctl.Download)
 	routerAPI.POST("", ctl.UploadFile)
 
 	routerFileAPI := app.SetRouterGroup("file-api", "/api/v1/file")
 	routerFileAPI.GET("", ctlFile.Query)
 	routerFileAPI.GET("/:id", ctlFile.FindOne)
 	routerFileAPI.POST("/:id", ctlFile.Update)
-	// routerAPI.GET("/:id", ctl.Delete)
+	routerFileAPI.DELETE("/:id", ctlFile.Delete)
 	routerFileAPI.GET("/:style/:id", ctlFile.FindOne)
 	routerFileAPI.GET("/:id/data", ctlFile.FindOneData)
+	routerFileAPI.GET("/:id/download", ctlFile.Download)
 	routerFileAPI.POST("", ctlFile.UploadFile)
 
 	routerV2 := app.SetRouterGroup("images-v2-api", "/api/v2/image")
@@ -97,12 +172,51 @@ func (p *FilePlugin) BindRoutes(app bolo.App) error {
 	}), routerV2)
 
 	routerV2.GET("/:id/reset-styles", ctl.ResetImageStyles)
+	routerV2.POST("/import", ctl.Import)
+	routerV2.GET("/:id/download", ctl.Download)
+	routerV2.GET("/trash", ctl.QueryTrash)
+	routerV2.POST("/:id/restore", ctl.Restore)
+	routerV2.POST("/:id/replace", ctl.Replace)
+	routerV2.GET("/:id/revisions", ctl.QueryRevisions)
+	routerV2.GET("/:id/revisions/:number/download", ctl.DownloadRevision)
+	routerV2.POST("/:id/revisions/:number/restore", ctl.RestoreRevision)
 
 	routerFileV2 := app.SetRouterGroup("files-v2-api", "/api/v2/file")
 	app.SetResource("files-v2", NewFileController(&FileControllerConfiguration{
 		App: app,
 	}), routerFileV2)
 
+	routerFileV2.POST("/import", ctlFile.Import)
+	routerFileV2.GET("/:id/download", ctlFile.Download)
+	routerFileV2.GET("/zip", ctlFile.DownloadZip)
+	routerFileV2.GET("/usage", ctlFile.Usage)
+	routerFileV2.GET("/trash", ctlFile.QueryTrash)
+	routerFileV2.POST("/:id/restore", ctlFile.Restore)
+	routerFileV2.POST("/:id/replace", ctlFile.Replace)
+	routerFileV2.GET("/:id/revisions", ctlFile.QueryRevisions)
+	routerFileV2.GET("/:id/revisions/:number/download", ctlFile.DownloadRevision)
+	routerFileV2.POST("/:id/revisions/:number/restore", ctlFile.RestoreRevision)
+
+	routerFolderV2 := app.SetRouterGroup("folders-v2-api", "/api/v2/folder")
+	app.SetResource("folders-v2", p.FolderController, routerFolderV2)
+
+	routerFolderV2.POST("/:id/move", p.FolderController.Move)
+	routerFolderV2.POST("/:id/copy", p.FolderController.Copy)
+
+	routerTagV2 := app.SetRouterGroup("tags-v2-api", "/api/v2/tag")
+	app.SetResource("tags-v2", p.TagController, routerTagV2)
+
+	routerTagV2.POST("/bulk-tag", p.TagController.BulkTag)
+	routerTagV2.POST("/bulk-untag", p.TagController.BulkUntag)
+
+	routerMaintenance := app.SetRouterGroup("files-maintenance-api", "/api/v2/files-maintenance")
+	routerMaintenance.POST("/gc", p.MaintenanceController.GC)
+	routerMaintenance.POST("/migrate-storage", p.MaintenanceController.MigrateStorage)
+	routerMaintenance.GET("/migrate-storage", p.MaintenanceController.MigrateStorageStatus)
+	routerMaintenance.POST("/regenerate-styles", p.MaintenanceController.RegenerateStyles)
+	routerMaintenance.GET("/regenerate-styles", p.MaintenanceController.RegenerateStylesStatus)
+	routerMaintenance.POST("/transfer-ownership", p.MaintenanceController.TransferOwnership)
+
 	return nil
 }
 
@@ -117,19 +231,46 @@ func (p *FilePlugin) GetMigrations() []*bolo.Migration {
 	return []*bolo.Migration{
 		migrations.GetInitMigration(),
 		migrations.GetMigration2(),
+		migrations.GetMigration3(),
+		migrations.GetMigration4(),
+		migrations.GetMigration5(),
+		migrations.GetMigration6(),
+		migrations.GetMigration7(),
+		migrations.GetMigration8(),
+		migrations.GetMigration9(),
+		migrations.GetMigration10(),
+		migrations.GetMigration11(),
 	}
 }
 
 type FilePluginCfgs struct {
-	Storages            map[string]Storager
-	ImageFormat         string
-	ImageFormatToIgnore string
-	ImageStyles         map[string]ImageStyleCfg
-	FileStorageName     string
-	ImageStorageName    string
-	MaxImageWidth       uint
-	MaxImageHeight      uint
-	Processor           files_processor.FileProcessor
+	Storages             map[string]Storager
+	ImageFormat          string
+	ImageFormatToIgnore  string
+	ImageStyles          map[string]ImageStyleCfg
+	FileStorageName      string
+	ImageStorageName     string
+	MaxImageWidth        uint
+	MaxImageHeight       uint
+	Processor            files_processor.FileProcessor
+	TrashRetention       time.Duration
+	TrashPurgeInterval   time.Duration
+	ExpiredPurgeInterval time.Duration
+	UploadConcurrency    int
+	MaxUploadFiles       int
+	RemoteImport         RemoteImportCfg
+	MaxDataURISize       int64
+	SignedURLExpiration  time.Duration
+	MaxZipFiles          int
+	MaxBulkItems         int
+	MaxRevisions         int
+	AccessPolicy         AccessPolicy
+	TeamResolver         TeamResolver
+	TenantResolver       TenantResolver
+	TenantStorages       map[string]TenantStorageCfg
+	Quota                QuotaCfg
+	SearchBackend        SearchBackend
+	TextExtractor        TextExtractor
 }
 
 type ImageStyleCfg struct {
@@ -139,15 +280,33 @@ type ImageStyleCfg struct {
 
 func NewPlugin(cfgs *FilePluginCfgs) *FilePlugin {
 	p := FilePlugin{
-		Name:                "files",
-		FileStorageName:     "local",
-		ImageStorageName:    "local",
-		ImageFormat:         cfgs.ImageFormat,
-		ImageFormatToIgnore: cfgs.ImageFormatToIgnore,
-		ImageStyles:         cfgs.ImageStyles,
-		MaxImageWidth:       2560,
-		MaxImageHeight:      1700,
-		Processor:           cfgs.Processor,
+		Name:                 "files",
+		FileStorageName:      "local",
+		ImageStorageName:     "local",
+		ImageFormat:          cfgs.ImageFormat,
+		ImageFormatToIgnore:  cfgs.ImageFormatToIgnore,
+		ImageStyles:          cfgs.ImageStyles,
+		MaxImageWidth:        2560,
+		MaxImageHeight:       1700,
+		Processor:            cfgs.Processor,
+		TrashRetention:       30 * 24 * time.Hour,
+		TrashPurgeInterval:   time.Hour,
+		ExpiredPurgeInterval: 10 * time.Minute,
+		UploadConcurrency:    4,
+		MaxUploadFiles:       50,
+		RemoteImport:         cfgs.RemoteImport,
+		MaxDataURISize:       10 * 1024 * 1024,
+		SignedURLExpiration:  15 * time.Minute,
+		MaxZipFiles:          200,
+		MaxBulkItems:         1000,
+		MaxRevisions:         10,
+		AccessPolicy:         &AssociationAccessPolicy{},
+		TeamResolver:         cfgs.TeamResolver,
+		TenantResolver:       cfgs.TenantResolver,
+		TenantStorages:       cfgs.TenantStorages,
+		Quota:                cfgs.Quota,
+		SearchBackend:        &LikeSearchBackend{},
+		TextExtractor:        &PlainTextExtractor{MaxSize: 1024 * 1024},
 	}
 
 	if cfgs.Storages != nil {
@@ -170,6 +329,58 @@ func NewPlugin(cfgs *FilePluginCfgs) *FilePlugin {
 		p.MaxImageHeight = cfgs.MaxImageHeight
 	}
 
+	if cfgs.TrashRetention != 0 {
+		p.TrashRetention = cfgs.TrashRetention
+	}
+
+	if cfgs.TrashPurgeInterval != 0 {
+		p.TrashPurgeInterval = cfgs.TrashPurgeInterval
+	}
+
+	if cfgs.ExpiredPurgeInterval != 0 {
+		p.ExpiredPurgeInterval = cfgs.ExpiredPurgeInterval
+	}
+
+	if cfgs.UploadConcurrency != 0 {
+		p.UploadConcurrency = cfgs.UploadConcurrency
+	}
+
+	if cfgs.MaxUploadFiles != 0 {
+		p.MaxUploadFiles = cfgs.MaxUploadFiles
+	}
+
+	if cfgs.MaxDataURISize != 0 {
+		p.MaxDataURISize = cfgs.MaxDataURISize
+	}
+
+	if cfgs.SignedURLExpiration != 0 {
+		p.SignedURLExpiration = cfgs.SignedURLExpiration
+	}
+
+	if cfgs.MaxZipFiles != 0 {
+		p.MaxZipFiles = cfgs.MaxZipFiles
+	}
+
+	if cfgs.MaxBulkItems != 0 {
+		p.MaxBulkItems = cfgs.MaxBulkItems
+	}
+
+	if cfgs.MaxRevisions != 0 {
+		p.MaxRevisions = cfgs.MaxRevisions
+	}
+
+	if cfgs.AccessPolicy != nil {
+		p.AccessPolicy = cfgs.AccessPolicy
+	}
+
+	if cfgs.SearchBackend != nil {
+		p.SearchBackend = cfgs.SearchBackend
+	}
+
+	if cfgs.TextExtractor != nil {
+		p.TextExtractor = cfgs.TextExtractor
+	}
+
 	if p.ImageFormat == "" {
 		p.ImageFormat = "png"
 	}
@@ -0,0 +1,592 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/helpers"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FolderListJSONResponse struct {
+	bolo.BaseListReponse
+	Records *[]*FolderModel `json:"folder"`
+}
+
+type FolderCountJSONResponse struct {
+	bolo.BaseMetaResponse
+}
+
+type FolderFindOneJSONResponse struct {
+	Record *FolderModel `json:"folder"`
+}
+
+type FolderMoveJSONResponse struct {
+	Result *FolderMoveResult `json:"result"`
+}
+
+type FolderCopyJSONResponse struct {
+	Result *FolderCopyResult `json:"result"`
+}
+
+func NewFolderController(cfgs *FolderControllerConfiguration) *FolderController {
+	return &FolderController{App: cfgs.App}
+}
+
+type FolderControllerConfiguration struct {
+	App bolo.App
+}
+
+// FolderController - Folders CRUD and move or copy of files and images between folders. Use "root" as folder
+// id in move and copy actions to target the library root
+type FolderController struct {
+	App bolo.App
+}
+
+func folderHTTPError(err error) error {
+	if errors.Is(err, ErrFolderInvalidName) || errors.Is(err, ErrFolderInvalidVisibility) || errors.Is(err, ErrFolderInvalidParent) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if errors.Is(err, ErrFolderNotEmpty) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return err
+}
+
+func (ctl *FolderController) Query(c echo.Context) error {
+	var err error
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	query, err := getFolderQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = query.Session(&gorm.Session{}).Model(&FolderModel{}).Limit(-1).Offset(-1).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	orderColumn, orderIsDesc, orderValid := helpers.ParseUrlQueryOrder(c.QueryParam("order"), c.QueryParam("sort"), c.QueryParam("sortDirection"))
+
+	if orderValid {
+		query = query.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: orderColumn},
+			Desc:   orderIsDesc,
+		})
+	} else {
+		query = query.
+			Order("name ASC").
+			Order("id ASC")
+	}
+
+	records := make([]*FolderModel, 0)
+	err = query.
+		Limit(ctx.GetLimit()).
+		Offset(ctx.GetOffset()).
+		Find(&records).Error
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Debug("FolderController.Query Error on find records")
+
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	resp := FolderListJSONResponse{
+		Records: &records,
+	}
+
+	resp.Meta.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+func (ctl *FolderController) Count(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	query, err := getFolderQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = query.Session(&gorm.Session{}).Model(&FolderModel{}).Limit(-1).Offset(-1).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	resp := FolderCountJSONResponse{}
+	resp.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+// getFolderQuery - Folders of the request tenant the request can find, sub folders are filtered with
+// ?parentId=<id>, root folders with ?parentId_is-null=true and all descendants with ?inFolder=<id>
+func getFolderQuery(ctx *bolo.RequestContext) (*gorm.DB, error) {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	queryI, err := ctx.Query.SetDatabaseQueryForModel(db, &FolderModel{})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": fmt.Sprintf("%+v\n", err),
+		}).Error("getFolderQuery error")
+	}
+	query := queryI.(*gorm.DB)
+
+	query, err = scopeQueryByTenant(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if q := ctx.QueryParam("q"); q != "" {
+		query = query.Where("name LIKE ?", "%"+q+"%")
+	}
+
+	if inFolder := ctx.QueryParam("inFolder"); inFolder != "" {
+		folder := FolderModel{}
+		err = requestFolderFindOne(ctx, inFolder, &folder)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return query.Where("1 = 0"), nil
+			}
+			return nil, err
+		}
+
+		query = query.Where("path LIKE ? AND id <> ?", folder.Path+"%", folder.ID)
+	}
+
+	if !ctx.Can("find_any_folder") {
+		query = query.Where("id NOT IN (?)", getHiddenFoldersQuery(ctx))
+	}
+
+	return query, nil
+}
+
+// Create - Create one folder with body {"folder": {"name": "", "parentId": 1, "visibility": "inherit"}}
+func (ctl *FolderController) Create(c echo.Context) error {
+	var err error
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("create_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	body := FolderFindOneJSONResponse{Record: NewFolderModel()}
+	if err := c.Bind(&body); err != nil || body.Record == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	record := NewFolderModel()
+	record.Name = body.Record.Name
+	record.Description = body.Record.Description
+	record.Visibility = body.Record.Visibility
+	record.CreatorID = getCreatorID(ctx)
+	record.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	record.ParentID, err = getFindableParentID(ctx, body.Record.ParentID)
+	if err != nil {
+		return err
+	}
+
+	err = record.Save()
+	if err != nil {
+		return folderHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, &FolderFindOneJSONResponse{Record: record})
+}
+
+// getFindableParentID - Folders can only be created or moved in folders the request can find
+func getFindableParentID(ctx *bolo.RequestContext, parentID *uint64) (*uint64, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+
+	parent := FolderModel{}
+	err := requestFolderFindOne(ctx, strconv.FormatUint(*parentID, 10), &parent)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, folderHTTPError(ErrFolderInvalidParent)
+		}
+		return nil, err
+	}
+
+	if !canFindFolder(ctx, &parent) {
+		return nil, folderHTTPError(ErrFolderInvalidParent)
+	}
+
+	return &parent.ID, nil
+}
+
+// findRequestFolder - Find one folder of the request tenant, private folders of other users are not found
+func findRequestFolder(c echo.Context, id string) (*FolderModel, error) {
+	ctx := c.(*bolo.RequestContext)
+
+	record := FolderModel{}
+	err := requestFolderFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NotFoundHandler(c)
+		}
+		return nil, err
+	}
+
+	if !canFindFolder(ctx, &record) {
+		return nil, echo.NotFoundHandler(c)
+	}
+
+	return &record, nil
+}
+
+func (ctl *FolderController) FindOne(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFolder(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &FolderFindOneJSONResponse{Record: record})
+}
+
+// Update - Rename, change the visibility or move one folder with parentId, the folder tree is updated
+func (ctl *FolderController) Update(c echo.Context) error {
+	var err error
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFolder(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	body := FolderFindOneJSONResponse{Record: &FolderModel{
+		Name:        record.Name,
+		Description: record.Description,
+		ParentID:    record.ParentID,
+		Visibility:  record.Visibility,
+	}}
+	if err := c.Bind(&body); err != nil || body.Record == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	record.Name = body.Record.Name
+	record.Description = body.Record.Description
+	record.Visibility = body.Record.Visibility
+
+	record.ParentID, err = getFindableParentID(ctx, body.Record.ParentID)
+	if err != nil {
+		return err
+	}
+
+	err = record.Save()
+	if err != nil {
+		return folderHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, &FolderFindOneJSONResponse{Record: record})
+}
+
+// Delete - Delete one empty folder, returns 409 if the folder has sub folders, files or images
+func (ctl *FolderController) Delete(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_folder")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestFolder(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	err = record.Delete()
+	if err != nil {
+		return folderHTTPError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getTargetFolderID - Get the folder used in move and copy actions, nil for the library root
+func getTargetFolderID(c echo.Context) (*uint64, error) {
+	ctx := c.(*bolo.RequestContext)
+
+	id := c.Param("id")
+	if id == "root" {
+		return nil, nil
+	}
+
+	if !ctx.Can("update_folder") {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	folder, err := findRequestFolder(c, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder.ID, nil
+}
+
+// Move - Move files, images and folders to the folder with body {"fileIds": [], "imageIds": [], "folderIds": []},
+// the request should be able to update every item
+func (ctl *FolderController) Move(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := FolderItemsRequest{}
+	if err := c.Bind(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	if body.Len() == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "fileIds, imageIds or folderIds is required")
+	}
+
+	if body.Len() > filePlugin.MaxBulkItems {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("max %d items in one request", filePlugin.MaxBulkItems))
+	}
+
+	if (len(body.FileIDs) > 0 && !ctx.Can("update_file")) ||
+		(len(body.ImageIDs) > 0 && !ctx.Can("update_image")) ||
+		(len(body.FolderIDs) > 0 && !ctx.Can("update_folder")) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	folderID, err := getTargetFolderID(c)
+	if err != nil {
+		return err
+	}
+
+	tenantScope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	result := FolderMoveResult{}
+
+	files := []FileModel{}
+	err = FileFindManyByIds(body.FileIDs, &files, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	fileIDs := []uint64{}
+	for i := range files {
+		err = checkRecordAccess(c, AccessActionUpdate, files[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+		fileIDs = append(fileIDs, files[i].ID)
+	}
+
+	images := []ImageModel{}
+	err = ImageFindManyByIds(body.ImageIDs, &images, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	imageIDs := []uint64{}
+	for i := range images {
+		err = checkRecordAccess(c, AccessActionUpdate, images[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+		imageIDs = append(imageIDs, images[i].ID)
+	}
+
+	folders := []*FolderModel{}
+	for _, id := range body.FolderIDs {
+		folder, err := findRequestFolder(c, id)
+		if err != nil {
+			return err
+		}
+		folders = append(folders, folder)
+	}
+
+	// folders can't be moved inside themselves, checked before any item is moved
+	if folderID != nil && len(folders) > 0 {
+		target := FolderModel{}
+		err = ctl.App.GetDB().Where("id = ?", *folderID).First(&target).Error
+		if err != nil {
+			return err
+		}
+
+		for _, folder := range folders {
+			if folder.Contains(&target) {
+				return folderHTTPError(ErrFolderInvalidParent)
+			}
+		}
+	}
+
+	err = ctl.App.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		result.Files, err = MoveRecordsToFolder(tx, &FileModel{}, fileIDs, folderID)
+		if err != nil {
+			return err
+		}
+
+		result.Images, err = MoveRecordsToFolder(tx, &ImageModel{}, imageIDs, folderID)
+		if err != nil {
+			return err
+		}
+
+		for _, folder := range folders {
+			// the path changes if one parent folder was moved in the same request
+			err = tx.Where("id = ?", folder.ID).First(folder).Error
+			if err != nil {
+				return err
+			}
+
+			folder.ParentID = folderID
+
+			err = saveFolder(tx, folder)
+			if err != nil {
+				return err
+			}
+			result.Folders++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return folderHTTPError(err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"folderId": folderID,
+		"files":    result.Files,
+		"images":   result.Images,
+		"folders":  result.Folders,
+	}).Debug("FolderController.Move done")
+
+	return c.JSON(http.StatusOK, &FolderMoveJSONResponse{Result: &result})
+}
+
+// Copy - Copy files and images to the folder with body {"fileIds": [], "imageIds": []}, copies are new records
+// with new stored objects, owned by the request user and counted in its storage quota
+func (ctl *FolderController) Copy(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := FolderItemsRequest{}
+	if err := c.Bind(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	if len(body.FolderIDs) > 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "folders can't be copied")
+	}
+
+	if body.Len() == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "fileIds or imageIds is required")
+	}
+
+	// copies upload new objects, so they have the same limit of multiple uploads
+	if body.Len() > filePlugin.MaxUploadFiles {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("max %d items in one request", filePlugin.MaxUploadFiles))
+	}
+
+	if (len(body.FileIDs) > 0 && !(ctx.Can("find_file") && ctx.Can("create_file"))) ||
+		(len(body.ImageIDs) > 0 && !(ctx.Can("find_image") && ctx.Can("create_image"))) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	folderID, err := getTargetFolderID(c)
+	if err != nil {
+		return err
+	}
+
+	tenantScope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	files := []FileModel{}
+	err = FileFindManyByIds(body.FileIDs, &files, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	for i := range files {
+		err = checkRecordAccess(c, AccessActionFind, files[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+	}
+
+	images := []ImageModel{}
+	err = ImageFindManyByIds(body.ImageIDs, &images, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	for i := range images {
+		err = checkRecordAccess(c, AccessActionFind, images[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+	}
+
+	result := FolderCopyResult{Files: []*FileModel{}, Images: []*ImageModel{}}
+
+	for i := range files {
+		record, err := CopyFileToFolder(ctx, &files[i], folderID)
+		if err != nil {
+			return err
+		}
+		result.Files = append(result.Files, record)
+	}
+
+	for i := range images {
+		record, err := CopyImageToFolder(ctx, &images[i], folderID)
+		if err != nil {
+			return err
+		}
+		record.LoadData()
+		result.Images = append(result.Images, record)
+	}
+
+	return c.JSON(http.StatusOK, &FolderCopyJSONResponse{Result: &result})
+}
@@ -4,20 +4,19 @@ import (
 	"net/http"
 	"os"
 	"path"
-	"strconv"
 	"strings"
 
 	"github.com/go-bolo/bolo"
 	files_helpers "github.com/go-bolo/files/helpers"
-	files_processor "github.com/go-bolo/files/processor"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type ImageListJSONResponse struct {
-	bolo.BaseListReponse
+	Meta    QueryListMeta  `json:"meta"`
 	Records *[]*ImageModel `json:"image"`
 }
 
@@ -33,6 +32,12 @@ type ImageBodyRequest struct {
 	Record *ImageModel `json:"image"`
 }
 
+// ImageReplaceJSONResponse - Image with the replaced contents and the revision with the previous contents
+type ImageReplaceJSONResponse struct {
+	Record   *ImageModel    `json:"image"`
+	Revision *RevisionModel `json:"revision"`
+}
+
 func NewImageController(cfgs *ImageControllerConfiguration) *ImageController {
 	return &ImageController{
 		App:                 cfgs.App,
@@ -49,14 +54,18 @@ type ImageController struct {
 	UseExternalImageURL bool
 }
 
+// GetAvatar - Redirect to the user avatar in the style query param or send one generated default avatar
 func (ctl *ImageController) GetAvatar(c echo.Context) error {
-	cfgs := bolo.GetApp().GetConfiguration()
+	cfgs := ctl.App.GetConfiguration()
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
 
 	userID := c.Param("userID")
+	style := GetAvatarStyle(c, filePlugin.ImageStyles)
 
 	logrus.WithFields(logrus.Fields{
 		"userID": userID,
-	}).Debug("ImageController.FindOne id from params")
+		"style":  style,
+	}).Debug("ImageController.GetAvatar id from params")
 
 	record, err := AvatarFindOne(userID)
 	if err != nil {
@@ -66,18 +75,123 @@ func (ctl *ImageController) GetAvatar(c echo.Context) error {
 	if record == nil || record.ID == 0 {
 		logrus.WithFields(logrus.Fields{
 			"userID": userID,
-		}).Debug("FindOneHandler imageID record not found")
+		}).Debug("ImageController.GetAvatar avatar not found")
 
-		return c.Redirect(http.StatusFound, cfgs.GetF("USER_DEFAULT_AVATAR", "https://storage.googleapis.com/linky-site/static/default-avatar.png"))
+		defaultAvatar := cfgs.GetF("USER_DEFAULT_AVATAR", "")
+		if defaultAvatar != "" {
+			return c.Redirect(http.StatusFound, defaultAvatar)
+		}
+
+		return sendDefaultAvatar(c, userID, GetAvatarSize(filePlugin.ImageStyles, style))
 	}
 
 	record.LoadData()
 
-	return c.Redirect(http.StatusFound, record.GetUrl("medium"))
+	return c.Redirect(http.StatusFound, record.GetUrl(style))
 }
 
+// SetAvatar - Upload one image as the user avatar, the image is cropped to one square and replaces the old avatar
 func (ctl *ImageController) SetAvatar(c echo.Context) error {
-	return c.String(200, "not implemented")
+	ctx := c.(*bolo.RequestContext)
+	userID := c.Param("userID")
+
+	if !ctx.IsAuthenticated {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	isOwnAvatar := ctx.AuthenticatedUser != nil && ctx.AuthenticatedUser.GetID() == userID
+	if !isOwnAvatar && !ctx.Can("update_user") {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "image is required")
+	}
+
+	crop, err := getAvatarCrop(c)
+	if err != nil {
+		return avatarHTTPError(err)
+	}
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+	err = files_helpers.CopyRequestFileToTMP(ctx, "image", tmpFilePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilePath)
+
+	croppedFilePath := tmpFilePath + "-avatar"
+	err = CropImageToSquare(tmpFilePath, croppedFilePath, crop)
+	defer os.Remove(croppedFilePath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"userID": userID,
+			"error":  err,
+		}).Debug("ImageController.SetAvatar error on crop image")
+
+		return avatarHTTPError(err)
+	}
+
+	fileName := strings.TrimSuffix(file.Filename, path.Ext(file.Filename)) + ".png"
+
+	croppedFile, err := os.Stat(croppedFilePath)
+	if err != nil {
+		return err
+	}
+
+	// the avatar is counted in the quota of the user that owns it
+	err = quotaHTTPError(checkUserUploadQuota(ctx, userID, croppedFile.Size()))
+	if err != nil {
+		return err
+	}
+
+	newFile := NewImageModel()
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadImageFromLocalhost(fileName, c.FormValue("description"), croppedFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctl.App)
+	if err != nil {
+		return err
+	}
+
+	// the avatar belongs to the user, also when uploaded by one admin
+	newFile.CreatorID = parseCreatorID(userID)
+
+	err = newFile.Save()
+	if err != nil {
+		return err
+	}
+
+	triggerImageAfterUpload(ctx, newFile)
+
+	oldAvatars, err := GetImagesInField(AvatarModelName, AvatarFieldName, userID, 100)
+	if err != nil {
+		return err
+	}
+
+	err = UpdateFieldImagesById(ctx, userID, []string{newFile.GetIDString()}, NewImageFieldConfiguration(AvatarModelName, AvatarFieldName))
+	if err != nil {
+		return err
+	}
+
+	// replaced avatars go to trash and are purged with the trash retention
+	for _, oldAvatar := range oldAvatars {
+		err = oldAvatar.Delete()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"userID": userID,
+				"id":     oldAvatar.ID,
+				"error":  err,
+			}).Warn("ImageController.SetAvatar error on delete old avatar")
+		}
+	}
+
+	return c.JSON(http.StatusOK, &ImageFindOneJSONResponse{Record: newFile})
 }
 
 func (ctl *ImageController) Query(c echo.Context) error {
@@ -90,10 +204,12 @@ func (ctl *ImageController) Query(c echo.Context) error {
 	}
 
 	var count int64
+	cursors := QueryCursors{}
 	records := make([]*ImageModel, 0)
 	err = ImageQueryAndCountReq(&ImageQueryOpts{
 		Records: &records,
 		Count:   &count,
+		Cursors: &cursors,
 		Limit:   ctx.GetLimit(),
 		Offset:  ctx.GetOffset(),
 		C:       c,
@@ -102,6 +218,8 @@ func (ctl *ImageController) Query(c echo.Context) error {
 		logrus.WithFields(logrus.Fields{
 			"error": err,
 		}).Debug("ImageController.Query Error on find contents")
+
+		return err
 	}
 
 	ctx.Pager.Count = count
@@ -115,19 +233,114 @@ func (ctl *ImageController) Query(c echo.Context) error {
 		records[i].LoadData()
 	}
 
+	err = LoadImagesTags(records)
+	if err != nil {
+		return errors.Wrap(err, "ImageController.Query error on load tags")
+	}
+
 	resp := ImageListJSONResponse{
 		Records: &records,
 	}
 
 	resp.Meta.Count = count
+	resp.Meta.QueryCursors = cursors
+
+	resp.Meta.Facets, err = ImageFacetsReq(&ImageQueryOpts{C: c})
+	if err != nil {
+		return errors.Wrap(err, "ImageController.Query error on count facets")
+	}
 
 	return c.JSON(200, &resp)
 }
 
+// Create - Upload one image with multipart form data or with one data uri in JSON body
 func (ctl *ImageController) Create(c echo.Context) error {
+	if isJSONRequest(c) {
+		return ctl.CreateFromDataURI(c)
+	}
+
 	return ctl.UploadFile(c)
 }
 
+// CreateFromDataURI - Upload one image sent as {"image": {"data": "data:<mime>;base64,<data>"}}
+func (ctl *ImageController) CreateFromDataURI(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("create_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := struct {
+		Image *DataURIUploadItem `json:"image"`
+	}{}
+
+	err := bindDataURIBody(c, filePlugin.MaxDataURISize, &body)
+	if err != nil {
+		return err
+	}
+
+	item := body.Image
+	if item == nil || item.Data == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "image.data is required")
+	}
+
+	expiresAt, err := parseExpiresAt(item.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+	defer os.Remove(tmpFilePath)
+
+	mimeType, err := decodeDataURIToFile(item.Data, filePlugin.MaxDataURISize, tmpFilePath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Debug("ImageController.CreateFromDataURI error on decode data uri")
+
+		return dataURIHTTPError(err)
+	}
+
+	// release the base64 data before processing
+	item.Data = ""
+
+	if !isImageFile(tmpFilePath) {
+		return echo.NewHTTPError(http.StatusBadRequest, "data is not an image")
+	}
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	newFile := NewImageModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadImageFromLocalhost(dataURIFileName(item.Name, mimeType), item.Description, tmpFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctl.App)
+	if err != nil {
+		return err
+	}
+
+	newFile.Label = getOptionalString(item.Label)
+
+	err = newFile.Save()
+	if err != nil {
+		return err
+	}
+
+	triggerImageAfterUpload(ctx, newFile)
+
+	return c.JSON(http.StatusOK, &ImageFindOneJSONResponse{Record: newFile})
+}
+
 func (ctl *ImageController) Update(c echo.Context) error {
 	var err error
 
@@ -145,7 +358,7 @@ func (ctl *ImageController) Update(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 	record := ImageModel{}
-	err = ImageFindOne(id, &record)
+	err = requestImageFindOne(RequestContext, id, &record)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"id":    id,
@@ -156,6 +369,23 @@ func (ctl *ImageController) Update(c echo.Context) error {
 
 	record.LoadData()
 
+	err = checkRecordAccess(c, AccessActionUpdate, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	// size and owner are used in storage quotas, they only change with uploads or ownership transfers
+	size, creatorID := record.Size, record.CreatorID
+	// folder changes use the folder move endpoint, that checks the target folder
+	folderID := record.FolderID
+	// the expiration is only set and validated in uploads, expired records are purged
+	expiresAt := record.ExpiresAt
+	// records are moved to trash and restored with the delete and restore endpoints, that check the access
+	deletedAt := record.DeletedAt
+	// cleared so the body is bound in new pointers and doesn't change the kept values
+	record.Size, record.CreatorID, record.FolderID, record.ExpiresAt = nil, nil, nil, nil
+	width, height := record.Width, record.Height
+
 	body := ImageFindOneJSONResponse{Record: &record}
 
 	if err := c.Bind(&body); err != nil {
@@ -170,6 +400,10 @@ func (ctl *ImageController) Update(c echo.Context) error {
 		return c.NoContent(http.StatusNotFound)
 	}
 
+	record.Size, record.CreatorID, record.FolderID = size, creatorID, folderID
+	record.ExpiresAt, record.DeletedAt = expiresAt, deletedAt
+	record.Width, record.Height = width, height
+
 	err = record.Save()
 	if err != nil {
 		return err
@@ -198,7 +432,7 @@ func (ctl *ImageController) UpdateImageToReprocess(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 	record := ImageModel{}
-	err = ImageFindOne(id, &record)
+	err = requestImageFindOne(RequestContext, id, &record)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"id":    id,
@@ -208,6 +442,11 @@ func (ctl *ImageController) UpdateImageToReprocess(c echo.Context) error {
 	}
 
 	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionUpdate, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
 	record.ResetURLs(ctl.App)
 
 	err = record.Save()
@@ -256,9 +495,6 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 	style := c.Param("style")
 	ctx := c.(*bolo.RequestContext)
 	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
-	storageName := filePlugin.ImageStorageName
-	storage := filePlugin.GetStorage(storageName)
-	styles := filePlugin.ImageStyles
 
 	can := ctx.Can("find_image")
 	if !can {
@@ -278,7 +514,7 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 	}).Debug("ImageController.FindOne id from params")
 
 	record := ImageModel{}
-	err := ImageFindOne(id, &record)
+	err := requestImageFindOne(ctx, id, &record)
 	if err != nil {
 		return err
 	}
@@ -292,7 +528,12 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 	}
 
 	record.LoadData()
-	// TODO! move this code to one function
+
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
 	if style != "original" {
 		shouldReset := false
 
@@ -307,57 +548,17 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 			if r != "" {
 				shouldReset = true
 			}
-		}
 
-		if shouldReset {
-			// Check if the image format should be ignored (e.g., GIF, SVG)
-			shouldIgnoreFormat := false
-			if filePlugin.ImageFormatToIgnore != "" && record.Extension != nil {
-				ignoreFormats := strings.Split(filePlugin.ImageFormatToIgnore, ",")
-				for _, ignoreFormat := range ignoreFormats {
-					ignoreFormat = strings.TrimSpace(ignoreFormat)
-					if strings.EqualFold(*record.Extension, ignoreFormat) {
-						shouldIgnoreFormat = true
-						break
-					}
-				}
+			// style generated with one old style configuration:
+			if filePlugin.IsStyleOutdated(&record, style) {
+				shouldReset = true
 			}
+		}
 
-			// Skip processing for ignored formats to preserve their properties (e.g., GIF animation)
-			if shouldIgnoreFormat {
-				// For ignored formats, just use the original URL for all styles
-				record.URLs[style] = record.URLs["original"]
-			} else {
-				url := record.URLs["original"]
-				originalPath := path.Join(os.TempDir(), record.Name) + "_original"
-				defer os.Remove(originalPath)
-
-				processor := filePlugin.Processor
-
-				tmpFilePath := path.Join(os.TempDir(), record.Name)
-
-				resizeOpts := files_processor.Options{
-					"width":  strconv.Itoa(styles[style].Width),
-					"height": strconv.Itoa(styles[style].Height),
-					"url":    url,
-					"format": filePlugin.ImageFormat,
-				}
-
-				err = processor.Resize(originalPath, tmpFilePath, record.Name, resizeOpts)
-				if err != nil {
-					return err
-				}
-
-				dest, _ := storage.GetUploadPathFromFile(style, filePlugin.ImageFormat, &record)
-
-				err = storage.UploadFile(&record, tmpFilePath, dest)
-				if err != nil {
-					return errors.Wrap(err, "UploadImageFromLocalhost Error on upload file")
-				}
-
-				defer os.Remove(tmpFilePath)
-
-				record.URLs[style], _ = storage.GetUrlFromFile(style, &record)
+		if shouldReset {
+			err = GenerateImageStyle(ctl.App, &record, style)
+			if err != nil {
+				return err
 			}
 
 			record.SetURLs(record.URLs)
@@ -365,6 +566,11 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 			if err != nil {
 				return err
 			}
+		} else if filePlugin.isStyleUnversioned(&record, style) {
+			err = saveStyleVersion(ctl.App, &record, style)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
@@ -373,18 +579,59 @@ func (ctl *ImageController) FindOne(c echo.Context) error {
 	} else {
 		// For ignored formats, use the original extension instead of the configured format
 		formatToUse := filePlugin.ImageFormat
-		if filePlugin.ImageFormatToIgnore != "" && record.Extension != nil {
-			ignoreFormats := strings.Split(filePlugin.ImageFormatToIgnore, ",")
-			for _, ignoreFormat := range ignoreFormats {
-				ignoreFormat = strings.TrimSpace(ignoreFormat)
-				if strings.EqualFold(*record.Extension, ignoreFormat) {
-					formatToUse = *record.Extension
-					break
-				}
-			}
+		if record.Extension != nil && filePlugin.IsFormatIgnored(*record.Extension) {
+			formatToUse = *record.Extension
+		}
+		return filePlugin.GetImageStorage(&record).SendFileThroughHTTP(c, &record, style, formatToUse)
+	}
+}
+
+// Download - Send the original image as attachment with the original file name
+func (ctl *ImageController) Download(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"id": id,
+	}).Debug("ImageController.Download id from params")
+
+	record := ImageModel{}
+	err := requestImageFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
 		}
-		return storage.SendFileThroughHTTP(c, &record, style, formatToUse)
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	format := filePlugin.ImageFormat
+	if record.Extension != nil && filePlugin.IsFormatIgnored(*record.Extension) {
+		format = *record.Extension
 	}
+
+	return sendDownload(c, &downloadOptions{
+		Storage:      filePlugin.GetImageStorage(&record),
+		File:         &record,
+		Style:        "original",
+		Format:       format,
+		FileName:     getImageDownloadFileName(&record),
+		UseSignedURL: ctl.UseExternalImageURL,
+		Expires:      filePlugin.SignedURLExpiration,
+	})
 }
 
 func (ctl *ImageController) FindOneData(c echo.Context) error {
@@ -401,7 +648,7 @@ func (ctl *ImageController) FindOneData(c echo.Context) error {
 	}
 
 	record := ImageModel{}
-	err := ImageFindOne(id, &record)
+	err := requestImageFindOne(ctx, id, &record)
 	if err != nil {
 		return err
 	}
@@ -416,6 +663,11 @@ func (ctl *ImageController) FindOneData(c echo.Context) error {
 
 	record.LoadData()
 
+	err = checkRecordAccess(c, AccessActionFind, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
 	resp := ImageFindOneJSONResponse{
 		Record: &record,
 	}
@@ -432,6 +684,10 @@ func (ctl *ImageController) UploadFile(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
+	if isMultipleUpload(c, "images") {
+		return ctl.UploadFiles(c)
+	}
+
 	// file upload settings:
 	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
 
@@ -445,6 +701,11 @@ func (ctl *ImageController) UploadFile(c echo.Context) error {
 		return err
 	}
 
+	expiresAt, err := parseExpiresAt(c.FormValue("expiresAt"))
+	if err != nil {
+		return err
+	}
+
 	err = files_helpers.CopyRequestFileToTMP(ctx, "image", tmpFilePath)
 	if err != nil {
 		return err
@@ -452,8 +713,20 @@ func (ctl *ImageController) UploadFile(c echo.Context) error {
 
 	defer os.Remove(tmpFilePath)
 
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
 	newFile := NewImageModel()
-	err = UploadImageFromLocalhost(file.Filename, c.FormValue("description"), tmpFilePath, filePlugin.ImageStorageName, newFile, ctl.App)
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadImageFromLocalhost(file.Filename, c.FormValue("description"), tmpFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctl.App)
 	if err != nil {
 		return err
 	}
@@ -463,53 +736,505 @@ func (ctl *ImageController) UploadFile(c echo.Context) error {
 		return err
 	}
 
+	triggerImageAfterUpload(ctx, newFile)
+
 	return c.JSON(http.StatusOK, &ImageFindOneJSONResponse{Record: newFile})
 }
 
-func (ctl *ImageController) Delete(c echo.Context) error {
-	app := ctl.App
-
-	id := c.Param("id")
+// Import - Download one image from the url in body and save it, the source url is saved in the extra data
+func (ctl *ImageController) Import(c echo.Context) error {
 	ctx := c.(*bolo.RequestContext)
 
-	can := ctx.Can("delete_image")
+	can := ctx.Can("create_image")
 	if !can {
 		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
 	}
 
-	record := ImageModel{}
-	err := ImageFindOne(id, &record)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := RemoteImportRequest{}
+	err := c.Bind(&body)
+	if err != nil || body.URL == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "url is required")
+	}
+
+	expiresAt, err := parseExpiresAt(body.ExpiresAt)
 	if err != nil {
 		return err
 	}
 
-	err, _ = app.GetEvents().Trigger("image-delete", map[string]any{
-		"echoContext": c,
-		"record":      &record,
-	})
+	logrus.WithFields(logrus.Fields{
+		"url": body.URL,
+	}).Debug("ImageController.Import importing remote image")
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+	defer os.Remove(tmpFilePath)
 
+	remoteFile, err := DownloadRemoteFile(c.Request().Context(), &filePlugin.RemoteImport, body.URL, tmpFilePath)
 	if err != nil {
-		return &bolo.HTTPError{
-			Code:     http.StatusInternalServerError,
-			Message:  "error on delete image event",
-			Internal: err,
-		}
+		logrus.WithFields(logrus.Fields{
+			"url":   body.URL,
+			"error": err,
+		}).Debug("ImageController.Import error on download remote image")
+
+		return remoteImportHTTPError(err)
 	}
 
-	err = record.Delete()
+	if !isImageFile(tmpFilePath) {
+		return echo.NewHTTPError(http.StatusBadRequest, "remote file is not an image")
+	}
+
+	err = checkUploadQuota(ctx, tmpFilePath)
 	if err != nil {
 		return err
 	}
 
-	return c.NoContent(http.StatusNoContent)
+	newFile := NewImageModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.ExpiresAt = expiresAt
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = UploadImageFromLocalhost(remoteFile.FileName, body.Description, tmpFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctl.App)
+	if err != nil {
+		return err
+	}
+
+	newFile.Label = getOptionalString(body.Label)
+
+	err = newFile.SetExtraDataKey("sourceURL", body.URL)
+	if err != nil {
+		return err
+	}
+
+	err = newFile.Save()
+	if err != nil {
+		return err
+	}
+
+	newFile.LoadData()
+
+	triggerImageAfterUpload(ctx, newFile)
+
+	return c.JSON(http.StatusOK, &ImageFindOneJSONResponse{Record: newFile})
+}
+
+// UploadFiles - Upload many images sent in the images[] multipart field, with optional labels[] and
+// descriptions[] in same order. Returns one result for each image and associate the uploaded images
+// in one model field if modelName, modelId and field are set
+func (ctl *ImageController) UploadFiles(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("create_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	items, err := getMultipleUploadItems(c, "images", filePlugin.MaxUploadFiles)
+	if err != nil {
+		return err
+	}
+
+	association, err := getMultipleUploadAssociation(ctx)
+	if err != nil {
+		return err
+	}
+
+	expiresAt, err := parseExpiresAt(c.FormValue("expiresAt"))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"count": len(items),
+	}).Debug("ImageController.UploadFiles uploading images")
+
+	err = checkMultipleUploadQuota(ctx, items)
+	if err != nil {
+		return err
+	}
+
+	results := runMultipleUpload(c, filePlugin.UploadConcurrency, items, func(item *multipleUploadItem, tmpFilePath string) (uploadedRecord, *UploadItemError) {
+		newFile := NewImageModel()
+
+		newFile.CreatorID = getCreatorID(ctx)
+		newFile.ExpiresAt = expiresAt
+
+		var err error
+		newFile.TenantID, err = getTenantID(ctx)
+		if err != nil {
+			return nil, &UploadItemError{Code: "upload_failed", Message: err.Error()}
+		}
+
+		err = UploadImageFromLocalhost(item.file.Filename, item.description, tmpFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctl.App)
+		if err != nil {
+			return nil, &UploadItemError{Code: "upload_failed", Message: err.Error()}
+		}
+
+		newFile.Label = getOptionalString(item.label)
+
+		err = newFile.Save()
+		if err != nil {
+			return nil, &UploadItemError{Code: "save_failed", Message: err.Error()}
+		}
+
+		triggerImageAfterUpload(ctx, newFile)
+
+		return newFile, nil
+	})
+
+	resp := MultipleUploadJSONResponse{Results: results}
+
+	if association != nil {
+		cfg := NewImageFieldConfiguration(association.ModelName, association.Field)
+
+		err = AddImagesInFieldByIDs(association.ModelID, getUploadedIDs(results), cfg)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"modelName": association.ModelName,
+				"modelId":   association.ModelID,
+				"field":     association.Field,
+				"error":     err,
+			}).Error("ImageController.UploadFiles error on associate images")
+
+			resp.AssociationError = &UploadItemError{Code: "association_failed", Message: err.Error()}
+		}
+	}
+
+	return c.JSON(http.StatusOK, &resp)
+}
+
+// Delete - Move one image to trash or delete it permanently with the ?permanent=true query param
+func (ctl *ImageController) Delete(c echo.Context) error {
+	app := ctl.App
+
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+	permanent := c.QueryParam("permanent") == "true"
+
+	can := ctx.Can("delete_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record := ImageModel{}
+	err := requestImageFindOne(ctx, id, &record)
+	if err != nil && permanent && errors.Is(err, gorm.ErrRecordNotFound) {
+		// trashed records can only be deleted permanently
+		err = requestTrashedImageFindOne(ctx, id, &record)
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionDelete, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	err, _ = app.GetEvents().Trigger("image-delete", map[string]any{
+		"echoContext": c,
+		"record":      &record,
+	})
+
+	if err != nil {
+		return &bolo.HTTPError{
+			Code:     http.StatusInternalServerError,
+			Message:  "error on delete image event",
+			Internal: err,
+		}
+	}
+
+	if !permanent {
+		err = trashImageRecord(ctx, &record)
+		if err != nil {
+			return err
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	err = destroyImageRecord(app, ctx, &record)
+	if err != nil {
+		var destroyErr *DestroyError
+		if errors.As(err, &destroyErr) {
+			return &bolo.HTTPError{
+				Code: http.StatusInternalServerError,
+				Message: map[string]any{
+					"message":  "error on delete stored image, try again",
+					"failures": destroyErr.GetFailureMessages(),
+				},
+				Internal: err,
+			}
+		}
+
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ctl *ImageController) QueryTrash(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	db := ctl.App.GetDB()
+
+	var count int64
+	records := make([]*ImageModel, 0)
+
+	query, err := scopeQueryByTenant(ctx, db.Unscoped().Where("deletedAt IS NOT NULL").Scopes(NotExpiredScope("images")))
+	if err != nil {
+		return err
+	}
+
+	query, err = scopeQueryByAccessPolicy(ctx, AccessRecordTypeImage, query)
+	if err != nil {
+		return err
+	}
+
+	err = query.
+		Order("deletedAt DESC").
+		Order("id DESC").
+		Limit(ctx.GetLimit()).
+		Offset(ctx.GetOffset()).
+		Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	err = query.Model(&ImageModel{}).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	for i := range records {
+		records[i].LoadData()
+	}
+
+	resp := ImageListJSONResponse{
+		Records: &records,
+	}
+
+	resp.Meta.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+func (ctl *ImageController) Restore(c echo.Context) error {
+	id := c.Param("id")
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record := ImageModel{}
+	err := requestTrashedImageFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, AccessActionDelete, record.GetAccessRecord())
+	if err != nil {
+		return err
+	}
+
+	err = record.Restore()
+	if err != nil {
+		return err
+	}
+
+	record.LoadData()
+
+	return c.JSON(http.StatusOK, &ImageFindOneJSONResponse{Record: &record})
+}
+
+// findRequestImage - Find the :id image and check the request access to run the action in it
+func findRequestImage(c echo.Context, action AccessAction) (*ImageModel, error) {
+	ctx := c.(*bolo.RequestContext)
+
+	record := ImageModel{}
+	err := requestImageFindOne(ctx, c.Param("id"), &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NotFoundHandler(c)
+		}
+		return nil, err
+	}
+
+	record.LoadData()
+
+	err = checkRecordAccess(c, action, record.GetAccessRecord())
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Replace - Replace the image contents with the uploaded "image", the image id, name and original url don't
+// change, the styles are generated again and the previous contents are kept as one revision
+func (ctl *ImageController) Replace(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestImage(c, AccessActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	file, err := c.FormFile("image")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "image is required")
+	}
+
+	tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+
+	err = files_helpers.CopyRequestFileToTMP(ctx, "image", tmpFilePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFilePath)
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	revision, err := ReplaceImageContents(ctx, record, file.Filename, tmpFilePath)
+	if err != nil {
+		if errors.Is(err, ErrReplaceFormatMismatch) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &ImageReplaceJSONResponse{Record: record, Revision: revision})
+}
+
+// QueryRevisions - List the previous contents of one image
+func (ctl *ImageController) QueryRevisions(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestImage(c, AccessActionFind)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := GetRecordRevisions(ctl.App.GetDB(), AccessRecordTypeImage, record.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &RevisionListJSONResponse{Records: revisions})
+}
+
+// DownloadRevision - Send the :number revision original as attachment
+func (ctl *ImageController) DownloadRevision(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestImage(c, AccessActionFind)
+	if err != nil {
+		return err
+	}
+
+	revision, err := GetRecordRevision(ctl.App.GetDB(), AccessRecordTypeImage, record.ID, c.Param("number"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	return sendDownload(c, &downloadOptions{
+		Storage:      getRevisionStorage(filePlugin, revision, filePlugin.GetImageStorage(record)),
+		File:         record,
+		Style:        revision.GetStyle(),
+		Format:       getImageStoredFormat(filePlugin, record),
+		FileName:     getDownloadFileNameWithExtension(revision.Originalname, revision.Extension),
+		UseSignedURL: ctl.UseExternalImageURL,
+		Expires:      filePlugin.SignedURLExpiration,
+	})
+}
+
+// RestoreRevision - Replace the image contents with the :number revision, the current contents are kept as
+// one new revision
+func (ctl *ImageController) RestoreRevision(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_image")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestImage(c, AccessActionUpdate)
+	if err != nil {
+		return err
+	}
+
+	revision, err := GetRecordRevision(ctl.App.GetDB(), AccessRecordTypeImage, record.ID, c.Param("number"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NotFoundHandler(c)
+		}
+		return err
+	}
+
+	err = quotaHTTPError(CheckUploadQuota(ctx, revision.Size))
+	if err != nil {
+		return err
+	}
+
+	previous, err := RestoreImageRevision(ctx, record, revision)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &ImageReplaceJSONResponse{Record: record, Revision: previous})
 }
 
 func (ctl *ImageController) ResetImageStyles(c echo.Context) error {
 	id := c.Param("id")
 	ctx := c.(*bolo.RequestContext)
 	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
-	storageName := filePlugin.ImageStorageName
-	storage := filePlugin.GetStorage(storageName)
 	styles := filePlugin.ImageStyles
 
 	can := ctx.Can("find_image")
@@ -522,7 +1247,7 @@ func (ctl *ImageController) ResetImageStyles(c echo.Context) error {
 	}).Debug("ImageController.ResetImageStyles id from params")
 
 	record := ImageModel{}
-	err := ImageFindOne(id, &record)
+	err := requestImageFindOne(ctx, id, &record)
 	if err != nil {
 		return err
 	}
@@ -536,6 +1261,7 @@ func (ctl *ImageController) ResetImageStyles(c echo.Context) error {
 	}
 
 	record.LoadData()
+	storage := filePlugin.GetImageStorage(&record)
 
 	for style, _ := range record.URLs {
 		if style == "original" || style == "" {
@@ -548,6 +1274,7 @@ func (ctl *ImageController) ResetImageStyles(c echo.Context) error {
 		}
 
 		delete(record.URLs, style)
+		record.RemoveStyleSize(style)
 	}
 
 	err = record.ResetURLs(ctl.App)
@@ -555,14 +1282,13 @@ func (ctl *ImageController) ResetImageStyles(c echo.Context) error {
 		return err
 	}
 
-	baseURL := BuidFileBaseURL(ctl.App)
 	urls := record.URLs
 
 	for style, _ := range styles {
 		if style == "original" {
 			continue
 		}
-		urls[style] = baseURL + "/api/v1/image/" + style + "/" + record.Name
+		urls[style] = GetPendingStyleURL(ctl.App, &record, style)
 	}
 
 	err = record.SetURLs(urls)
@@ -4,13 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-bolo/bolo"
-	"github.com/go-bolo/bolo/database"
 	"github.com/go-bolo/bolo/helpers"
 	files_database "github.com/go-bolo/files/database"
 	"github.com/labstack/echo/v4"
@@ -19,7 +17,6 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 func NewImageModel() *ImageModel {
@@ -35,6 +32,7 @@ type ImageModel struct {
 	Description    *string `gorm:"column:description;type:text" json:"description" filter:"param:description;type:string"`
 	Name           string  `gorm:"unique;column:name;type:varchar(255);not null" json:"name" filter:"param:name;type:string"`
 	Size           *int64  `gorm:"column:size;" json:"size" filter:"param:size;type:number"`
+	Checksum       string  `gorm:"column:checksum;type:varchar(64)" json:"checksum"`
 	Encoding       string  `gorm:"column:encoding;type:varchar(255)" json:"encoding" filter:"param:encoding;type:string"`
 	Active         bool    `gorm:"column:active;type:tinyint(1);default:1" json:"active" filter:"param:active;type:boolean"`
 	Originalname   string  `gorm:"column:originalname;type:varchar(255)" json:"originalname" filter:"param:originalname;type:string"`
@@ -43,14 +41,28 @@ type ImageModel struct {
 	StorageName    string  `gorm:"column:storageName;type:varchar(255)" json:"storageName" filter:"param:storageName;type:string"`
 	IsLocalStorage bool    `gorm:"column:isLocalStorage;type:tinyint(1);default:1" json:"isLocalStorage" filter:"param:isLocalStorage;type:boolean"`
 	// URLsRaw        database.JSONField `gorm:"column:urls;type:blob;not null" json:"-"`
-	ExtraDataRaw database.JSONField `gorm:"column:extraData;type:blob" json:"-"`
-	CreatedAt    time.Time          `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
-	UpdatedAt    time.Time          `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
-	CreatorID    *int64             `gorm:"index:creatorId;column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
+	ExtraDataRaw files_database.JSONField `gorm:"column:extraData;type:blob" json:"-"`
+	CreatedAt    time.Time                `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
+	UpdatedAt    time.Time                `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
+	DeletedAt    gorm.DeletedAt           `gorm:"column:deletedAt;index" json:"deletedAt"`
+	CreatorID    *int64                   `gorm:"index:creatorId;column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
 	// Users          []User    `gorm:"joinForeignKey:creatorId;foreignKey:id" json:"usersList"`
 
-	URLs      files_database.ImageURLsField `gorm:"column:urls;type:blob;not null" json:"urls"`
-	ExtraData *ImageExtraData               `gorm:"-" json:"extraData"`
+	URLs files_database.ImageURLsField `gorm:"column:urls;type:blob;not null" json:"urls"`
+	// Fingerprint of the style configuration used to generate each style
+	StyleVersions files_database.ImageURLsField `gorm:"column:styleVersions;type:blob" json:"styleVersions"`
+	// Size of each generated style, StylesSize is the sum used in storage quotas
+	StyleSizes files_database.StyleSizesField `gorm:"column:styleSizes;type:blob" json:"-"`
+	StylesSize int64                          `gorm:"column:stylesSize;not null;default:0" json:"-"`
+	TenantID   string                         `gorm:"column:tenantId;type:varchar(100);not null;default:''" json:"-"`
+	FolderID   *uint64                        `gorm:"column:folderId;index" json:"folderId" filter:"param:folderId;type:number"`
+	// Expired records are hidden and deleted by the expiration purge job, nil doesn't expire
+	ExpiresAt *time.Time `gorm:"column:expiresAt;type:datetime;index" json:"expiresAt"`
+	// Dimensions of the stored original, 0 for images uploaded before they were saved
+	Width     int             `gorm:"column:width;not null;default:0" json:"width" filter:"param:width;type:number"`
+	Height    int             `gorm:"column:height;not null;default:0" json:"height" filter:"param:height;type:number"`
+	ExtraData *ImageExtraData `gorm:"-" json:"extraData"`
+	Tags      []*TagModel     `gorm:"-" json:"tags,omitempty"`
 
 	LinkPermanent string `gorm:"-" json:"linkPermanent"`
 }
@@ -75,6 +87,16 @@ func (m *ImageModel) GetIDString() string {
 	return strconv.FormatInt(int64(m.ID), 10)
 }
 
+// GetTenantID - Tenant of the record, empty without tenant
+func (m *ImageModel) GetTenantID() string {
+	return m.TenantID
+}
+
+// GetAccessRecord - Get the data used by access policies
+func (m *ImageModel) GetAccessRecord() *AccessRecord {
+	return &AccessRecord{Type: AccessRecordTypeImage, ID: m.ID, CreatorID: m.CreatorID, FolderID: m.FolderID}
+}
+
 func (m *ImageModel) GetUrl(style string) string {
 	if v, ok := m.URLs[style]; ok {
 		return v
@@ -137,6 +159,11 @@ func (m *ImageModel) Save() error {
 		}
 	}
 
+	err = IndexImageSearch(db, m)
+	if err != nil {
+		return errors.Wrap(err, "ImageModel.Save error on index search")
+	}
+
 	return nil
 }
 
@@ -145,6 +172,44 @@ func (m *ImageModel) LoadData() error {
 	return nil
 }
 
+// SetStyleSize - Set the stored size of one generated style and update the styles total
+func (m *ImageModel) SetStyleSize(style string, size int64) {
+	if m.StyleSizes == nil {
+		m.StyleSizes = files_database.StyleSizesField{}
+	}
+
+	m.StyleSizes[style] = size
+	m.StylesSize = m.StyleSizes.Total()
+}
+
+// RemoveStyleSize - Remove the size of one style deleted from storage
+func (m *ImageModel) RemoveStyleSize(style string) {
+	delete(m.StyleSizes, style)
+	m.StylesSize = m.StyleSizes.Total()
+}
+
+// SetExtraDataKey - Set one extra data key, saved with the record
+func (m *ImageModel) SetExtraDataKey(key, value string) error {
+	if m.ExtraData == nil {
+		m.ExtraData = &ImageExtraData{}
+	}
+
+	if m.ExtraData.Keys == nil {
+		m.ExtraData.Keys = map[string]string{}
+	}
+
+	m.ExtraData.Keys[key] = value
+
+	raw, err := json.Marshal(m.ExtraData)
+	if err != nil {
+		return err
+	}
+
+	m.ExtraDataRaw = raw
+
+	return nil
+}
+
 func (m *ImageModel) LoadTeaser() error {
 	return nil
 }
@@ -166,7 +231,6 @@ func (m *ImageModel) ResetURLs(app bolo.App) error {
 	filePlugin := app.GetPlugin("files").(*FilePlugin)
 	storage := filePlugin.GetStorage(m.StorageName)
 	styles := filePlugin.ImageStyles
-	baseURL := BuidFileBaseURL(app)
 
 	urls := m.URLs
 	if urls == nil {
@@ -179,8 +243,7 @@ func (m *ImageModel) ResetURLs(app bolo.App) error {
 			continue
 		}
 
-		urls[style] = baseURL + "/api/v1/image/" + style + "/" + m.Name
-
+		urls[style] = GetPendingStyleURL(app, m, style)
 	}
 
 	m.SetURLs(urls)
@@ -188,14 +251,40 @@ func (m *ImageModel) ResetURLs(app bolo.App) error {
 	return nil
 }
 
+// Delete - Move the image to trash, use Destroy to remove it permanently
 func (m *ImageModel) Delete() error {
 	db := bolo.GetDefaultDatabaseConnection()
-	return db.Unscoped().Delete(&m).Error
+	return db.Delete(m).Error
 }
 
-// FindOne - Find one Image record by id
-func ImageFindOne(id string, record *ImageModel) error {
+// Restore - Restore one image from trash
+func (m *ImageModel) Restore() error {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	err := db.Unscoped().Model(m).Update("deletedAt", nil).Error
+	if err != nil {
+		return err
+	}
+
+	m.DeletedAt = gorm.DeletedAt{}
+
+	return nil
+}
+
+// Destroy - Delete the image record from database, including the trashed ones
+func (m *ImageModel) Destroy() error {
 	db := bolo.GetDefaultDatabaseConnection()
+	return db.Unscoped().Delete(m).Error
+}
+
+// IsTrashed - Check if the image is in trash
+func (m *ImageModel) IsTrashed() bool {
+	return m.DeletedAt.Valid
+}
+
+// FindOne - Find one Image record by id
+func ImageFindOne(id string, record *ImageModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
 
 	name := id
 
@@ -215,6 +304,17 @@ func ImageFindOne(id string, record *ImageModel) error {
 	}
 }
 
+// TrashedImageFindOne - Find one image record in trash by id
+func TrashedImageFindOne(id string, record *ImageModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
+
+	return db.
+		Unscoped().
+		Where("deletedAt IS NOT NULL").
+		Where("id = ? OR name = ?", id, id).
+		First(record).Error
+}
+
 // Query / findMany image records
 func Query(records *[]ImageModel, limit int) error {
 	db := bolo.GetDefaultDatabaseConnection()
@@ -254,6 +354,8 @@ func GetImagesInField(modelName, fieldName, modelID string, limit int) ([]*Image
 			fieldName,
 			modelID,
 		).
+		Where("images.deletedAt IS NULL").
+		Scopes(NotExpiredScope("images")).
 		Scan(&images).Error; err != nil {
 		return nil, err
 	}
@@ -288,6 +390,8 @@ func GetImagesInRecord(modelName string, modelID string) ([]ImageModel, error) {
 			modelID,
 		).
 		// Where("WHERE i2.modelName = "company" AND i2.field = "logo" AND modelId = "7"")
+		Where("images.deletedAt IS NULL").
+		Scopes(NotExpiredScope("images")).
 		Scan(&images).Error; err != nil {
 		return nil, err
 	}
@@ -317,6 +421,7 @@ func ImageFindManyInRecord(modelName, fieldName, modelId string, target *[]Image
 			A.modelName = ? AND
 			A.modelId = ? AND
 			A.imageId = images.id`, fieldName, modelName, modelId).
+		Scopes(NotExpiredScope("images")).
 		Order("'order' ASC").
 		Find(&target).Error
 	if err != nil {
@@ -326,10 +431,11 @@ func ImageFindManyInRecord(modelName, fieldName, modelId string, target *[]Image
 	return nil
 }
 
-func ImageFindManyByIds(imageIds []string, records *[]ImageModel) error {
-	db := bolo.GetDefaultDatabaseConnection()
+func ImageFindManyByIds(imageIds []string, records *[]ImageModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
 
 	err := db.Where("id IN ?", imageIds).
+		Scopes(NotExpiredScope("images")).
 		Find(records).Error
 	if err != nil {
 		return err
@@ -341,6 +447,8 @@ func ImageFindManyByIds(imageIds []string, records *[]ImageModel) error {
 type ImageQueryOpts struct {
 	Records *[]*ImageModel
 	Count   *int64
+	// Optional, set with the cursors of the pages around the loaded page
+	Cursors *QueryCursors
 	Limit   int
 	Offset  int
 	C       echo.Context
@@ -348,88 +456,127 @@ type ImageQueryOpts struct {
 }
 
 func ImageQueryAndCountReq(opts *ImageQueryOpts) error {
-	db := bolo.GetDefaultDatabaseConnection()
-	c := opts.C
-	q := c.QueryParam("q")
-	seletor := c.QueryParam("seletor")
-	query := db
-	ctx := c.(*bolo.RequestContext)
+	ctx := opts.C.(*bolo.RequestContext)
 
-	queryI, err := ctx.Query.SetDatabaseQueryForModel(query, &ImageModel{})
+	page, err := getQueryPage(ctx, &ImageModel{}, opts.Limit, opts.Offset)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"error": fmt.Sprintf("%+v\n", err),
-		}).Error("ImageQueryAndCountReq error")
+		return err
 	}
-	query = queryI.(*gorm.DB)
 
-	if q != "" {
-		query = query.Where(
-			db.Where("name LIKE ?", "%"+q+"%").
-				Or(db.Where("label LIKE ?", "%"+q+"%")).
-				Or(db.Where("description LIKE ?", "%"+q+"%")),
-		)
+	// search results are ordered by relevance in lists without order and cursor
+	query, err := imageFilterQuery(ctx, page.Rank)
+	if err != nil {
+		return err
 	}
 
-	if seletor == "owner" {
-		if !ctx.IsAuthenticated {
-			return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
-		}
+	query, err = page.Apply(query)
+	if err != nil {
+		return err
+	}
 
-		query = query.Where("creatorId LIKE ?", ctx.AuthenticatedUser.GetID())
+	r := query.Find(opts.Records)
+	if r.Error != nil {
+		return r.Error
 	}
 
-	orderColumn, orderIsDesc, orderValid := helpers.ParseUrlQueryOrder(c.QueryParam("order"), c.QueryParam("sort"), c.QueryParam("sortDirection"))
+	err = ImageCountReq(opts)
+	if err != nil {
+		return err
+	}
 
-	if orderValid {
-		query = query.Order(clause.OrderByColumn{
-			Column: clause.Column{Table: clause.CurrentTable, Name: orderColumn},
-			Desc:   orderIsDesc,
-		})
-	} else {
-		query = query.
-			Order("createdAt DESC").
-			Order("id DESC")
+	cursors := finishQueryPage(page, opts.Records, *opts.Count)
+	if opts.Cursors != nil {
+		*opts.Cursors = *cursors
 	}
 
-	query = query.Limit(opts.Limit).
-		Offset(opts.Offset)
+	return nil
+}
 
-	r := query.Find(opts.Records)
-	if r.Error != nil {
-		return r.Error
+func ImageCountReq(opts *ImageQueryOpts) error {
+	queryCount, err := imageCountQuery(opts)
+	if err != nil {
+		return err
 	}
 
-	return ImageCountReq(opts)
+	return queryCount.Count(opts.Count).Error
 }
 
-func ImageCountReq(opts *ImageQueryOpts) error {
-	db := bolo.GetDefaultDatabaseConnection()
-	c := opts.C
-	q := c.QueryParam("q")
-	ctx := c.(*bolo.RequestContext)
-	// Count ...
-	queryCount := db
+// ImageFacetsReq - Count the images with the request filters by the facets requested with ?facets=
+func ImageFacetsReq(opts *ImageQueryOpts) (map[string][]*FacetValue, error) {
+	ctx := opts.C.(*bolo.RequestContext)
 
-	if q != "" {
-		queryCount = queryCount.Or(
-			db.Where("label LIKE ?", "%"+q+"%"),
-			db.Where("name LIKE ?", "%"+q+"%"),
-			db.Where("description LIKE ?", "%"+q+"%"),
-		)
+	facets := getRequestedFacets(ctx, AccessRecordTypeImage)
+	if len(facets) == 0 {
+		return nil, nil
+	}
+
+	query, err := imageCountQuery(opts)
+	if err != nil {
+		return nil, err
 	}
 
-	queryICount, err := ctx.Query.SetDatabaseQueryForModel(queryCount, &ImageModel{})
+	return getFacets(query, &ImageModel{}, AccessRecordTypeImage, facets)
+}
+
+// imageCountQuery - Build the images count query with the request filters, without pagination
+func imageCountQuery(opts *ImageQueryOpts) (*gorm.DB, error) {
+	queryCount, err := imageFilterQuery(opts.C.(*bolo.RequestContext), false)
+	if err != nil {
+		return nil, err
+	}
+
+	// the query parser sets one limit with filter params, counts are not paginated
+	return queryCount.
+		Model(&ImageModel{}).
+		Limit(-1).
+		Offset(-1), nil
+}
+
+// imageFilterQuery - Build the images query with the request filters and search, used in lists and counts so
+// counts match the results
+func imageFilterQuery(ctx *bolo.RequestContext, rank bool) (*gorm.DB, error) {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	queryI, err := ctx.Query.SetDatabaseQueryForModel(db, &ImageModel{})
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": fmt.Sprintf("%+v\n", err),
-		}).Error("ImageCountReq count error")
+		}).Error("imageFilterQuery error")
 	}
-	queryCount = queryICount.(*gorm.DB)
+	query := queryI.(*gorm.DB)
 
-	return queryCount.
-		Table("images").
-		Count(opts.Count).Error
+	query, err = scopeQueryByTenant(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = scopeQueryByAccessPolicy(ctx, AccessRecordTypeImage, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = applyOwnerSelector(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err = applyFolderSelector(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = scopeQueryByFolderVisibility(ctx, query)
+
+	query, err = applyTagSelector(ctx, AccessRecordTypeImage, query)
+	if err != nil {
+		return nil, err
+	}
+
+	query = applyOrientationSelector(ctx, query)
+
+	query = query.Scopes(NotExpiredScope("images"))
+
+	return applySearch(ctx, AccessRecordTypeImage, "images", query, rank), nil
 }
 
 func UpdateFieldImagesByObjects(ctx *bolo.RequestContext, modelId string, images []*ImageModel, cfg FieldConfigurationInterface) error {
@@ -493,13 +640,14 @@ func UpdateFieldImagesById(ctx *bolo.RequestContext, modelId string, imageIds []
 	}
 
 	// delete old items
-	err = RemoveImagesFromFieldByIds(modelId, itemsToDelete, cfg)
+	removed, err := removeImagesFromFieldByIds(modelId, itemsToDelete, cfg)
 	if err != nil {
 		return errors.Wrap(err, "UpdateFieldImagesById error on delete images")
 	}
 
 	// create not existent images and associate
-	err = AddImagesInFieldByIDs(modelId, itemsToAdd, cfg)
+	added, err := addImagesInFieldByIDs(modelId, itemsToAdd, cfg)
+	triggerAssociationChanged(AccessRecordTypeImage, modelId, cfg, added, removed)
 	if err != nil {
 		return errors.Wrap(err, "UpdateFieldImagesById error on add new assocs")
 	}
@@ -509,8 +657,15 @@ func UpdateFieldImagesById(ctx *bolo.RequestContext, modelId string, imageIds []
 
 // Add many images in model field using imageId
 func AddImagesInFieldByIDs(modelId string, imageIds []string, cfg FieldConfigurationInterface) error {
+	added, err := addImagesInFieldByIDs(modelId, imageIds, cfg)
+	triggerAssociationChanged(AccessRecordTypeImage, modelId, cfg, added, nil)
+	return err
+}
+
+// addImagesInFieldByIDs - Associate the images without the association changed event, returns the added ids
+func addImagesInFieldByIDs(modelId string, imageIds []string, cfg FieldConfigurationInterface) ([]uint64, error) {
 	if len(imageIds) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	db := bolo.GetDefaultDatabaseConnection()
@@ -519,7 +674,7 @@ func AddImagesInFieldByIDs(modelId string, imageIds []string, cfg FieldConfigura
 
 	err := ImageFindManyByIds(imageIds, &images)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// create assocs
@@ -550,16 +705,29 @@ func AddImagesInFieldByIDs(modelId string, imageIds []string, cfg FieldConfigura
 	if len(assocsToCreate) > 0 {
 		err = db.Create(&assocsToCreate).Error
 		if err != nil {
-			return errors.Wrap(err, "AddImagesInFieldById error on create assocs")
+			return nil, errors.Wrap(err, "AddImagesInFieldById error on create assocs")
 		}
 	}
 
-	return nil
+	added := []uint64{}
+	for i := range assocsToCreate {
+		added = append(added, uint64(assocsToCreate[i].ImageID))
+	}
+
+	return added, nil
 }
 
 func RemoveImagesFromFieldByIds(modelId string, imageIds []string, cfg FieldConfigurationInterface) error {
+	removed, err := removeImagesFromFieldByIds(modelId, imageIds, cfg)
+	triggerAssociationChanged(AccessRecordTypeImage, modelId, cfg, nil, removed)
+	return err
+}
+
+// removeImagesFromFieldByIds - Remove the images from the field without the association changed event,
+// returns the removed ids
+func removeImagesFromFieldByIds(modelId string, imageIds []string, cfg FieldConfigurationInterface) ([]uint64, error) {
 	if len(imageIds) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	db := bolo.GetDefaultDatabaseConnection()
@@ -572,7 +740,7 @@ func RemoveImagesFromFieldByIds(modelId string, imageIds []string, cfg FieldConf
 		Select("id").
 		Find(&imagesWithIds).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	ids := []string{}
@@ -582,22 +750,27 @@ func RemoveImagesFromFieldByIds(modelId string, imageIds []string, cfg FieldConf
 
 	err = db.
 		Where("modelName = ? AND field = ? AND modelId = ? AND imageId IN ?", cfg.GetModelName(), cfg.GetFieldName(), modelId, ids).
-		Select("id AS id").
+		Select("id", "imageId").
 		Find(&assocs).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if len(assocs) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	r := db.
 		Delete(&assocs)
 
 	if r.Error != nil {
-		return r.Error
+		return nil, r.Error
 	}
 
-	return nil
+	removed := []uint64{}
+	for i := range assocs {
+		removed = append(removed, uint64(assocs[i].ImageID))
+	}
+
+	return removed, nil
 }
@@ -0,0 +1,254 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type GCJSONResponse struct {
+	Report *GCReport `json:"report"`
+}
+
+type StorageMigrationJSONResponse struct {
+	Report *StorageMigrationReport `json:"report"`
+}
+
+type RegenerateStylesJSONResponse struct {
+	Report *RegenerateStylesReport `json:"report"`
+}
+
+type OwnershipTransferJSONResponse struct {
+	Result *OwnershipTransferResult `json:"result"`
+}
+
+func NewMaintenanceController(cfgs *MaintenanceControllerConfiguration) *MaintenanceController {
+	return &MaintenanceController{App: cfgs.App}
+}
+
+type MaintenanceControllerConfiguration struct {
+	App bolo.App
+}
+
+// MaintenanceController - Storage and database maintenance tasks, all actions require the manage_files permission
+type MaintenanceController struct {
+	App bolo.App
+
+	mu sync.Mutex
+	// last or current storage migration
+	storageMigration *StorageMigrationReport
+	// last or current image styles regeneration
+	stylesRegeneration *RegenerateStylesReport
+}
+
+// GC - Run the garbage collector, runs in dry run mode unless called with ?dryRun=false
+func (ctl *MaintenanceController) GC(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	opts := GCOptions{
+		DryRun: c.QueryParam("dryRun") != "false",
+	}
+
+	if minAge := c.QueryParam("minAge"); minAge != "" {
+		d, err := time.ParseDuration(minAge)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid minAge")
+		}
+		opts.UnassociatedMinAge = d
+	}
+
+	if batchSize := c.QueryParam("batchSize"); batchSize != "" {
+		n, err := strconv.Atoi(batchSize)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid batchSize")
+		}
+		opts.BatchSize = n
+	}
+
+	report, err := RunGC(c.Request().Context(), ctl.App, &opts)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("MaintenanceController.GC error on run gc")
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &GCJSONResponse{Report: report})
+}
+
+// MigrateStorage - Start one storage migration in background, only one migration can run at same time
+func (ctl *MaintenanceController) MigrateStorage(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	opts := StorageMigrationOptions{}
+	err := c.Bind(&opts)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	if opts.From == "" || opts.To == "" || opts.From == opts.To {
+		return echo.NewHTTPError(http.StatusBadRequest, "from and to should be different storage names")
+	}
+
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+
+	if ctl.storageMigration != nil && ctl.storageMigration.isRunning() {
+		return echo.NewHTTPError(http.StatusConflict, "one storage migration is already running")
+	}
+
+	opts.Report = &StorageMigrationReport{Running: true}
+	ctl.storageMigration = opts.Report
+
+	go func() {
+		_, err := MigrateStorage(context.Background(), ctl.App, &opts)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"from":  opts.From,
+				"to":    opts.To,
+				"error": err,
+			}).Error("MaintenanceController.MigrateStorage error on migrate storage")
+		}
+	}()
+
+	return c.JSON(http.StatusAccepted, &StorageMigrationJSONResponse{Report: opts.Report})
+}
+
+// MigrateStorageStatus - Get the progress of the last storage migration
+func (ctl *MaintenanceController) MigrateStorageStatus(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	ctl.mu.Lock()
+	report := ctl.storageMigration
+	ctl.mu.Unlock()
+
+	if report == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no storage migration found")
+	}
+
+	return c.JSON(http.StatusOK, &StorageMigrationJSONResponse{Report: report})
+}
+
+// RegenerateStyles - Start one image styles regeneration in background, only one regeneration can run at same time
+func (ctl *MaintenanceController) RegenerateStyles(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	opts := RegenerateStylesOptions{}
+	err := c.Bind(&opts)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+	for _, style := range opts.Styles {
+		if _, ok := filePlugin.ImageStyles[style]; !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid image style "+style)
+		}
+	}
+
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+
+	if ctl.stylesRegeneration != nil && ctl.stylesRegeneration.isRunning() {
+		return echo.NewHTTPError(http.StatusConflict, "one image styles regeneration is already running")
+	}
+
+	opts.Report = &RegenerateStylesReport{Running: true, LastID: opts.AfterID}
+	ctl.stylesRegeneration = opts.Report
+
+	go func() {
+		_, err := RegenerateStyles(context.Background(), ctl.App, &opts)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("MaintenanceController.RegenerateStyles error on regenerate styles")
+		}
+	}()
+
+	return c.JSON(http.StatusAccepted, &RegenerateStylesJSONResponse{Report: opts.Report})
+}
+
+// RegenerateStylesStatus - Get the progress of the last image styles regeneration
+func (ctl *MaintenanceController) RegenerateStylesStatus(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	ctl.mu.Lock()
+	report := ctl.stylesRegeneration
+	ctl.mu.Unlock()
+
+	if report == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "no image styles regeneration found")
+	}
+
+	return c.JSON(http.StatusOK, &RegenerateStylesJSONResponse{Report: report})
+}
+
+// TransferOwnership - Move files and images of the request tenant to other user with body
+// {"fromUserId": "1", "toUserId": "2", "fileIds": [], "imageIds": []}
+func (ctl *MaintenanceController) TransferOwnership(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("manage_files")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	opts := OwnershipTransferOptions{}
+	if err := c.Bind(&opts); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	tenantScope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	result, err := TransferOwnership(ctl.App, &opts, tenantScope)
+	if err != nil {
+		if errors.Is(err, ErrOwnershipTransferInvalidUser) || errors.Is(err, ErrOwnershipTransferNoFilter) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"from":   opts.FromUserID,
+		"to":     opts.ToUserID,
+		"files":  result.Files,
+		"images": result.Images,
+	}).Info("MaintenanceController.TransferOwnership done")
+
+	return c.JSON(http.StatusOK, &OwnershipTransferJSONResponse{Result: result})
+}
@@ -1,6 +1,9 @@
 package files
 
 import (
+	"context"
+	"io"
+
 	files_dtos "github.com/go-bolo/files/dtos"
 	"github.com/labstack/echo/v4"
 )
@@ -15,3 +18,27 @@ type Storager interface {
 	FileName(file files_dtos.FileDTO) (string, error)
 	DeleteImageStyle(file files_dtos.FileDTO, style string, format string) error
 }
+
+// ObjectStorager is implemented by storages that can manage stored objects by path,
+// required for maintenance tasks like the garbage collector
+type ObjectStorager interface {
+	ListObjects(ctx context.Context, fn func(obj files_dtos.StoredObject) error) error
+	DeleteObject(ctx context.Context, objectPath string) error
+	// StatObject returns files_dtos.ErrObjectNotFound if the object doesn't exist
+	StatObject(ctx context.Context, objectPath string) (*files_dtos.StoredObject, error)
+	// OpenObject returns files_dtos.ErrObjectNotFound if the object doesn't exist
+	OpenObject(ctx context.Context, objectPath string) (io.ReadCloser, error)
+}
+
+// SeekableObjectStorager is implemented by storages that can open stored objects with random access,
+// used to serve files with conditional and range requests support
+type SeekableObjectStorager interface {
+	// OpenSeekableObject returns files_dtos.ErrObjectNotFound if the object doesn't exist
+	OpenSeekableObject(ctx context.Context, objectPath string) (io.ReadSeekCloser, *files_dtos.StoredObject, error)
+}
+
+// SignedURLStorager is implemented by storages that can create temporary signed urls, the download
+// endpoints use it to keep the Content-Disposition with external urls
+type SignedURLStorager interface {
+	GetSignedURL(ctx context.Context, objectPath string, opts *files_dtos.SignedURLOptions) (string, error)
+}
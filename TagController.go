@@ -0,0 +1,390 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/helpers"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TagListJSONResponse struct {
+	bolo.BaseListReponse
+	Records *[]*TagModel `json:"tag"`
+}
+
+type TagCountJSONResponse struct {
+	bolo.BaseMetaResponse
+}
+
+type TagFindOneJSONResponse struct {
+	Record *TagModel `json:"tag"`
+}
+
+// TagBulkRequest - Files and images tagged or untagged with the tags, tags are ids or slugs
+type TagBulkRequest struct {
+	FileIDs  []string `json:"fileIds"`
+	ImageIDs []string `json:"imageIds"`
+	TagIDs   []string `json:"tagIds"`
+}
+
+type TagBulkResult struct {
+	Files  int64 `json:"files"`
+	Images int64 `json:"images"`
+}
+
+type TagBulkJSONResponse struct {
+	Result *TagBulkResult `json:"result"`
+}
+
+func NewTagController(cfgs *TagControllerConfiguration) *TagController {
+	return &TagController{App: cfgs.App}
+}
+
+type TagControllerConfiguration struct {
+	App bolo.App
+}
+
+// TagController - Tags CRUD and bulk tag or untag of files and images
+type TagController struct {
+	App bolo.App
+}
+
+func tagHTTPError(err error) error {
+	if errors.Is(err, ErrTagInvalidName) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if errors.Is(err, ErrTagExists) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return err
+}
+
+func (ctl *TagController) Query(c echo.Context) error {
+	var err error
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	query, err := getTagQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = query.Session(&gorm.Session{}).Model(&TagModel{}).Limit(-1).Offset(-1).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	orderColumn, orderIsDesc, orderValid := helpers.ParseUrlQueryOrder(c.QueryParam("order"), c.QueryParam("sort"), c.QueryParam("sortDirection"))
+
+	if orderValid {
+		query = query.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: orderColumn},
+			Desc:   orderIsDesc,
+		})
+	} else {
+		query = query.
+			Order("name ASC").
+			Order("id ASC")
+	}
+
+	records := make([]*TagModel, 0)
+	err = query.
+		Limit(ctx.GetLimit()).
+		Offset(ctx.GetOffset()).
+		Find(&records).Error
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Debug("TagController.Query Error on find records")
+
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	resp := TagListJSONResponse{
+		Records: &records,
+	}
+
+	resp.Meta.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+func (ctl *TagController) Count(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	query, err := getTagQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	err = query.Session(&gorm.Session{}).Model(&TagModel{}).Limit(-1).Offset(-1).Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	ctx.Pager.Count = count
+
+	resp := TagCountJSONResponse{}
+	resp.Count = count
+
+	return c.JSON(200, &resp)
+}
+
+// getTagQuery - Tags of the request tenant, filtered by name with ?q=
+func getTagQuery(ctx *bolo.RequestContext) (*gorm.DB, error) {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	queryI, err := ctx.Query.SetDatabaseQueryForModel(db, &TagModel{})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": fmt.Sprintf("%+v\n", err),
+		}).Error("getTagQuery error")
+	}
+	query := queryI.(*gorm.DB)
+
+	query, err = scopeQueryByTenant(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if q := ctx.QueryParam("q"); q != "" {
+		query = query.Where("name LIKE ? OR slug LIKE ?", "%"+q+"%", "%"+q+"%")
+	}
+
+	return query, nil
+}
+
+// Create - Create one tag with body {"tag": {"name": "", "slug": ""}}, the slug is generated from the name if empty
+func (ctl *TagController) Create(c echo.Context) error {
+	var err error
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("create_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	body := TagFindOneJSONResponse{Record: NewTagModel()}
+	if err := c.Bind(&body); err != nil || body.Record == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	record := NewTagModel()
+	record.Name = body.Record.Name
+	record.Slug = body.Record.Slug
+	record.CreatorID = getCreatorID(ctx)
+	record.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = record.Save()
+	if err != nil {
+		return tagHTTPError(err)
+	}
+
+	return c.JSON(http.StatusCreated, &TagFindOneJSONResponse{Record: record})
+}
+
+// findRequestTag - Find one tag of the request tenant by id or slug
+func findRequestTag(c echo.Context, id string) (*TagModel, error) {
+	ctx := c.(*bolo.RequestContext)
+
+	record := TagModel{}
+	err := requestTagFindOne(ctx, id, &record)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, echo.NotFoundHandler(c)
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (ctl *TagController) FindOne(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("find_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestTag(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &TagFindOneJSONResponse{Record: record})
+}
+
+// Update - Rename one tag, tagged records keep the tag
+func (ctl *TagController) Update(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("update_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestTag(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	body := TagFindOneJSONResponse{Record: &TagModel{
+		Name: record.Name,
+		Slug: record.Slug,
+	}}
+	if err := c.Bind(&body); err != nil || body.Record == nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	record.Name = body.Record.Name
+	record.Slug = body.Record.Slug
+
+	err = record.Save()
+	if err != nil {
+		return tagHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, &TagFindOneJSONResponse{Record: record})
+}
+
+// Delete - Delete one tag, the tag is removed from all files and images
+func (ctl *TagController) Delete(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+
+	can := ctx.Can("delete_tag")
+	if !can {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	record, err := findRequestTag(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	err = record.Delete()
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// BulkTag - Tag files and images with body {"fileIds": [], "imageIds": [], "tagIds": []}, records already
+// tagged are kept. The result has the number of new associations
+func (ctl *TagController) BulkTag(c echo.Context) error {
+	return ctl.bulk(c, AddTags)
+}
+
+// BulkUntag - Untag files and images with body {"fileIds": [], "imageIds": [], "tagIds": []}. The result has
+// the number of removed associations
+func (ctl *TagController) BulkUntag(c echo.Context) error {
+	return ctl.bulk(c, RemoveTags)
+}
+
+// bulk - Load and check the bulk request records and tags, then run the action with files and images, the
+// request should be able to update every record
+func (ctl *TagController) bulk(c echo.Context, action func(db *gorm.DB, recordType string, recordIDs, tagIDs []uint64) (int64, error)) error {
+	ctx := c.(*bolo.RequestContext)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	body := TagBulkRequest{}
+	if err := c.Bind(&body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	if len(body.FileIDs)+len(body.ImageIDs) == 0 || len(body.TagIDs) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "tagIds and fileIds or imageIds are required")
+	}
+
+	if len(body.FileIDs)+len(body.ImageIDs)+len(body.TagIDs) > filePlugin.MaxBulkItems {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("max %d items in one request", filePlugin.MaxBulkItems))
+	}
+
+	if (len(body.FileIDs) > 0 && !ctx.Can("update_file")) ||
+		(len(body.ImageIDs) > 0 && !ctx.Can("update_image")) {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	tagIDs := []uint64{}
+	for _, id := range body.TagIDs {
+		tag, err := findRequestTag(c, id)
+		if err != nil {
+			return err
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+
+	tenantScope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	files := []FileModel{}
+	err = FileFindManyByIds(body.FileIDs, &files, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	fileIDs := []uint64{}
+	for i := range files {
+		err = checkRecordAccess(c, AccessActionUpdate, files[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+		fileIDs = append(fileIDs, files[i].ID)
+	}
+
+	images := []ImageModel{}
+	err = ImageFindManyByIds(body.ImageIDs, &images, tenantScope)
+	if err != nil {
+		return err
+	}
+
+	imageIDs := []uint64{}
+	for i := range images {
+		err = checkRecordAccess(c, AccessActionUpdate, images[i].GetAccessRecord())
+		if err != nil {
+			return err
+		}
+		imageIDs = append(imageIDs, images[i].ID)
+	}
+
+	result := TagBulkResult{}
+
+	result.Files, err = action(ctl.App.GetDB(), AccessRecordTypeFile, fileIDs, tagIDs)
+	if err != nil {
+		return err
+	}
+
+	result.Images, err = action(ctl.App.GetDB(), AccessRecordTypeImage, imageIDs, tagIDs)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, &TagBulkJSONResponse{Result: &result})
+}
@@ -0,0 +1,206 @@
+package files
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type AccessAction string
+
+const (
+	AccessActionFind   AccessAction = "find"
+	AccessActionUpdate AccessAction = "update"
+	AccessActionDelete AccessAction = "delete"
+)
+
+const (
+	AccessRecordTypeFile  = "file"
+	AccessRecordTypeImage = "image"
+)
+
+// AccessRecord - Data used by access policies to authorize one file or image
+type AccessRecord struct {
+	// file or image
+	Type      string
+	ID        uint64
+	CreatorID *int64
+	// folders with private visibility hide their records, checked before the policy
+	FolderID *uint64
+}
+
+// AccessPolicy - Per record authorization of files and images, the global permissions like find_file
+// are checked before the policy
+type AccessPolicy interface {
+	// CanAccess - Check if the request can run the action in the record
+	CanAccess(ctx *bolo.RequestContext, action AccessAction, record *AccessRecord) (bool, error)
+	// ScopeQuery - Filter the query to only return records the request can find
+	ScopeQuery(ctx *bolo.RequestContext, recordType string, query *gorm.DB) (*gorm.DB, error)
+}
+
+// AllowAllAccessPolicy - Only the global permissions are checked, any record can be accessed
+type AllowAllAccessPolicy struct{}
+
+func (p *AllowAllAccessPolicy) CanAccess(ctx *bolo.RequestContext, action AccessAction, record *AccessRecord) (bool, error) {
+	return true, nil
+}
+
+func (p *AllowAllAccessPolicy) ScopeQuery(ctx *bolo.RequestContext, recordType string, query *gorm.DB) (*gorm.DB, error) {
+	return query, nil
+}
+
+// AssociationAccessPolicy - Default policy. One record can be accessed by its creator or by users that can
+// access one record associated with it, like find_content for find and update_content for update or delete
+// of files associated to contents. Users with <action>_any_<type> permission, like find_any_file, can access all
+type AssociationAccessPolicy struct{}
+
+func (p *AssociationAccessPolicy) CanAccess(ctx *bolo.RequestContext, action AccessAction, record *AccessRecord) (bool, error) {
+	if ctx.Can(string(action) + "_any_" + record.Type) {
+		return true, nil
+	}
+
+	if isRecordCreator(ctx, record.CreatorID) {
+		return true, nil
+	}
+
+	assocTable, assocColumn := getAccessAssocTable(record.Type)
+
+	var modelNames []string
+	err := bolo.GetDefaultDatabaseConnection().
+		Table(assocTable).
+		Distinct("modelName").
+		Where(assocColumn+" = ?", record.ID).
+		Pluck("modelName", &modelNames).Error
+	if err != nil {
+		return false, err
+	}
+
+	for _, modelName := range modelNames {
+		if ctx.Can(getAssociatedRecordPermission(action, modelName)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *AssociationAccessPolicy) ScopeQuery(ctx *bolo.RequestContext, recordType string, query *gorm.DB) (*gorm.DB, error) {
+	if ctx.Can("find_any_" + recordType) {
+		return query, nil
+	}
+
+	db := bolo.GetDefaultDatabaseConnection()
+	assocTable, assocColumn := getAccessAssocTable(recordType)
+
+	var modelNames []string
+	err := db.Table(assocTable).Distinct("modelName").Pluck("modelName", &modelNames).Error
+	if err != nil {
+		return nil, err
+	}
+
+	allowedModels := []string{}
+	for _, modelName := range modelNames {
+		if ctx.Can(getAssociatedRecordPermission(AccessActionFind, modelName)) {
+			allowedModels = append(allowedModels, modelName)
+		}
+	}
+
+	userID := getAuthenticatedUserID(ctx)
+
+	switch {
+	case userID == "" && len(allowedModels) == 0:
+		return query.Where("1 = 0"), nil
+	case len(allowedModels) == 0:
+		return query.Where("creatorId = ?", userID), nil
+	}
+
+	assocQuery := db.Table(assocTable).Select(assocColumn).Where("modelName IN ?", allowedModels)
+
+	if userID == "" {
+		return query.Where("id IN (?)", assocQuery), nil
+	}
+
+	return query.Where(db.Where("creatorId = ?", userID).Or("id IN (?)", assocQuery)), nil
+}
+
+// getAssociatedRecordPermission - Changes in files are changes in the associated records, so update and
+// delete require the update permission of the associated record
+func getAssociatedRecordPermission(action AccessAction, modelName string) string {
+	if action == AccessActionFind {
+		return "find_" + modelName
+	}
+
+	return "update_" + modelName
+}
+
+func getAccessAssocTable(recordType string) (string, string) {
+	if recordType == AccessRecordTypeImage {
+		return "imageassocs", "imageId"
+	}
+
+	return "fileassocs", "fileId"
+}
+
+func getAuthenticatedUserID(ctx *bolo.RequestContext) string {
+	if !ctx.IsAuthenticated || ctx.AuthenticatedUser == nil {
+		return ""
+	}
+
+	return ctx.AuthenticatedUser.GetID()
+}
+
+func isRecordCreator(ctx *bolo.RequestContext, creatorID *int64) bool {
+	userID := getAuthenticatedUserID(ctx)
+
+	return userID != "" && creatorID != nil && strconv.FormatInt(*creatorID, 10) == userID
+}
+
+// canAccessRecord - Check the folder visibility and the access policy for one record
+func canAccessRecord(ctx *bolo.RequestContext, action AccessAction, record *AccessRecord) (bool, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+
+	allowed, err := checkFolderVisibility(ctx, record.FolderID)
+	if err != nil || !allowed {
+		return false, err
+	}
+
+	return filePlugin.AccessPolicy.CanAccess(ctx, action, record)
+}
+
+// checkRecordAccess - Check the access policy for one record. Denied find returns not found to not expose
+// which ids exist
+func checkRecordAccess(c echo.Context, action AccessAction, record *AccessRecord) error {
+	ctx := c.(*bolo.RequestContext)
+
+	allowed, err := canAccessRecord(ctx, action, record)
+	if err != nil {
+		return err
+	}
+
+	if allowed {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"action": action,
+		"type":   record.Type,
+		"id":     record.ID,
+	}).Debug("checkRecordAccess access denied")
+
+	if action == AccessActionFind {
+		return echo.NotFoundHandler(c)
+	}
+
+	return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+}
+
+// scopeQueryByAccessPolicy - Apply the plugin access policy in one file or image query
+func scopeQueryByAccessPolicy(ctx *bolo.RequestContext, recordType string, query *gorm.DB) (*gorm.DB, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+
+	return filePlugin.AccessPolicy.ScopeQuery(ctx, recordType, query)
+}
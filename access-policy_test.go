@@ -0,0 +1,144 @@
+package files
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/acl"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssociationAccessPolicy(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	ctl := app.GetPlugin("files").(*FilePlugin).FileController
+
+	role, _ := acl.NewRole(&acl.NewRoleOpts{Name: "access-tester", Permissions: []string{"find_file", "update_file", "delete_file", "find_access-post"}})
+	app.SetRole("access-tester", *role)
+
+	newFile := func(creatorID *int64) *FileModel {
+		record := GetFileModelStub()
+		record.CreatorID = creatorID
+		err := record.Save()
+		assert.Nil(err)
+		return &record
+	}
+
+	ownerID := int64(4001)
+	owned := newFile(&ownerID)
+	associated := newFile(nil)
+	other := newFile(nil)
+
+	err := AddFilesInFieldByIDs("1", []string{associated.GetIDString()}, NewFileFieldConfiguration("access-post", "attachments"))
+	assert.Nil(err)
+
+	newCtx := func(method, target string, userID string) (*bolo.RequestContext, *httptest.ResponseRecorder) {
+		ctx, rec := GetRequestContextStub(app, httptest.NewRequest(method, target, nil), "access-tester")
+		ctx.AuthenticatedUser = &UserStub{ID: userID}
+		return ctx, rec
+	}
+
+	findOneData := func(record *FileModel, userID string) error {
+		ctx, _ := newCtx(http.MethodGet, "/api/v1/file/"+record.GetIDString()+"/data", userID)
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(record.GetIDString())
+		return ctl.FindOneData(ctx)
+	}
+
+	t.Run("Should find owned and associated files", func(t *testing.T) {
+		assert.Nil(findOneData(owned, "4001"))
+		assert.Nil(findOneData(associated, "4001"))
+		assert.Nil(findOneData(associated, "4002"))
+	})
+
+	t.Run("Should return not found for files without access", func(t *testing.T) {
+		err := findOneData(other, "4001")
+		assert.NotNil(err)
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+
+		err = findOneData(owned, "4002")
+		assert.NotNil(err)
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should require the associated record update permission to delete", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodDelete, "/api/v1/file/"+associated.GetIDString(), "4002")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(associated.GetIDString())
+
+		err := ctl.Delete(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should only list files with access", func(t *testing.T) {
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/file?limit=1000", "4001")
+
+		err := ctl.Query(ctx)
+		assert.Nil(err)
+
+		resp := struct {
+			Meta    struct{ Count int64 } `json:"meta"`
+			Records []FileModel           `json:"file"`
+		}{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		ids := []uint64{}
+		for _, r := range resp.Records {
+			ids = append(ids, r.ID)
+		}
+		assert.Contains(ids, owned.ID)
+		assert.Contains(ids, associated.ID)
+		assert.NotContains(ids, other.ID)
+		assert.Equal(int64(len(resp.Records)), resp.Meta.Count)
+	})
+
+	t.Run("Should only list and restore trashed files with access", func(t *testing.T) {
+		trashedOwned := newFile(&ownerID)
+		trashedOther := newFile(nil)
+		for _, record := range []*FileModel{trashedOwned, trashedOther} {
+			err := record.Delete()
+			assert.Nil(err)
+		}
+
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/file/trash?limit=1000", "4001")
+		err := ctl.QueryTrash(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		ids := []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		assert.Contains(ids, trashedOwned.ID)
+		assert.NotContains(ids, trashedOther.ID)
+
+		restore := func(record *FileModel) error {
+			ctx, _ := newCtx(http.MethodPost, "/api/v1/file/"+record.GetIDString()+"/restore", "4001")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(record.GetIDString())
+			return ctl.Restore(ctx)
+		}
+
+		err = restore(trashedOther)
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, err.(*echo.HTTPError).Code)
+
+		assert.Nil(restore(trashedOwned))
+	})
+
+	t.Run("Should allow all records with the find_any permission", func(t *testing.T) {
+		ctx, _ := GetRequestContextStub(app, httptest.NewRequest(http.MethodGet, "/api/v1/file/"+other.GetIDString()+"/data", nil), "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(other.GetIDString())
+		assert.Nil(ctl.FindOneData(ctx))
+	})
+}
@@ -0,0 +1,305 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	AvatarModelName = "user"
+	AvatarFieldName = "avatar"
+
+	// default style used in avatar urls without the style param
+	defaultAvatarStyle = "medium"
+	defaultAvatarSize  = 250
+	// max pixels of images decoded to crop avatars
+	maxAvatarPixels = 50 * 1000 * 1000
+)
+
+var (
+	ErrAvatarUnsupportedFormat = errors.New("unsupported avatar image format, use png, jpeg or gif")
+	ErrAvatarImageTooLarge     = errors.New("avatar image dimensions are too large")
+	ErrAvatarInvalidCrop       = errors.New("invalid avatar crop, the square should be inside the image")
+)
+
+// AvatarCrop - Square area of the uploaded image used as avatar, the center square is used if Size is 0
+type AvatarCrop struct {
+	X    int
+	Y    int
+	Size int
+}
+
+// getAvatarCrop - Get the crop square from cropX, cropY and cropSize form values
+func getAvatarCrop(c echo.Context) (*AvatarCrop, error) {
+	crop := AvatarCrop{}
+
+	for name, dest := range map[string]*int{"cropX": &crop.X, "cropY": &crop.Y, "cropSize": &crop.Size} {
+		v := c.FormValue(name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrAvatarInvalidCrop
+		}
+		*dest = n
+	}
+
+	return &crop, nil
+}
+
+// CropImageToSquare - Crop the image in src to one square and save it as png in dest
+func CropImageToSquare(src, dest string, crop *AvatarCrop) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return ErrAvatarUnsupportedFormat
+	}
+
+	if cfg.Width*cfg.Height > maxAvatarPixels {
+		return ErrAvatarImageTooLarge
+	}
+
+	_, err = f.Seek(0, 0)
+	if err != nil {
+		return err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return ErrAvatarUnsupportedFormat
+	}
+
+	bounds := img.Bounds()
+	var rect image.Rectangle
+
+	if crop == nil || crop.Size == 0 {
+		size := bounds.Dx()
+		if bounds.Dy() < size {
+			size = bounds.Dy()
+		}
+
+		x := bounds.Min.X + (bounds.Dx()-size)/2
+		y := bounds.Min.Y + (bounds.Dy()-size)/2
+		rect = image.Rect(x, y, x+size, y+size)
+	} else {
+		x := bounds.Min.X + crop.X
+		y := bounds.Min.Y + crop.Y
+		rect = image.Rect(x, y, x+crop.Size, y+crop.Size)
+
+		if !rect.In(bounds) {
+			return ErrAvatarInvalidCrop
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return png.Encode(out, dst)
+}
+
+// avatarHTTPError - Convert avatar crop errors to HTTP errors
+func avatarHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrAvatarUnsupportedFormat), errors.Is(err, ErrAvatarInvalidCrop):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrAvatarImageTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		return err
+	}
+}
+
+// GetAvatarStyle - Get the style from the style query param, fallback to the default avatar style
+func GetAvatarStyle(c echo.Context, styles map[string]ImageStyleCfg) string {
+	style := c.QueryParam("style")
+	if _, ok := styles[style]; ok {
+		return style
+	}
+
+	return defaultAvatarStyle
+}
+
+// GetAvatarSize - Get the generated avatar size in pixels for one image style
+func GetAvatarSize(styles map[string]ImageStyleCfg, style string) int {
+	cfg, ok := styles[style]
+	if !ok {
+		return defaultAvatarSize
+	}
+
+	if cfg.Width > 0 {
+		return cfg.Width
+	}
+
+	if cfg.Height > 0 {
+		return cfg.Height
+	}
+
+	return defaultAvatarSize
+}
+
+// GetAvatarColor - Get one deterministic color for the seed, the same user always gets the same color
+func GetAvatarColor(seed string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(seed))
+
+	return hslToRGB(float64(h.Sum32()%360), 0.55, 0.5)
+}
+
+func hslToRGB(hue, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = c, x, 0
+	case hue < 120:
+		r, g, b = x, c, 0
+	case hue < 180:
+		r, g, b = 0, c, x
+	case hue < 240:
+		r, g, b = 0, x, c
+	case hue < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
+
+// GenerateIdenticon - Generate one 5x5 symmetric identicon from the seed hash
+func GenerateIdenticon(seed string, size int) image.Image {
+	sum := sha1.Sum([]byte(seed))
+	fg := GetAvatarColor(seed)
+	bg := color.RGBA{R: 240, G: 240, B: 240, A: 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+
+	cell := size / 6
+	if cell < 1 {
+		cell = 1
+	}
+	margin := (size - cell*5) / 2
+
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			// one bit for each cell in the left half, the right half is mirrored
+			bit := row*3 + col
+			if sum[bit/8]&(1<<(bit%8)) == 0 {
+				continue
+			}
+
+			for _, c := range []int{col, 4 - col} {
+				r := image.Rect(margin+c*cell, margin+row*cell, margin+(c+1)*cell, margin+(row+1)*cell)
+				draw.Draw(img, r, &image.Uniform{fg}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return img
+}
+
+// GetInitials - Get up to 2 uppercase initials from the first and last words of the name
+func GetInitials(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	if len(words) == 0 {
+		return ""
+	}
+
+	initials := []rune{[]rune(words[0])[0]}
+	if len(words) > 1 {
+		initials = append(initials, []rune(words[len(words)-1])[0])
+	}
+
+	return strings.ToUpper(string(initials))
+}
+
+// GenerateInitialsSVG - Generate one svg with the name initials over the seed color
+func GenerateInitialsSVG(seed, name string, size int) []byte {
+	bg := GetAvatarColor(seed)
+
+	var text bytes.Buffer
+	xml.EscapeText(&text, []byte(GetInitials(name)))
+
+	return []byte(fmt.Sprintf(
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d">`+
+			`<rect width="100%%" height="100%%" fill="#%02x%02x%02x"/>`+
+			`<text x="50%%" y="50%%" dy=".35em" fill="#ffffff" font-family="Helvetica, Arial, sans-serif" font-size="%[5]d" text-anchor="middle">%[6]s</text>`+
+			`</svg>`,
+		size, bg.R, bg.G, bg.B, size*2/5, text.String(),
+	))
+}
+
+// sendDefaultAvatar - Send the generated default avatar, initials are used if the name param is set
+func sendDefaultAvatar(c echo.Context, userID string, size int) error {
+	name := c.QueryParam("name")
+	if GetInitials(name) == "" {
+		name = ""
+	}
+
+	sum := sha1.Sum([]byte(userID + "\x00" + name + "\x00" + strconv.Itoa(size)))
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	header := c.Response().Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "public, max-age=86400")
+
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if name != "" {
+		return c.Blob(http.StatusOK, "image/svg+xml", GenerateInitialsSVG(userID, name, size))
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, GenerateIdenticon(userID, size))
+	if err != nil {
+		return err
+	}
+
+	return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+}
@@ -0,0 +1,224 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestPNG(t *testing.T, p string, width, height int) {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), A: 255})
+		}
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = png.Encode(f, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCropImageToSquare(t *testing.T) {
+	assert := assert.New(t)
+
+	src := filepath.Join(os.TempDir(), "avatar-crop-src.png")
+	dest := filepath.Join(os.TempDir(), "avatar-crop-dest.png")
+	defer os.Remove(src)
+	defer os.Remove(dest)
+
+	writeTestPNG(t, src, 120, 80)
+
+	readDest := func() image.Image {
+		f, err := os.Open(dest)
+		assert.Nil(err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		assert.Nil(err)
+		return img
+	}
+
+	t.Run("Should crop the center square", func(t *testing.T) {
+		err := CropImageToSquare(src, dest, nil)
+		assert.Nil(err)
+
+		img := readDest()
+		assert.Equal(80, img.Bounds().Dx())
+		assert.Equal(80, img.Bounds().Dy())
+		r, _, _, _ := img.At(0, 0).RGBA()
+		assert.Equal(uint32(20), r>>8)
+	})
+
+	t.Run("Should crop the selected square", func(t *testing.T) {
+		err := CropImageToSquare(src, dest, &AvatarCrop{X: 50, Y: 10, Size: 30})
+		assert.Nil(err)
+
+		img := readDest()
+		assert.Equal(30, img.Bounds().Dx())
+		r, g, _, _ := img.At(0, 0).RGBA()
+		assert.Equal(uint32(50), r>>8)
+		assert.Equal(uint32(10), g>>8)
+	})
+
+	t.Run("Should return error with crop outside the image", func(t *testing.T) {
+		err := CropImageToSquare(src, dest, &AvatarCrop{X: 100, Y: 0, Size: 40})
+		assert.ErrorIs(err, ErrAvatarInvalidCrop)
+	})
+
+	t.Run("Should return error with not image files", func(t *testing.T) {
+		txt := filepath.Join(os.TempDir(), "avatar-crop.txt")
+		os.WriteFile(txt, []byte("not image"), 0644)
+		defer os.Remove(txt)
+
+		err := CropImageToSquare(txt, dest, nil)
+		assert.ErrorIs(err, ErrAvatarUnsupportedFormat)
+	})
+}
+
+type userQuotaResolverStub struct {
+	limits map[string]int64
+}
+
+func (r *userQuotaResolverStub) GetQuotaLimits(ctx *bolo.RequestContext, userID, tenantID string) (*QuotaLimits, error) {
+	return &QuotaLimits{User: r.limits[userID]}, nil
+}
+
+func TestAvatar(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.ImageController
+
+	processor := filePlugin.Processor
+	filePlugin.Processor = &copyProcessorStub{}
+	defer func() { filePlugin.Processor = processor }()
+
+	src := filepath.Join(os.TempDir(), "avatar-upload.png")
+	writeTestPNG(t, src, 60, 40)
+	defer os.Remove(src)
+
+	newUploadRequest := func() *http.Request {
+		data, _ := os.ReadFile(src)
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("image", "me.jpg")
+		part.Write(data)
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/avatar/", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req
+	}
+
+	getAvatar := func(userID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/avatar/"+userID+query, nil)
+		ctx, rec := GetRequestContextStub(app, req)
+		ctx.SetParamNames("userID")
+		ctx.SetParamValues(userID)
+		err := ctl.GetAvatar(ctx)
+		assert.Nil(err)
+		return rec
+	}
+
+	t.Run("Should generate one deterministic identicon without avatar", func(t *testing.T) {
+		rec := getAvatar("9001", "?style=thumbnail")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("image/png", rec.Header().Get("Content-Type"))
+
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		assert.Nil(err)
+		assert.Equal(75, img.Bounds().Dx())
+
+		again := getAvatar("9001", "?style=thumbnail")
+		assert.Equal(rec.Body.Bytes(), again.Body.Bytes())
+		assert.Equal(rec.Header().Get("ETag"), again.Header().Get("ETag"))
+	})
+
+	t.Run("Should generate initials avatar with name", func(t *testing.T) {
+		rec := getAvatar("9001", "?name=Ada%20de%20Lovelace")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("image/svg+xml", rec.Header().Get("Content-Type"))
+		assert.Contains(rec.Body.String(), `width="250"`)
+		assert.Contains(rec.Body.String(), ">AL</text>")
+	})
+
+	t.Run("Should forbid set avatar of other users", func(t *testing.T) {
+		ctx, _ := GetRequestContextStub(app, newUploadRequest(), "authenticated")
+		ctx.AuthenticatedUser = &UserStub{ID: "1"}
+		ctx.SetParamNames("userID")
+		ctx.SetParamValues("9002")
+
+		err := ctl.SetAvatar(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should check the quota of the avatar owner", func(t *testing.T) {
+		quota := filePlugin.Quota
+		filePlugin.Quota = QuotaCfg{Resolver: &userQuotaResolverStub{limits: map[string]int64{"9004": 10}}}
+		defer func() { filePlugin.Quota = quota }()
+
+		ctx, _ := GetRequestContextStub(app, newUploadRequest(), "administrator")
+		ctx.AuthenticatedUser = &UserStub{ID: "1"}
+		ctx.SetParamNames("userID")
+		ctx.SetParamValues("9004")
+
+		err := ctl.SetAvatar(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*bolo.HTTPError).Code)
+	})
+
+	t.Run("Should set and replace the own avatar", func(t *testing.T) {
+		upload := func() *ImageModel {
+			ctx, rec := GetRequestContextStub(app, newUploadRequest(), "authenticated")
+			ctx.AuthenticatedUser = &UserStub{ID: "9003"}
+			ctx.SetParamNames("userID")
+			ctx.SetParamValues("9003")
+
+			err := ctl.SetAvatar(ctx)
+			assert.Nil(err)
+			assert.Equal(http.StatusOK, rec.Code)
+
+			resp := ImageFindOneJSONResponse{}
+			err = json.Unmarshal(rec.Body.Bytes(), &resp)
+			assert.Nil(err)
+			assert.Equal("me.png", resp.Record.Originalname)
+			return resp.Record
+		}
+
+		first := upload()
+		second := upload()
+
+		avatar, err := AvatarFindOne("9003")
+		assert.Nil(err)
+		assert.Equal(second.ID, avatar.ID)
+
+		old := ImageModel{}
+		err = ImageFindOne(first.GetIDString(), &old)
+		assert.NotNil(err, "the replaced avatar should be in trash")
+
+		rec := getAvatar("9003", "?style=large")
+		assert.Equal(http.StatusFound, rec.Code)
+		assert.True(strings.Contains(rec.Header().Get("Location"), "/large/"))
+	})
+}
@@ -0,0 +1,242 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-bolo/bolo"
+)
+
+// Command - One plugin command, register it in the app CLI and call Run with the command arguments
+type Command struct {
+	Name        string
+	Description string
+	Run         func(app bolo.App, args []string) error
+}
+
+// GetCommands - Get all file plugin commands
+func (p *FilePlugin) GetCommands() []*Command {
+	return []*Command{
+		newVerifyCommand(),
+		newMigrateStorageCommand(),
+		newRegenerateStylesCommand(),
+		newSearchReindexCommand(),
+	}
+}
+
+// GetCommand - Get one file plugin command by name, returns nil if not found
+func (p *FilePlugin) GetCommand(name string) *Command {
+	for _, cmd := range p.GetCommands() {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+
+	return nil
+}
+
+func newVerifyCommand() *Command {
+	return &Command{
+		Name:        "files:verify",
+		Description: "Check if all file and image objects exist in storage with the expected size and checksum",
+		Run: func(app bolo.App, args []string) error {
+			flags := flag.NewFlagSet("files:verify", flag.ContinueOnError)
+			recordType := flags.String("type", "", "records to verify: files, images or empty for both")
+			checksum := flags.Bool("checksum", false, "read the original objects to compare checksums")
+			regenerate := flags.Bool("regenerate", false, "generate missing image styles from the original")
+			format := flags.String("format", "table", "output format: table or json")
+
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			report, err := VerifyStorage(context.Background(), app, &VerifyOptions{
+				RecordType: *recordType,
+				Checksum:   *checksum,
+				Regenerate: *regenerate,
+			})
+			if err != nil {
+				return err
+			}
+
+			if *format == "json" {
+				err = report.WriteJSON(os.Stdout)
+			} else {
+				err = report.WriteTable(os.Stdout)
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(report.Issues) > 0 {
+				return fmt.Errorf("files:verify found %d issues", len(report.Issues))
+			}
+
+			return nil
+		},
+	}
+}
+
+func newMigrateStorageCommand() *Command {
+	return &Command{
+		Name:        "files:migrate-storage",
+		Description: "Copy all file and image objects from one storage to other and update the records",
+		Run: func(app bolo.App, args []string) error {
+			flags := flag.NewFlagSet("files:migrate-storage", flag.ContinueOnError)
+			from := flags.String("from", "", "source storage name")
+			to := flags.String("to", "", "target storage name")
+			recordType := flags.String("type", "", "records to migrate: files, images or empty for both")
+			concurrency := flags.Int("concurrency", 4, "records migrated at same time")
+			deleteSource := flags.Bool("delete-source", false, "delete the source objects after each record is migrated")
+			checkpoint := flags.String("checkpoint", "", "JSON file used to save and resume the progress")
+
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			report, err := MigrateStorage(context.Background(), app, &StorageMigrationOptions{
+				From:           *from,
+				To:             *to,
+				RecordType:     *recordType,
+				Concurrency:    *concurrency,
+				DeleteSource:   *deleteSource,
+				CheckpointFile: *checkpoint,
+			})
+			if err != nil {
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+			if err != nil {
+				return err
+			}
+
+			if len(report.Failures) > 0 {
+				return fmt.Errorf("files:migrate-storage failed to migrate %d records", len(report.Failures))
+			}
+
+			return nil
+		},
+	}
+}
+
+func newRegenerateStylesCommand() *Command {
+	return &Command{
+		Name:        "files:regenerate-styles",
+		Description: "Regenerate image styles and delete the styles removed from the configuration",
+		Run: func(app bolo.App, args []string) error {
+			flags := flag.NewFlagSet("files:regenerate-styles", flag.ContinueOnError)
+			styles := flags.String("styles", "", "comma separated styles to regenerate, empty for all")
+			createdFrom := flags.String("from", "", "only images created after this date (2006-01-02)")
+			createdTo := flags.String("to", "", "only images created before this date (2006-01-02)")
+			storageName := flags.String("storage", "", "only images saved in this storage")
+			mimes := flags.String("mime", "", "comma separated mime types")
+			lazy := flags.Bool("lazy", false, "reset the styles to be generated on first access")
+			concurrency := flags.Int("concurrency", 4, "images processed at same time")
+			afterID := flags.Uint64("after", 0, "resume cursor, the lastId of one previous run")
+
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			opts := RegenerateStylesOptions{
+				Styles:      splitList(*styles),
+				StorageName: *storageName,
+				Mimes:       splitList(*mimes),
+				Lazy:        *lazy,
+				Concurrency: *concurrency,
+				AfterID:     *afterID,
+			}
+
+			if *createdFrom != "" {
+				t, err := time.Parse("2006-01-02", *createdFrom)
+				if err != nil {
+					return fmt.Errorf("invalid from date: %w", err)
+				}
+				opts.CreatedFrom = &t
+			}
+
+			if *createdTo != "" {
+				t, err := time.Parse("2006-01-02", *createdTo)
+				if err != nil {
+					return fmt.Errorf("invalid to date: %w", err)
+				}
+				t = t.Add(24*time.Hour - time.Nanosecond)
+				opts.CreatedTo = &t
+			}
+
+			report, err := RegenerateStyles(context.Background(), app, &opts)
+			if err != nil {
+				if report != nil {
+					fmt.Fprintf(os.Stderr, "resume with -after %d\n", report.LastID)
+				}
+				return err
+			}
+
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+			if err != nil {
+				return err
+			}
+
+			if len(report.Failures) > 0 {
+				return fmt.Errorf("files:regenerate-styles failed to regenerate %d styles", len(report.Failures))
+			}
+
+			return nil
+		},
+	}
+}
+
+func newSearchReindexCommand() *Command {
+	return &Command{
+		Name:        "files:search-reindex",
+		Description: "Rebuild the search index of all files and images",
+		Run: func(app bolo.App, args []string) error {
+			flags := flag.NewFlagSet("files:search-reindex", flag.ContinueOnError)
+			extractText := flags.Bool("extract-text", false, "download the files to extract the text again")
+			batchSize := flags.Int("batch", 500, "records loaded in each query")
+
+			err := flags.Parse(args)
+			if err != nil {
+				return err
+			}
+
+			total, err := ReindexSearch(context.Background(), app, &ReindexSearchOptions{
+				ExtractText: *extractText,
+				BatchSize:   *batchSize,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(os.Stdout, "%d records indexed\n", total)
+
+			return nil
+		},
+	}
+}
+
+// splitList - Split one comma separated list, ignoring empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,269 @@
+package files
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/helpers"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	ErrCursorInvalid       = errors.New("invalid cursor")
+	ErrCursorOrderMismatch = errors.New("cursor was created with other order")
+	ErrCursorOrderInvalid  = errors.New("order field not supported in cursor pagination")
+)
+
+// queryCursor - Position of one record in one ordered list, sent to clients as one opaque string
+type queryCursor struct {
+	Column string          `json:"c"`
+	Desc   bool            `json:"d"`
+	Value  json.RawMessage `json:"v"`
+	ID     uint64          `json:"i"`
+	// the page before the cursor record
+	Prev bool `json:"p,omitempty"`
+}
+
+func (c *queryCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeQueryCursor(value string) (*queryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	cursor := queryCursor{}
+	err = json.Unmarshal(data, &cursor)
+	if err != nil || cursor.Column == "" {
+		return nil, ErrCursorInvalid
+	}
+
+	return &cursor, nil
+}
+
+// QueryCursors - Cursors of the pages before and after one list page, empty if there is no page
+type QueryCursors struct {
+	Next string `json:"nextCursor,omitempty"`
+	Prev string `json:"prevCursor,omitempty"`
+}
+
+// queryPage - Order and pagination of one files or images list. Lists are paginated with ?cursor= and
+// ?limit= or with the offset of ?page=, cursors are returned in both modes
+type queryPage struct {
+	Field  *schema.Field
+	Desc   bool
+	Cursor *queryCursor
+	// ordered by the search relevance, rank can't be used in cursors
+	Rank   bool
+	Limit  int
+	Offset int
+}
+
+// getQueryPage - Get the list order from the request with helpers.ParseUrlQueryOrder, lists without order are
+// sorted by createdAt DESC, or by relevance in searches without cursor
+func getQueryPage(ctx *bolo.RequestContext, model interface{}, limit, offset int) (*queryPage, error) {
+	stmt := &gorm.Statement{DB: bolo.GetDefaultDatabaseConnection()}
+	err := stmt.Parse(model)
+	if err != nil {
+		return nil, err
+	}
+
+	orderColumn, orderIsDesc, orderValid := helpers.ParseUrlQueryOrder(ctx.QueryParam("order"), ctx.QueryParam("sort"), ctx.QueryParam("sortDirection"))
+
+	page := queryPage{
+		Limit:  limit,
+		Offset: offset,
+		Desc:   true,
+	}
+
+	if cursorParam := ctx.QueryParam("cursor"); cursorParam != "" {
+		page.Cursor, err = decodeQueryCursor(cursorParam)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if orderValid && (orderColumn != page.Cursor.Column || orderIsDesc != page.Cursor.Desc) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, ErrCursorOrderMismatch.Error())
+		}
+
+		orderColumn, orderIsDesc, orderValid = page.Cursor.Column, page.Cursor.Desc, true
+		page.Offset = 0
+	}
+
+	if !orderValid {
+		orderColumn = "createdAt"
+		page.Rank = ctx.QueryParam("q") != ""
+	}
+
+	page.Field = stmt.Schema.LookUpField(orderColumn)
+	page.Desc = orderIsDesc
+
+	if page.Cursor != nil && !isCursorField(page.Field) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, ErrCursorOrderInvalid.Error())
+	}
+
+	if page.Field == nil {
+		// unknown columns are kept in offset lists, like before cursors
+		page.Field = &schema.Field{DBName: orderColumn}
+	}
+
+	return &page, nil
+}
+
+// isCursorField - Cursors only support not nullable columns
+func isCursorField(field *schema.Field) bool {
+	if field == nil || field.DBName == "" || field.ValueOf == nil {
+		return false
+	}
+
+	switch field.FieldType.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		return false
+	case reflect.Struct:
+		return field.FieldType == reflect.TypeOf(time.Time{})
+	}
+
+	return true
+}
+
+// Apply - Set the order, the cursor position and the limit in the list query
+func (p *queryPage) Apply(query *gorm.DB) (*gorm.DB, error) {
+	desc := p.Desc
+	if p.Cursor != nil && p.Cursor.Prev {
+		// the previous page is loaded in reverse order and reversed after the query
+		desc = !desc
+	}
+
+	if p.Cursor != nil {
+		value := reflect.New(p.Field.FieldType)
+		err := json.Unmarshal(p.Cursor.Value, value.Interface())
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, ErrCursorInvalid.Error())
+		}
+
+		if t, ok := value.Interface().(*time.Time); ok {
+			*t = t.Local()
+		}
+
+		op := ">"
+		if desc {
+			op = "<"
+		}
+
+		column := clause.Column{Table: clause.CurrentTable, Name: p.Field.DBName}
+		id := clause.Column{Table: clause.CurrentTable, Name: "id"}
+
+		if p.Field.DBName == "id" {
+			query = query.Where(clause.Expr{SQL: "? " + op + " ?", Vars: []interface{}{id, p.Cursor.ID}})
+		} else {
+			query = query.Where(clause.Expr{
+				SQL:  "(? " + op + " ? OR (? = ? AND ? " + op + " ?))",
+				Vars: []interface{}{column, value.Elem().Interface(), column, value.Elem().Interface(), id, p.Cursor.ID},
+			})
+		}
+	}
+
+	query = query.Order(clause.OrderByColumn{
+		Column: clause.Column{Table: clause.CurrentTable, Name: p.Field.DBName},
+		Desc:   desc,
+	})
+
+	if p.Field.DBName != "id" {
+		query = query.Order(clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: "id"},
+			Desc:   desc,
+		})
+	}
+
+	if p.Cursor != nil {
+		// one more record to know if there is one next page
+		return query.Limit(p.Limit + 1), nil
+	}
+
+	return query.Limit(p.Limit).Offset(p.Offset), nil
+}
+
+// getRecordCursor - Get the cursor of one list record
+func (p *queryPage) getRecordCursor(record reflect.Value, prev bool) string {
+	value, _ := p.Field.ValueOf(context.Background(), record)
+	if t, ok := value.(time.Time); ok {
+		// same location of the saved dates, SQLite compares dates as text
+		value = t.Local()
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	id, _ := record.FieldByName("ID").Interface().(uint64)
+
+	cursor := queryCursor{
+		Column: p.Field.DBName,
+		Desc:   p.Desc,
+		Value:  raw,
+		ID:     id,
+		Prev:   prev,
+	}
+
+	return cursor.Encode()
+}
+
+// finishQueryPage - Remove the extra record of cursor pages, restore the order of previous pages and get the
+// cursors of the pages around the loaded page
+func finishQueryPage[T any](p *queryPage, records *[]*T, count int64) *QueryCursors {
+	cursors := QueryCursors{}
+	list := *records
+
+	hasMore := false
+	if p.Cursor != nil && len(list) > p.Limit {
+		hasMore = true
+		list = list[:p.Limit]
+	}
+
+	if p.Cursor != nil && p.Cursor.Prev {
+		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+			list[i], list[j] = list[j], list[i]
+		}
+	}
+
+	*records = list
+
+	if len(list) == 0 || p.Rank || !isCursorField(p.Field) {
+		return &cursors
+	}
+
+	var hasNext, hasPrev bool
+	switch {
+	case p.Cursor == nil:
+		hasNext = int64(p.Offset+len(list)) < count
+		hasPrev = p.Offset > 0
+	case p.Cursor.Prev:
+		hasNext = true
+		hasPrev = hasMore
+	default:
+		hasNext = hasMore
+		hasPrev = true
+	}
+
+	if hasNext {
+		cursors.Next = p.getRecordCursor(reflect.ValueOf(list[len(list)-1]).Elem(), false)
+	}
+
+	if hasPrev {
+		cursors.Prev = p.getRecordCursor(reflect.ValueOf(list[0]).Elem(), true)
+	}
+
+	return &cursors
+}
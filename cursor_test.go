@@ -0,0 +1,164 @@
+package files
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorPagination(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	query := func(params string) (*FileListJSONResponse, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file?tags=cursor-page&limit=3&"+params, nil)
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := filePlugin.FileController.Query(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return &resp, nil
+	}
+
+	getIDs := func(resp *FileListJSONResponse) []uint64 {
+		ids := []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		return ids
+	}
+
+	tag := NewTagModel()
+	tag.Name = "Cursor page"
+	err := tag.Save()
+	assert.Nil(err)
+
+	createdAt := time.Now().Add(-time.Hour).Round(time.Second)
+	files := []*FileModel{}
+	for i := 0; i < 7; i++ {
+		f := GetFileModelStub()
+		// same dates are ordered by id
+		f.CreatedAt = createdAt.Add(time.Duration(i/2) * time.Minute)
+		err := f.Save()
+		assert.Nil(err)
+		files = append(files, &f)
+
+		_, err = AddTags(app.GetDB(), AccessRecordTypeFile, []uint64{f.ID}, []uint64{tag.ID})
+		assert.Nil(err)
+	}
+
+	// createdAt DESC, id DESC
+	expected := []uint64{}
+	for i := len(files) - 1; i >= 0; i-- {
+		expected = append(expected, files[i].ID)
+	}
+
+	t.Run("Should paginate with cursors", func(t *testing.T) {
+		first, err := query("")
+		assert.Nil(err)
+		assert.Equal(expected[0:3], getIDs(first))
+		assert.Equal(int64(7), first.Meta.Count)
+		assert.NotEmpty(first.Meta.Next)
+		assert.Empty(first.Meta.Prev)
+
+		// new uploads don't change the next pages
+		newFile := GetFileModelStub()
+		err = newFile.Save()
+		assert.Nil(err)
+		_, err = AddTags(app.GetDB(), AccessRecordTypeFile, []uint64{newFile.ID}, []uint64{tag.ID})
+		assert.Nil(err)
+		defer DestroyFileRecord(app, &newFile)
+
+		second, err := query("cursor=" + first.Meta.Next)
+		assert.Nil(err)
+		assert.Equal(expected[3:6], getIDs(second))
+		assert.NotEmpty(second.Meta.Next)
+		assert.NotEmpty(second.Meta.Prev)
+
+		last, err := query("cursor=" + second.Meta.Next)
+		assert.Nil(err)
+		assert.Equal(expected[6:], getIDs(last))
+		assert.Empty(last.Meta.Next)
+		assert.NotEmpty(last.Meta.Prev)
+
+		prev, err := query("cursor=" + last.Meta.Prev)
+		assert.Nil(err)
+		assert.Equal(expected[3:6], getIDs(prev))
+		assert.NotEmpty(prev.Meta.Next)
+		assert.NotEmpty(prev.Meta.Prev)
+
+		prev, err = query("cursor=" + prev.Meta.Prev)
+		assert.Nil(err)
+		assert.Equal(expected[0:3], getIDs(prev))
+		assert.NotEmpty(prev.Meta.Prev)
+
+		prev, err = query("cursor=" + prev.Meta.Prev)
+		assert.Nil(err)
+		assert.Equal([]uint64{newFile.ID}, getIDs(prev))
+		assert.Empty(prev.Meta.Prev)
+	})
+
+	t.Run("Should paginate with cursors in other orders", func(t *testing.T) {
+		seen := []uint64{}
+		resp, err := query("order=id+ASC")
+		assert.Nil(err)
+
+		for {
+			seen = append(seen, getIDs(resp)...)
+			if resp.Meta.Next == "" {
+				break
+			}
+
+			resp, err = query("order=id+ASC&cursor=" + resp.Meta.Next)
+			assert.Nil(err)
+		}
+
+		ids := []uint64{}
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+		assert.Equal(ids, seen)
+	})
+
+	t.Run("Should return cursors in offset pages", func(t *testing.T) {
+		second, err := query("page=2")
+		assert.Nil(err)
+		assert.Equal(expected[3:6], getIDs(second))
+		assert.NotEmpty(second.Meta.Prev)
+
+		last, err := query("cursor=" + second.Meta.Next)
+		assert.Nil(err)
+		assert.Equal(expected[6:], getIDs(last))
+	})
+
+	t.Run("Should reject invalid cursors", func(t *testing.T) {
+		first, err := query("")
+		assert.Nil(err)
+
+		_, err = query("cursor=invalid")
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		_, err = query("order=id+ASC&cursor=" + first.Meta.Next)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		cursor := queryCursor{Column: "label", Value: json.RawMessage(`"a"`), ID: 1}
+		_, err = query("cursor=" + cursor.Encode())
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		// nullable columns don't have cursors
+		resp, err := query("order=label+ASC")
+		assert.Nil(err)
+		assert.Empty(resp.Meta.Next)
+	})
+}
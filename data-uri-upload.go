@@ -0,0 +1,146 @@
+package files
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrInvalidDataURI  = errors.New("invalid data uri, expected data:<mime>;base64,<data>")
+	ErrDataURITooLarge = errors.New("data uri file is too large")
+)
+
+// DataURIUploadItem - File sent as data uri in JSON bodies
+type DataURIUploadItem struct {
+	// data:<mime>;base64,<data>
+	Data        string `json:"data"`
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	// Optional RFC 3339 date, the uploaded record is deleted after it
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// isJSONRequest - Check if the request body is JSON, used to select the upload type in create endpoints
+func isJSONRequest(c echo.Context) bool {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	return strings.HasPrefix(contentType, echo.MIMEApplicationJSON)
+}
+
+// bindDataURIBody - Bind the JSON body limiting the body size, base64 data is 4/3 of the file size
+func bindDataURIBody(c echo.Context, maxSize int64, body interface{}) error {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxSize/3*4+64*1024)
+
+	err := c.Bind(body)
+	if err != nil {
+		// echo wraps the body read errors in one HTTPError
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Internal != nil {
+			err = httpErr.Internal
+		}
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, ErrDataURITooLarge.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body")
+	}
+
+	return nil
+}
+
+// decodeDataURIToFile - Decode one base64 data uri to dest, returns the mime type from the data uri
+func decodeDataURIToFile(dataURI string, maxSize int64, dest string) (string, error) {
+	if !strings.HasPrefix(dataURI, "data:") {
+		return "", ErrInvalidDataURI
+	}
+
+	meta, data, found := strings.Cut(dataURI[len("data:"):], ",")
+	if !found || !strings.HasSuffix(meta, ";base64") {
+		return "", ErrInvalidDataURI
+	}
+
+	mimeType := strings.TrimSuffix(meta, ";base64")
+	if i := strings.Index(mimeType, ";"); i != -1 {
+		mimeType = mimeType[:i]
+	}
+
+	if int64(base64.StdEncoding.DecodedLen(len(data))) > maxSize+2 {
+		return "", ErrDataURITooLarge
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	decoder := base64.NewDecoder(base64.StdEncoding, strings.NewReader(data))
+
+	size, err := io.Copy(f, io.LimitReader(decoder, maxSize+1))
+	if err != nil {
+		return "", ErrInvalidDataURI
+	}
+
+	if size > maxSize {
+		return "", ErrDataURITooLarge
+	}
+
+	if size == 0 {
+		return "", ErrInvalidDataURI
+	}
+
+	return mimeType, nil
+}
+
+// dataURIFileName - Get the file name for one data uri upload, with extension from the mime type
+func dataURIFileName(name, mimeType string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name != "" && name != "." && name != "/" {
+		return name
+	}
+
+	extensions, _ := mime.ExtensionsByType(mimeType)
+	if len(extensions) == 0 {
+		return "upload"
+	}
+
+	// prefer the extension equal to the mime subtype, like .png for image/png
+	_, subtype, _ := strings.Cut(mimeType, "/")
+	for _, ext := range extensions {
+		if ext == "."+subtype {
+			return "upload" + ext
+		}
+	}
+
+	return "upload" + extensions[0]
+}
+
+// dataURIHTTPError - Get the http error for one decodeDataURIToFile error
+func dataURIHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrDataURITooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, ErrInvalidDataURI):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return err
+	}
+}
+
+// isImageFile - Check the file content type, used to validate images before processing
+func isImageFile(filePath string) bool {
+	mimeType, _, _ := files_helpers.GetFileExtensionAndMimeType(filePath)
+	return strings.HasPrefix(mimeType, "image/")
+}
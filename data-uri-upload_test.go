@@ -0,0 +1,102 @@
+package files
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateFromDataURI(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	newRequest := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/file", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	content := "data uri content"
+	dataURI := "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(content))
+
+	t.Run("Should create one file from data uri", func(t *testing.T) {
+		req := newRequest(`{"file": {"data": "` + dataURI + `", "name": "notes.txt", "label": "Notes"}}`)
+
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		err := filePlugin.FileController.Create(ctx)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, rec.Code)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal("notes.txt", resp.Record.Originalname)
+		assert.Equal("Notes", *resp.Record.Label)
+		assert.Equal(int64(len(content)), *resp.Record.Size)
+
+		storage := filePlugin.GetStorage(resp.Record.StorageName)
+		p, _ := storage.GetUploadPathFromFile("original", "", resp.Record)
+		data, err := os.ReadFile(filepath.Join("/tmp/_test_files", p))
+		assert.Nil(err)
+		assert.Equal(content, string(data))
+	})
+
+	t.Run("Should get the file name from the mime type", func(t *testing.T) {
+		assert.Equal("upload.png", dataURIFileName("", "image/png"))
+		assert.Equal("photo.jpg", dataURIFileName("../photo.jpg", "image/png"))
+	})
+
+	t.Run("Should return bad request with invalid data uri", func(t *testing.T) {
+		req := newRequest(`{"file": {"data": "data:text/plain,not-base64"}}`)
+
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		err := filePlugin.FileController.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should reject files larger than the limit", func(t *testing.T) {
+		maxSize := filePlugin.MaxDataURISize
+		filePlugin.MaxDataURISize = 5
+		defer func() { filePlugin.MaxDataURISize = maxSize }()
+
+		req := newRequest(`{"file": {"data": "` + dataURI + `"}}`)
+
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		err := filePlugin.FileController.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should reject large bodies before decoding", func(t *testing.T) {
+		maxSize := filePlugin.MaxDataURISize
+		filePlugin.MaxDataURISize = 5
+		defer func() { filePlugin.MaxDataURISize = maxSize }()
+
+		large := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 100*1024)))
+		req := newRequest(`{"file": {"data": "data:text/plain;base64,` + large + `"}}`)
+
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		err := filePlugin.FileController.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should only accept images in image endpoint", func(t *testing.T) {
+		req := newRequest(`{"image": {"data": "` + dataURI + `"}}`)
+
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		err := filePlugin.ImageController.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
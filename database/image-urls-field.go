@@ -15,6 +15,11 @@ func (j ImageURLsField) ToJSON() []byte {
 }
 
 func (j *ImageURLsField) Scan(value interface{}) error {
+	if value == nil {
+		*j = ImageURLsField{}
+		return nil
+	}
+
 	bytes, ok := value.([]byte)
 	if !ok {
 		return errors.New(fmt.Sprint("Failed to unmarshal ImageURLsField JSON value:", value))
@@ -0,0 +1,31 @@
+package files_database
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+// JSONField - Raw JSON column, saved as bytes to be read back from blob columns in all databases
+type JSONField []byte
+
+func (j JSONField) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return []byte(j), nil
+}
+
+func (j *JSONField) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[0:0], v...)
+	case string:
+		*j = append((*j)[0:0], v...)
+	default:
+		return errors.New("Invalid Scan Source")
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package files_database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// StyleSizesField - Size in bytes of each generated image style
+type StyleSizesField map[string]int64
+
+func (j *StyleSizesField) Scan(value interface{}) error {
+	if value == nil {
+		*j = StyleSizesField{}
+		return nil
+	}
+
+	var bytes []byte
+	switch v := value.(type) {
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New(fmt.Sprint("Failed to unmarshal StyleSizesField JSON value:", value))
+	}
+
+	if len(bytes) == 0 {
+		*j = StyleSizesField{}
+		return nil
+	}
+
+	return json.Unmarshal(bytes, j)
+}
+
+func (j StyleSizesField) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return []byte(`{}`), nil
+	}
+	return json.Marshal(j)
+}
+
+// Total - Sum of all style sizes
+func (j StyleSizesField) Total() int64 {
+	var total int64
+	for _, size := range j {
+		total += size
+	}
+	return total
+}
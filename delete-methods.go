@@ -0,0 +1,264 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	files_dtos "github.com/go-bolo/files/dtos"
+	"gorm.io/gorm"
+)
+
+// ErrStorageNotFound - The record storage is not configured, so its stored objects can not be deleted
+var ErrStorageNotFound = errors.New("storage not found")
+
+// DestroyError is returned when some stored objects of one record could not be deleted.
+// The record and its associations are kept so the deletion can be retried
+type DestroyError struct {
+	RecordID uint64
+	// Failures by style name
+	Failures map[string]error
+}
+
+func (e *DestroyError) Error() string {
+	styles := []string{}
+	for style := range e.Failures {
+		styles = append(styles, style)
+	}
+	sort.Strings(styles)
+
+	msgs := []string{}
+	for _, style := range styles {
+		msgs = append(msgs, style+": "+e.Failures[style].Error())
+	}
+
+	return fmt.Sprintf("error on delete stored objects of record %d: %s", e.RecordID, strings.Join(msgs, ", "))
+}
+
+// GetFailureMessages - Get failures as a style -> message map, useful for API responses
+func (e *DestroyError) GetFailureMessages() map[string]string {
+	msgs := map[string]string{}
+	for style, err := range e.Failures {
+		msgs[style] = err.Error()
+	}
+
+	return msgs
+}
+
+// DestroyFileRecord - Permanently delete one file with all stored objects and associations.
+// Stored objects are deleted first, then associations and record in one transaction, so a
+// failed call can be retried
+func DestroyFileRecord(app bolo.App, record *FileModel) error {
+	return destroyFileRecord(app, nil, record)
+}
+
+// destroyFileRecord - Permanently delete one file with the before and after delete events, ctx is nil
+// outside requests
+func destroyFileRecord(app bolo.App, ctx *bolo.RequestContext, record *FileModel) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	deleteEvent := DeleteEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeFile,
+		File:       record,
+		Permanent:  true,
+	}
+
+	err := triggerVetoEvent(app, EventBeforeDelete, &deleteEvent)
+	if err != nil {
+		return err
+	}
+
+	err = deleteStoredStyles(filePlugin.GetFileStorage(record), record, record.ID, "")
+	if err != nil {
+		return err
+	}
+
+	err = deleteStoredRevisions(app, AccessRecordTypeFile, record.ID, filePlugin.GetFileStorage(record), record, "")
+	if err != nil {
+		return err
+	}
+
+	err = app.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("fileId = ?", record.ID).Delete(&FileAssocsModel{}).Error
+		if err != nil {
+			return fmt.Errorf("DestroyFileRecord error on delete file assocs: %w", err)
+		}
+
+		err = deleteRecordTags(tx, AccessRecordTypeFile, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyFileRecord error on delete file tags: %w", err)
+		}
+
+		err = deleteRecordRevisions(tx, AccessRecordTypeFile, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyFileRecord error on delete file revisions: %w", err)
+		}
+
+		err = getSearchBackend().Remove(tx, AccessRecordTypeFile, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyFileRecord error on remove file from search index: %w", err)
+		}
+
+		err = tx.Unscoped().Delete(record).Error
+		if err != nil {
+			return fmt.Errorf("DestroyFileRecord error on delete file record: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	triggerAfterEvent(app, EventAfterDelete, &deleteEvent)
+
+	return nil
+}
+
+// DestroyImageRecord - Permanently delete one image with all stored styles and associations.
+// Stored objects are deleted first, then associations and record in one transaction, so a
+// failed call can be retried
+func DestroyImageRecord(app bolo.App, record *ImageModel) error {
+	return destroyImageRecord(app, nil, record)
+}
+
+// destroyImageRecord - Permanently delete one image with the before and after delete events, ctx is nil
+// outside requests
+func destroyImageRecord(app bolo.App, ctx *bolo.RequestContext, record *ImageModel) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	deleteEvent := DeleteEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeImage,
+		Image:      record,
+		Permanent:  true,
+	}
+
+	err := triggerVetoEvent(app, EventBeforeDelete, &deleteEvent)
+	if err != nil {
+		return err
+	}
+
+	err = deleteStoredStyles(filePlugin.GetImageStorage(record), record, record.ID, filePlugin.ImageFormat)
+	if err != nil {
+		return err
+	}
+
+	err = deleteStoredRevisions(app, AccessRecordTypeImage, record.ID, filePlugin.GetImageStorage(record), record, getImageStoredFormat(filePlugin, record))
+	if err != nil {
+		return err
+	}
+
+	err = app.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("imageId = ?", record.ID).Delete(&ImageAssocsModel{}).Error
+		if err != nil {
+			return fmt.Errorf("DestroyImageRecord error on delete image assocs: %w", err)
+		}
+
+		err = deleteRecordTags(tx, AccessRecordTypeImage, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyImageRecord error on delete image tags: %w", err)
+		}
+
+		err = deleteRecordRevisions(tx, AccessRecordTypeImage, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyImageRecord error on delete image revisions: %w", err)
+		}
+
+		err = getSearchBackend().Remove(tx, AccessRecordTypeImage, record.ID)
+		if err != nil {
+			return fmt.Errorf("DestroyImageRecord error on remove image from search index: %w", err)
+		}
+
+		err = tx.Unscoped().Delete(record).Error
+		if err != nil {
+			return fmt.Errorf("DestroyImageRecord error on delete image record: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	triggerAfterEvent(app, EventAfterDelete, &deleteEvent)
+
+	return nil
+}
+
+// trashFileRecord - Move one file to trash with the before and after delete events
+func trashFileRecord(ctx *bolo.RequestContext, record *FileModel) error {
+	deleteEvent := DeleteEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeFile,
+		File:       record,
+	}
+
+	err := triggerVetoEvent(ctx.App, EventBeforeDelete, &deleteEvent)
+	if err != nil {
+		return err
+	}
+
+	err = record.Delete()
+	if err != nil {
+		return err
+	}
+
+	triggerAfterEvent(ctx.App, EventAfterDelete, &deleteEvent)
+
+	return nil
+}
+
+// trashImageRecord - Move one image to trash with the before and after delete events
+func trashImageRecord(ctx *bolo.RequestContext, record *ImageModel) error {
+	deleteEvent := DeleteEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeImage,
+		Image:      record,
+	}
+
+	err := triggerVetoEvent(ctx.App, EventBeforeDelete, &deleteEvent)
+	if err != nil {
+		return err
+	}
+
+	err = record.Delete()
+	if err != nil {
+		return err
+	}
+
+	triggerAfterEvent(ctx.App, EventAfterDelete, &deleteEvent)
+
+	return nil
+}
+
+// delete all stored styles, returns a DestroyError with every style that failed. Without storage every
+// style fails, so the record is kept with its objects
+func deleteStoredStyles(storage Storager, file files_dtos.FileDTO, id uint64, format string) error {
+	failures := map[string]error{}
+
+	for style := range file.GetURLs() {
+		if style == "" {
+			continue
+		}
+
+		if storage == nil {
+			failures[style] = ErrStorageNotFound
+			continue
+		}
+
+		err := storage.DeleteImageStyle(file, style, format)
+		if err != nil {
+			failures[style] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &DestroyError{RecordID: id, Failures: failures}
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package files
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	files_database "github.com/go-bolo/files/database"
+	files_dtos "github.com/go-bolo/files/dtos"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStorageStub struct {
+	Storager
+	FailStyle string
+}
+
+func (s *failingStorageStub) DeleteImageStyle(file files_dtos.FileDTO, style, format string) error {
+	if style == s.FailStyle {
+		return errors.New("storage unavailable")
+	}
+	return nil
+}
+
+func TestDestroyImageRecord(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	cfg := NewImageFieldConfiguration("content", "destroy")
+
+	t.Run("Should delete stored styles, assocs and record", func(t *testing.T) {
+		storage := filePlugin.GetStorage("image")
+
+		record := GetImageModelStub()
+		record.StorageName = "image"
+		record.CreatedAt = time.Now()
+		record.SetURLs(files_database.ImageURLsField{
+			"original":  "original",
+			"thumbnail": "thumbnail",
+		})
+		err := record.Save()
+		assert.Nil(err)
+
+		err = AddImagesInFieldByIDs("31", []string{record.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		storedPaths := []string{}
+		for style := range record.URLs {
+			dest, _ := storage.GetUploadPathFromFile(style, "", &record)
+			storedPath := filepath.Join("/tmp/_test_files", dest)
+			os.MkdirAll(filepath.Dir(storedPath), os.ModePerm)
+			err = os.WriteFile(storedPath, []byte("image"), 0644)
+			assert.Nil(err)
+			storedPaths = append(storedPaths, storedPath)
+		}
+
+		err = DestroyImageRecord(app, &record)
+		assert.Nil(err)
+
+		for _, storedPath := range storedPaths {
+			_, err = os.Stat(storedPath)
+			assert.True(os.IsNotExist(err))
+		}
+
+		var count int64
+		app.GetDB().Unscoped().Model(&ImageModel{}).Where("id = ?", record.ID).Count(&count)
+		assert.Equal(int64(0), count)
+
+		app.GetDB().Model(&ImageAssocsModel{}).Where("imageId = ?", record.ID).Count(&count)
+		assert.Equal(int64(0), count)
+	})
+
+	t.Run("Should keep record and report failed styles", func(t *testing.T) {
+		filePlugin.SetStorage("failing", &failingStorageStub{FailStyle: "thumbnail"})
+
+		record := GetImageModelStub()
+		record.StorageName = "failing"
+		err := record.Save()
+		assert.Nil(err)
+
+		err = DestroyImageRecord(app, &record)
+		var destroyErr *DestroyError
+		assert.True(errors.As(err, &destroyErr))
+		assert.Equal(1, len(destroyErr.Failures))
+		assert.NotNil(destroyErr.Failures["thumbnail"])
+
+		found := ImageModel{}
+		err = ImageFindOne(record.GetIDString(), &found)
+		assert.Nil(err)
+		assert.Equal(record.ID, found.ID)
+	})
+
+	t.Run("Should delete the stored styles of images without storage name", func(t *testing.T) {
+		storage := filePlugin.GetStorage("image")
+
+		record := GetImageModelStub()
+		record.StorageName = ""
+		record.CreatedAt = time.Now()
+		err := record.Save()
+		assert.Nil(err)
+
+		dest, _ := storage.GetUploadPathFromFile("original", filePlugin.ImageFormat, &record)
+		storedPath := filepath.Join("/tmp/_test_files", dest)
+		os.MkdirAll(filepath.Dir(storedPath), os.ModePerm)
+		err = os.WriteFile(storedPath, []byte("image"), 0644)
+		assert.Nil(err)
+
+		err = DestroyImageRecord(app, &record)
+		assert.Nil(err)
+
+		_, err = os.Stat(storedPath)
+		assert.True(os.IsNotExist(err))
+	})
+
+	t.Run("Should keep the record if the storage is not configured", func(t *testing.T) {
+		imageStorageName := filePlugin.ImageStorageName
+		filePlugin.ImageStorageName = "missing"
+		defer func() { filePlugin.ImageStorageName = imageStorageName }()
+
+		record := GetImageModelStub()
+		record.StorageName = "missing"
+		err := record.Save()
+		assert.Nil(err)
+
+		err = DestroyImageRecord(app, &record)
+		var destroyErr *DestroyError
+		assert.True(errors.As(err, &destroyErr))
+		assert.ErrorIs(destroyErr.Failures["original"], ErrStorageNotFound)
+
+		found := ImageModel{}
+		err = ImageFindOne(record.GetIDString(), &found)
+		assert.Nil(err)
+	})
+}
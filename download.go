@@ -0,0 +1,84 @@
+package files
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+type downloadOptions struct {
+	Storage  Storager
+	File     files_dtos.FileDTO
+	Style    string
+	Format   string
+	FileName string
+	// Redirect to one signed url if the storage supports it
+	UseSignedURL bool
+	Expires      time.Duration
+}
+
+// sendDownload - Send one stored file with Content-Disposition. Use ?inline=true to show the file in
+// browser and ?filename= to change the downloaded file name
+func sendDownload(c echo.Context, opts *downloadOptions) error {
+	dispositionType := "attachment"
+	if c.QueryParam("inline") == "true" {
+		dispositionType = "inline"
+	}
+
+	fileName := opts.FileName
+	if override := files_helpers.SanitizeFileName(c.QueryParam("filename")); override != "" {
+		fileName = override
+	}
+	if fileName == "" {
+		fileName = opts.File.GetFileName()
+	}
+
+	disposition := files_helpers.ContentDisposition(dispositionType, fileName)
+
+	if signer, ok := opts.Storage.(SignedURLStorager); ok && opts.UseSignedURL {
+		objectPath, _ := opts.Storage.GetUploadPathFromFile(opts.Style, opts.Format, opts.File)
+
+		url, err := signer.GetSignedURL(c.Request().Context(), objectPath, &files_dtos.SignedURLOptions{
+			Expires:            opts.Expires,
+			ContentDisposition: disposition,
+		})
+		if err == nil {
+			return c.Redirect(http.StatusFound, url)
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"objectPath": objectPath,
+			"error":      err,
+		}).Warn("sendDownload error on get signed url, sending file through http")
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, disposition)
+
+	return opts.Storage.SendFileThroughHTTP(c, opts.File, opts.Style, opts.Format)
+}
+
+// getImageDownloadFileName - Get the original name with the extension of the stored image, images
+// are converted to the plugin ImageFormat on upload
+func getImageDownloadFileName(record *ImageModel) string {
+	return getDownloadFileNameWithExtension(record.Originalname, record.Extension)
+}
+
+// getDownloadFileNameWithExtension - Replace the name extension with the stored extension
+func getDownloadFileNameWithExtension(name string, extension *string) string {
+	if name == "" || extension == nil || *extension == "" {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if strings.EqualFold(strings.TrimPrefix(ext, "."), *extension) {
+		return name
+	}
+
+	return strings.TrimSuffix(name, ext) + "." + *extension
+}
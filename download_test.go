@@ -0,0 +1,102 @@
+package files
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+type signedURLStorageStub struct {
+	Storager
+}
+
+func (s *signedURLStorageStub) GetSignedURL(ctx context.Context, objectPath string, opts *files_dtos.SignedURLOptions) (string, error) {
+	return "https://storage.example.com/" + objectPath + "?disposition=" + opts.ContentDisposition, nil
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`attachment; filename="Contract.pdf"; filename*=UTF-8''Contract.pdf`, files_helpers.ContentDisposition("attachment", "Contract.pdf"))
+	assert.Equal(`inline; filename="Relat_rio _final_.pdf"; filename*=UTF-8''Relat%C3%B3rio%20%22final%22.pdf`, files_helpers.ContentDisposition("inline", `Relatório "final".pdf`))
+	assert.Equal(`attachment; filename="passwd"; filename*=UTF-8''passwd`, files_helpers.ContentDisposition("attachment", "../../etc/passwd"))
+	assert.Equal("attachment", files_helpers.ContentDisposition("attachment", ""))
+}
+
+func TestFileControllerDownload(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := NewFileController(&FileControllerConfiguration{App: app})
+	ctl.UseExternalFileURL = false
+
+	tmpFilePath := filepath.Join(os.TempDir(), "download-test.pdf")
+	err := os.WriteFile(tmpFilePath, []byte("pdf content"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	record := NewFileModel()
+	err = UploadFileFromLocalhost("Contrato de serviço.pdf", "", tmpFilePath, "file", record, app)
+	assert.Nil(err)
+	err = record.Save()
+	assert.Nil(err)
+
+	download := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file/"+record.GetIDString()+"/download"+query, nil)
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(record.GetIDString())
+
+		err := ctl.Download(ctx)
+		assert.Nil(err)
+
+		return rec
+	}
+
+	t.Run("Should send the file as attachment with the original name", func(t *testing.T) {
+		rec := download("")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("pdf content", rec.Body.String())
+		assert.Equal(`attachment; filename="Contrato de servi_o.pdf"; filename*=UTF-8''Contrato%20de%20servi%C3%A7o.pdf`, rec.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Should send inline with one file name override", func(t *testing.T) {
+		rec := download("?inline=true&filename=contract.pdf")
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal(`inline; filename="contract.pdf"; filename*=UTF-8''contract.pdf`, rec.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("Should redirect to signed urls with the Content-Disposition", func(t *testing.T) {
+		filePlugin.SetStorage("download-signed", &signedURLStorageStub{Storager: filePlugin.GetStorage("file")})
+		defer delete(filePlugin.Storages, "download-signed")
+
+		record.StorageName = "download-signed"
+		err := record.Save()
+		assert.Nil(err)
+
+		ctl.UseExternalFileURL = true
+		defer func() { ctl.UseExternalFileURL = false }()
+
+		rec := download("?filename=contract.pdf")
+		assert.Equal(http.StatusFound, rec.Code)
+		assert.Contains(rec.Header().Get("Location"), "https://storage.example.com/"+record.GetCreatedAt().Format("2006/01/02")+"/original/")
+		assert.Contains(rec.Header().Get("Location"), `disposition=attachment; filename="contract.pdf"`)
+	})
+
+	t.Run("Should use the stored image extension in image downloads", func(t *testing.T) {
+		ext := "webp"
+		image := ImageModel{Originalname: "photo.JPG", Extension: &ext}
+		assert.Equal("photo.webp", getImageDownloadFileName(&image))
+
+		ext = "jpg"
+		assert.Equal("photo.JPG", getImageDownloadFileName(&image))
+	})
+
+}
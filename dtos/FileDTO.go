@@ -12,3 +12,17 @@ type FileDTO interface {
 	GetUpdatedAt() *time.Time
 	GetURLs() files_database.ImageURLsField
 }
+
+// TenantFileDTO - Files of one tenant are stored with the tenant id as storage key prefix
+type TenantFileDTO interface {
+	GetTenantID() string
+}
+
+// GetTenantPathPrefix - Get the storage key prefix of the file tenant, like "tenant-a/"
+func GetTenantPathPrefix(file FileDTO) string {
+	if t, ok := file.(TenantFileDTO); ok && t.GetTenantID() != "" {
+		return t.GetTenantID() + "/"
+	}
+
+	return ""
+}
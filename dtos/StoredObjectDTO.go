@@ -0,0 +1,27 @@
+package files_dtos
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrObjectNotFound is returned by storages when one stored object doesn't exist
+var ErrObjectNotFound = errors.New("stored object not found")
+
+// StoredObject - One object saved in a storage backend
+type StoredObject struct {
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Optional attributes used to serve the object
+	ETag         string `json:"etag,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	CacheControl string `json:"cacheControl,omitempty"`
+}
+
+// SignedURLOptions - Options used by storages to create temporary signed urls
+type SignedURLOptions struct {
+	Expires time.Duration
+	// Content-Disposition returned by the storage when the url is accessed
+	ContentDisposition string
+}
@@ -0,0 +1,214 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-bolo/bolo"
+	"github.com/gookit/event"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Lifecycle events of files and images, use the On* helpers to listen with typed payloads
+const (
+	EventBeforeUpload       = "files-before-upload"
+	EventAfterUpload        = "files-after-upload"
+	EventStyleGenerated     = "files-style-generated"
+	EventBeforeDelete       = "files-before-delete"
+	EventAfterDelete        = "files-after-delete"
+	EventAssociationChanged = "files-association-changed"
+)
+
+// eventPayloadKey - Key of the typed payload in the event data
+const eventPayloadKey = "payload"
+
+// BeforeUploadEvent - Sent before one new file or image is processed and stored. Listeners can change the
+// file name, description, storage name and record fields, or return one error to reject the upload. The
+// local file can be changed in place
+type BeforeUploadEvent struct {
+	// AccessRecordTypeFile or AccessRecordTypeImage
+	RecordType string
+	// Set in file uploads
+	File *FileModel
+	// Set in image uploads
+	Image       *ImageModel
+	FileName    string
+	Description string
+	FilePath    string
+	// Must be one of the plugin storages. Replacements keep the record storage, so changes are ignored
+	StorageName string
+	// Set if the contents of one saved record are replaced or restored from one revision
+	Replace bool
+}
+
+// AfterUploadEvent - Sent after one new file or image is stored and saved
+type AfterUploadEvent struct {
+	// Nil outside requests
+	Ctx        *bolo.RequestContext
+	RecordType string
+	File       *FileModel
+	Image      *ImageModel
+	// Set if the contents of one saved record were replaced or restored from one revision
+	Replace bool
+}
+
+// StyleGeneratedEvent - Sent after one image style is generated and stored, the image URLs are updated
+// but may not be saved yet
+type StyleGeneratedEvent struct {
+	Image *ImageModel
+	Style string
+	// Size in bytes of the stored style
+	Size int64
+}
+
+// DeleteEvent - Sent before and after one file or image is moved to trash or permanently deleted.
+// Listeners of the before delete event can return one error to keep the record
+type DeleteEvent struct {
+	// Nil in background jobs like the trash and expired records purge
+	Ctx        *bolo.RequestContext
+	RecordType string
+	File       *FileModel
+	Image      *ImageModel
+	// Permanent deletes remove the stored objects, else the record is moved to trash
+	Permanent bool
+}
+
+// AssociationChangedEvent - Sent after files or images are added or removed from one model field
+type AssociationChangedEvent struct {
+	RecordType string
+	ModelName  string
+	Field      string
+	ModelID    string
+	// Ids of the new associated records
+	Added []uint64
+	// Ids of the records removed from the field
+	Removed []uint64
+}
+
+// OnBeforeUpload - Listen to the before upload event, return one error to reject the upload
+func OnBeforeUpload(app bolo.App, listener func(e *BeforeUploadEvent) error, priority ...int) {
+	onEvent(app, EventBeforeUpload, listener, priority)
+}
+
+// OnAfterUpload - Listen to the after upload event
+func OnAfterUpload(app bolo.App, listener func(e *AfterUploadEvent) error, priority ...int) {
+	onEvent(app, EventAfterUpload, listener, priority)
+}
+
+// OnStyleGenerated - Listen to the image style generated event
+func OnStyleGenerated(app bolo.App, listener func(e *StyleGeneratedEvent) error, priority ...int) {
+	onEvent(app, EventStyleGenerated, listener, priority)
+}
+
+// OnBeforeDelete - Listen to the before delete event, return one error to keep the record
+func OnBeforeDelete(app bolo.App, listener func(e *DeleteEvent) error, priority ...int) {
+	onEvent(app, EventBeforeDelete, listener, priority)
+}
+
+// OnAfterDelete - Listen to the after delete event
+func OnAfterDelete(app bolo.App, listener func(e *DeleteEvent) error, priority ...int) {
+	onEvent(app, EventAfterDelete, listener, priority)
+}
+
+// OnAssociationChanged - Listen to the association changed event
+func OnAssociationChanged(app bolo.App, listener func(e *AssociationChangedEvent) error, priority ...int) {
+	onEvent(app, EventAssociationChanged, listener, priority)
+}
+
+func onEvent[T any](app bolo.App, name string, listener func(e *T) error, priority []int) {
+	app.GetEvents().On(name, event.ListenerFunc(func(e event.Event) error {
+		payload, ok := e.Get(eventPayloadKey).(*T)
+		if !ok {
+			return nil
+		}
+
+		return listener(payload)
+	}), priority...)
+}
+
+func triggerEvent[T any](app bolo.App, name string, payload *T) error {
+	err, _ := app.GetEvents().Trigger(name, map[string]any{
+		eventPayloadKey: payload,
+	})
+	return err
+}
+
+// triggerVetoEvent - Trigger one before event, listener errors are sent as 400 Bad Request if they
+// aren't http errors
+func triggerVetoEvent[T any](app bolo.App, name string, payload *T) error {
+	err := triggerEvent(app, name, payload)
+	if err == nil {
+		return nil
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return err
+	}
+
+	return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+}
+
+// triggerAfterEvent - Trigger one after event, the action is already done so listener errors are only logged
+func triggerAfterEvent[T any](app bolo.App, name string, payload *T) {
+	err := triggerEvent(app, name, payload)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"event": name,
+			"error": err,
+		}).Error("files error on event listener")
+	}
+}
+
+func triggerFileAfterUpload(ctx *bolo.RequestContext, record *FileModel) {
+	triggerAfterEvent(ctx.App, EventAfterUpload, &AfterUploadEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeFile,
+		File:       record,
+	})
+}
+
+func triggerImageAfterUpload(ctx *bolo.RequestContext, record *ImageModel) {
+	triggerAfterEvent(ctx.App, EventAfterUpload, &AfterUploadEvent{
+		Ctx:        ctx,
+		RecordType: AccessRecordTypeImage,
+		Image:      record,
+	})
+}
+
+func triggerAfterReplace(ctx *bolo.RequestContext, file *FileModel, image *ImageModel) {
+	recordType := AccessRecordTypeFile
+	if image != nil {
+		recordType = AccessRecordTypeImage
+	}
+
+	triggerAfterEvent(ctx.App, EventAfterUpload, &AfterUploadEvent{
+		Ctx:        ctx,
+		RecordType: recordType,
+		File:       file,
+		Image:      image,
+		Replace:    true,
+	})
+}
+
+// triggerAssociationChanged - Trigger the association changed event if the field changed
+func triggerAssociationChanged(recordType, modelID string, cfg FieldConfigurationInterface, added, removed []uint64) {
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	app := bolo.GetApp()
+	if app == nil {
+		return
+	}
+
+	triggerAfterEvent(app, EventAssociationChanged, &AssociationChangedEvent{
+		RecordType: recordType,
+		ModelName:  cfg.GetModelName(),
+		Field:      cfg.GetFieldName(),
+		ModelID:    modelID,
+		Added:      added,
+		Removed:    removed,
+	})
+}
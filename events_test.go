@@ -0,0 +1,207 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	// listeners are kept in the app, so they only handle the records of this test
+	uploaded := []*AfterUploadEvent{}
+	deleted := []*DeleteEvent{}
+	associations := []*AssociationChangedEvent{}
+
+	OnBeforeUpload(app, func(e *BeforeUploadEvent) error {
+		if !strings.HasPrefix(e.FileName, "events-") {
+			return nil
+		}
+		if e.FileName == "events-blocked.exe" {
+			return errors.New("executable files are not allowed")
+		}
+		if e.FileName == "events-unknown-storage.csv" {
+			e.StorageName = "unknown"
+			return nil
+		}
+
+		e.Description = "checked"
+		e.File.Label = getOptionalString("events")
+		return nil
+	})
+
+	OnAfterUpload(app, func(e *AfterUploadEvent) error {
+		if e.File != nil && strings.HasPrefix(e.File.Originalname, "events-") {
+			uploaded = append(uploaded, e)
+		}
+		return nil
+	})
+
+	OnBeforeDelete(app, func(e *DeleteEvent) error {
+		if e.File == nil || e.File.Label == nil || *e.File.Label != "events" {
+			return nil
+		}
+		if !e.Permanent {
+			return echo.NewHTTPError(http.StatusConflict, "locked")
+		}
+		return nil
+	})
+
+	OnAfterDelete(app, func(e *DeleteEvent) error {
+		if e.File != nil && e.File.Label != nil && *e.File.Label == "events" {
+			deleted = append(deleted, e)
+		}
+		return nil
+	})
+
+	OnAssociationChanged(app, func(e *AssociationChangedEvent) error {
+		if e.ModelName == "events" {
+			associations = append(associations, e)
+		}
+		return nil
+	})
+
+	upload := func(fileName string) (*FileModel, error) {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		w.WriteField("description", "original")
+		part, _ := w.CreateFormFile("file", fileName)
+		part.Write([]byte("a,b,c"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := ctl.UploadFile(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record, nil
+	}
+
+	deleteFile := func(record *FileModel, permanent bool) error {
+		url := "/api/v1/file/" + record.GetIDString()
+		if permanent {
+			url += "?permanent=true"
+		}
+
+		req := httptest.NewRequest(http.MethodDelete, url, nil)
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(record.GetIDString())
+
+		return ctl.Delete(ctx)
+	}
+
+	var record *FileModel
+
+	t.Run("Should change or reject uploads in before upload listeners", func(t *testing.T) {
+		var err error
+		record, err = upload("events-report.csv")
+		assert.Nil(err)
+		assert.Equal("checked", *record.Description)
+		assert.Equal("events", *record.Label)
+
+		assert.Len(uploaded, 1)
+		assert.Equal(record.ID, uploaded[0].File.ID)
+		assert.Equal(AccessRecordTypeFile, uploaded[0].RecordType)
+		assert.NotNil(uploaded[0].Ctx)
+
+		_, err = upload("events-blocked.exe")
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Len(uploaded, 1)
+
+		// storages changed to unknown names are errors
+		_, err = upload("events-unknown-storage.csv")
+		assert.Equal(http.StatusInternalServerError, err.(*echo.HTTPError).Code)
+		assert.Len(uploaded, 1)
+	})
+
+	t.Run("Should send the upload events on content replacements", func(t *testing.T) {
+		tmpFilePath := filepath.Join(os.TempDir(), "events-replace.csv")
+		err := os.WriteFile(tmpFilePath, []byte("d,e,f"), 0644)
+		assert.Nil(err)
+		defer os.Remove(tmpFilePath)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/file", nil)
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+
+		_, err = ReplaceFileContents(ctx, record, "events-blocked.exe", tmpFilePath)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+		assert.Len(uploaded, 1)
+
+		revisions, err := GetRecordRevisions(app.GetDB(), AccessRecordTypeFile, record.ID)
+		assert.Nil(err)
+		assert.Empty(revisions)
+
+		_, err = ReplaceFileContents(ctx, record, "events-report-v2.csv", tmpFilePath)
+		assert.Nil(err)
+
+		assert.Len(uploaded, 2)
+		assert.True(uploaded[1].Replace)
+		assert.Equal(record.ID, uploaded[1].File.ID)
+		assert.False(uploaded[0].Replace)
+	})
+
+	t.Run("Should send the association changes", func(t *testing.T) {
+		other := GetFileModelStub()
+		err := other.Save()
+		assert.Nil(err)
+
+		cfg := NewFileFieldConfiguration("events", "attachments")
+		err = AddFilesInFieldByIDs("5", []string{record.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		err = UpdateFieldFilesById("5", []string{other.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		// unchanged fields don't send events
+		err = RemoveFilesFromFieldByIds("5", []string{record.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		assert.Len(associations, 2)
+		assert.Equal([]uint64{record.ID}, associations[0].Added)
+		assert.Empty(associations[0].Removed)
+		assert.Equal("attachments", associations[1].Field)
+		assert.Equal("5", associations[1].ModelID)
+		assert.Equal([]uint64{other.ID}, associations[1].Added)
+		assert.Equal([]uint64{record.ID}, associations[1].Removed)
+	})
+
+	t.Run("Should keep records rejected in before delete listeners", func(t *testing.T) {
+		err := deleteFile(record, false)
+		assert.Equal(http.StatusConflict, err.(*echo.HTTPError).Code)
+		assert.Empty(deleted)
+
+		found := FileModel{}
+		err = FileFindOne(record.GetIDString(), &found)
+		assert.Nil(err)
+
+		err = deleteFile(record, true)
+		assert.Nil(err)
+
+		assert.Len(deleted, 1)
+		assert.True(deleted[0].Permanent)
+		assert.Equal(record.ID, deleted[0].File.ID)
+		assert.NotNil(deleted[0].Ctx)
+	})
+}
@@ -0,0 +1,167 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRecordExpired    = errors.New("record expired")
+	ErrInvalidExpiresAt = errors.New("expiresAt should be one future date in RFC 3339 format")
+)
+
+var expiredPurgeBatchSize = 100
+
+// NotExpiredScope - Gorm scope to hide expired files or images, table is the files or images table name
+func NotExpiredScope(table string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("("+table+".expiresAt IS NULL OR "+table+".expiresAt > ?)", time.Now())
+	}
+}
+
+func isExpired(expiresAt *time.Time) bool {
+	return expiresAt != nil && !expiresAt.After(time.Now())
+}
+
+// IsExpired - Expired files are hidden and deleted by the expiration purge job
+func (m *FileModel) IsExpired() bool {
+	return isExpired(m.ExpiresAt)
+}
+
+// IsExpired - Expired images are hidden and deleted by the expiration purge job
+func (m *ImageModel) IsExpired() bool {
+	return isExpired(m.ExpiresAt)
+}
+
+// expiredHTTPError - Expired records are sent as 410 Gone until they are purged
+func expiredHTTPError() error {
+	return echo.NewHTTPError(http.StatusGone, ErrRecordExpired.Error())
+}
+
+// parseExpiresAt - Parse the expiresAt of one upload, empty values don't expire
+func parseExpiresAt(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil || !expiresAt.After(time.Now()) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, ErrInvalidExpiresAt.Error())
+	}
+
+	return &expiresAt, nil
+}
+
+// PurgeExpired - Permanently delete all files and images expired before expiredBefore, including trashed
+// records, the stored objects and associations
+func PurgeExpired(app bolo.App, expiredBefore time.Time) error {
+	err := purgeExpiredFiles(app, expiredBefore)
+	if err != nil {
+		return fmt.Errorf("PurgeExpired: %w", err)
+	}
+
+	err = purgeExpiredImages(app, expiredBefore)
+	if err != nil {
+		return fmt.Errorf("PurgeExpired: %w", err)
+	}
+
+	return nil
+}
+
+func purgeExpiredFiles(app bolo.App, expiredBefore time.Time) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		var records []FileModel
+		err := db.Unscoped().
+			Where("expiresAt IS NOT NULL AND expiresAt <= ? AND id > ?", expiredBefore, lastID).
+			Order("id ASC").
+			Limit(expiredPurgeBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("error on find expired files: %w", err)
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+
+			err = DestroyFileRecord(app, record)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"id":    record.ID,
+					"error": err,
+				}).Error("purgeExpiredFiles error on destroy file")
+			}
+		}
+
+		if len(records) < expiredPurgeBatchSize {
+			return nil
+		}
+	}
+}
+
+func purgeExpiredImages(app bolo.App, expiredBefore time.Time) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		var records []ImageModel
+		err := db.Unscoped().
+			Where("expiresAt IS NOT NULL AND expiresAt <= ? AND id > ?", expiredBefore, lastID).
+			Order("id ASC").
+			Limit(expiredPurgeBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("error on find expired images: %w", err)
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+
+			err = DestroyImageRecord(app, record)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"id":    record.ID,
+					"error": err,
+				}).Error("purgeExpiredImages error on destroy image")
+			}
+		}
+
+		if len(records) < expiredPurgeBatchSize {
+			return nil
+		}
+	}
+}
+
+// StartExpiredPurgeJob - Run PurgeExpired in background every ExpiredPurgeInterval
+func (p *FilePlugin) StartExpiredPurgeJob(app bolo.App) {
+	if p.ExpiredPurgeInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.ExpiredPurgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := PurgeExpired(app, time.Now())
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": fmt.Sprintf("%+v\n", err),
+				}).Error("FilePlugin.StartExpiredPurgeJob error on purge expired records")
+			}
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpiration(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	saveFile := func(expiresAt *time.Time) *FileModel {
+		record := GetFileModelStub()
+		record.ExpiresAt = expiresAt
+		err := record.Save()
+		assert.Nil(err)
+		return &record
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	t.Run("Should set the expiration in uploads", func(t *testing.T) {
+		upload := func(expiresAt string) (*httptest.ResponseRecorder, error) {
+			body := bytes.Buffer{}
+			w := multipart.NewWriter(&body)
+			w.WriteField("expiresAt", expiresAt)
+			part, _ := w.CreateFormFile("file", "export.csv")
+			part.Write([]byte("a,b,c"))
+			w.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+			ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+			return rec, ctl.UploadFile(ctx)
+		}
+
+		rec, err := upload(future.Format(time.RFC3339))
+		assert.Nil(err)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal(future.Unix(), resp.Record.ExpiresAt.Unix())
+
+		_, err = upload("tomorrow")
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		_, err = upload(past.Format(time.RFC3339))
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should hide expired files from queries and send them as gone", func(t *testing.T) {
+		expired := saveFile(&past)
+		temporary := saveFile(&future)
+		permanent := saveFile(nil)
+
+		cfg := NewFileFieldConfiguration("content", "expiration")
+		err := AddFilesInFieldByIDs("31", []string{expired.GetIDString(), temporary.GetIDString(), permanent.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		files, err := GetFilesInField("content", "expiration", "31", 10)
+		assert.Nil(err)
+		ids := []uint64{}
+		for _, f := range files {
+			ids = append(ids, f.ID)
+		}
+		assert.ElementsMatch([]uint64{temporary.ID, permanent.ID}, ids)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file?limit=1000", nil)
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		err = ctl.Query(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		ids = []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		assert.NotContains(ids, expired.ID)
+		assert.Contains(ids, temporary.ID)
+
+		for _, handler := range []func(c echo.Context) error{ctl.FindOne, ctl.Download} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/file/"+expired.GetIDString(), nil)
+			ctx, _ := GetRequestContextStub(app, req, "administrator")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(expired.GetIDString())
+
+			err = handler(ctx)
+			assert.Equal(http.StatusGone, err.(*echo.HTTPError).Code)
+		}
+	})
+
+	t.Run("Should keep the expiration in updates", func(t *testing.T) {
+		temporary := saveFile(&future)
+
+		for _, expiresAt := range []string{"null", `"` + past.Format(time.RFC3339) + `"`} {
+			body := `{"file": {"description": "updated", "size": 1, "expiresAt": ` + expiresAt + `}}`
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/file/"+temporary.GetIDString(), strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			ctx, _ := GetRequestContextStub(app, req, "administrator")
+			ctx.SetParamNames("id")
+			ctx.SetParamValues(temporary.GetIDString())
+
+			err := ctl.Update(ctx)
+			assert.Nil(err)
+
+			found := FileModel{}
+			err = FileFindOne(temporary.GetIDString(), &found)
+			assert.Nil(err)
+			assert.Equal("updated", *found.Description)
+			assert.Equal(future.Unix(), found.ExpiresAt.Unix())
+			assert.Equal(*temporary.Size, *found.Size)
+		}
+	})
+
+	t.Run("Should purge expired files and images", func(t *testing.T) {
+		expired := saveFile(&past)
+		trashed := saveFile(&past)
+		err := trashed.Delete()
+		assert.Nil(err)
+		temporary := saveFile(&future)
+
+		image := GetImageModelStub()
+		image.ExpiresAt = &past
+		err = image.Save()
+		assert.Nil(err)
+
+		err = PurgeExpired(app, time.Now())
+		assert.Nil(err)
+
+		var count int64
+		err = app.GetDB().Unscoped().Model(&FileModel{}).Where("id IN ?", []uint64{expired.ID, trashed.ID}).Count(&count).Error
+		assert.Nil(err)
+		assert.Equal(int64(0), count)
+
+		err = app.GetDB().Unscoped().Model(&ImageModel{}).Where("id = ?", image.ID).Count(&count).Error
+		assert.Nil(err)
+		assert.Equal(int64(0), count)
+
+		found := FileModel{}
+		err = FileFindOne(temporary.GetIDString(), &found)
+		assert.Nil(err)
+		assert.False(found.IsExpired())
+	})
+}
@@ -0,0 +1,122 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+const (
+	FacetTag         = "tag"
+	FacetMime        = "mime"
+	FacetOrientation = "orientation"
+
+	ImageOrientationLandscape = "landscape"
+	ImageOrientationPortrait  = "portrait"
+	ImageOrientationSquare    = "square"
+	// images uploaded before dimensions were saved
+	ImageOrientationUnknown = "unknown"
+
+	// max values returned in the tag facet
+	maxTagFacetValues = 100
+)
+
+const imageOrientationSQL = "CASE WHEN width = 0 OR height = 0 THEN 'unknown' WHEN width > height THEN 'landscape' WHEN width < height THEN 'portrait' ELSE 'square' END"
+
+// FacetValue - Records count of one facet value, tag facets also have the tag id and name
+type FacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	ID    uint64 `json:"id,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// QueryListMeta - Meta of file and image lists, with the cursors of the pages around the list and the facets
+// requested with ?facets=tag,mime,orientation
+type QueryListMeta struct {
+	bolo.BaseMetaResponse
+	QueryCursors
+	Facets map[string][]*FacetValue `json:"facets,omitempty"`
+}
+
+// getRequestedFacets - Get the valid facets from ?facets=, orientation is only available for images
+func getRequestedFacets(ctx *bolo.RequestContext, recordType string) []string {
+	facets := []string{}
+
+	for _, facet := range strings.Split(ctx.QueryParam("facets"), ",") {
+		switch strings.TrimSpace(facet) {
+		case FacetTag:
+			facets = append(facets, FacetTag)
+		case FacetMime:
+			facets = append(facets, FacetMime)
+		case FacetOrientation:
+			if recordType == AccessRecordTypeImage {
+				facets = append(facets, FacetOrientation)
+			}
+		}
+	}
+
+	return facets
+}
+
+// getFacets - Count the records of the filtered query by facet value. The query is the count query, so facet
+// counts use the same filters as the list count
+func getFacets(query *gorm.DB, model interface{}, recordType string, facets []string) (map[string][]*FacetValue, error) {
+	result := map[string][]*FacetValue{}
+
+	for _, facet := range facets {
+		values := []*FacetValue{}
+		base := query.Session(&gorm.Session{}).Model(model)
+
+		var err error
+
+		switch facet {
+		case FacetTag:
+			table, column := getTagTable(recordType)
+			err = bolo.GetDefaultDatabaseConnection().
+				Table(table).
+				Select("mediatags.id AS id, mediatags.slug AS value, mediatags.name AS label, COUNT(*) AS count").
+				Joins("INNER JOIN mediatags ON mediatags.id = "+table+".tagId").
+				Where(table+"."+column+" IN (?)", base.Select("id")).
+				Group("mediatags.id, mediatags.slug, mediatags.name").
+				Order("count DESC").
+				Order("mediatags.slug ASC").
+				Limit(maxTagFacetValues).
+				Scan(&values).Error
+		case FacetMime:
+			err = base.
+				Select("COALESCE(mime, '') AS value, COUNT(*) AS count").
+				Group("COALESCE(mime, '')").
+				Order("count DESC").
+				Scan(&values).Error
+		case FacetOrientation:
+			err = base.
+				Select(imageOrientationSQL + " AS value, COUNT(*) AS count").
+				Group(imageOrientationSQL).
+				Order("count DESC").
+				Scan(&values).Error
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("getFacets error on count %s facet: %w", facet, err)
+		}
+
+		result[facet] = values
+	}
+
+	return result, nil
+}
+
+// applyOrientationSelector - Filter image queries with ?orientation=landscape|portrait|square|unknown
+func applyOrientationSelector(ctx *bolo.RequestContext, query *gorm.DB) *gorm.DB {
+	orientation := ctx.QueryParam("orientation")
+
+	switch orientation {
+	case ImageOrientationLandscape, ImageOrientationPortrait, ImageOrientationSquare, ImageOrientationUnknown:
+		return query.Where(imageOrientationSQL+" = ?", orientation)
+	}
+
+	return query
+}
@@ -0,0 +1,175 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+// FolderItemsRequest - Files, images and folders moved or copied to one folder, copies only support files and images
+type FolderItemsRequest struct {
+	FileIDs   []string `json:"fileIds"`
+	ImageIDs  []string `json:"imageIds"`
+	FolderIDs []string `json:"folderIds"`
+}
+
+func (r *FolderItemsRequest) Len() int {
+	return len(r.FileIDs) + len(r.ImageIDs) + len(r.FolderIDs)
+}
+
+type FolderMoveResult struct {
+	Files   int64 `json:"files"`
+	Images  int64 `json:"images"`
+	Folders int64 `json:"folders"`
+}
+
+type FolderCopyResult struct {
+	Files  []*FileModel  `json:"files"`
+	Images []*ImageModel `json:"images"`
+}
+
+// MoveRecordsToFolder - Set the folder of files or images in one query, nil folderID moves them to the root
+func MoveRecordsToFolder(db *gorm.DB, model interface{}, ids []uint64, folderID *uint64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	r := db.Model(model).Where("id IN ?", ids).Update("folderId", folderID)
+
+	return r.RowsAffected, r.Error
+}
+
+// downloadOriginalObject - Save the original object of one record in one local tmp file, remove it after use
+func downloadOriginalObject(ctx context.Context, storage Storager, objectPath string) (string, error) {
+	objects, ok := storage.(ObjectStorager)
+	if !ok {
+		return "", fmt.Errorf("storage can't open objects")
+	}
+
+	r, err := objects.OpenObject(ctx, objectPath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	tmpFile, err := os.CreateTemp("", "files-copy-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmpFile.Close()
+
+	_, err = io.Copy(tmpFile, r)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// CopyFileToFolder - Create one new file with a copy of the record original object. The copy is owned by the
+// request user and is saved in the request tenant
+func CopyFileToFolder(ctx *bolo.RequestContext, record *FileModel, folderID *uint64) (*FileModel, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	storage := filePlugin.GetFileStorage(record)
+
+	objectPath, _ := storage.GetUploadPathFromFile("original", "", record)
+
+	tmpFilePath, err := downloadOriginalObject(ctx.Request().Context(), storage, objectPath)
+	if err != nil {
+		return nil, fmt.Errorf("CopyFileToFolder error on download file %d: %w", record.ID, err)
+	}
+	defer os.Remove(tmpFilePath)
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	newFile := NewFileModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	description := ""
+	if record.Description != nil {
+		description = *record.Description
+	}
+
+	err = UploadFileFromLocalhost(record.Originalname, description, tmpFilePath, filePlugin.GetTenantFileStorageName(newFile.TenantID), newFile, ctx.App)
+	if err != nil {
+		return nil, err
+	}
+
+	newFile.Label = record.Label
+	newFile.FolderID = folderID
+	newFile.ExpiresAt = record.ExpiresAt
+
+	err = newFile.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	triggerFileAfterUpload(ctx, newFile)
+
+	return newFile, nil
+}
+
+// CopyImageToFolder - Create one new image with a copy of the record original object, the styles of the copy
+// are generated again
+func CopyImageToFolder(ctx *bolo.RequestContext, record *ImageModel, folderID *uint64) (*ImageModel, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	storage := filePlugin.GetStorage(record.StorageName)
+	if storage == nil {
+		storage = filePlugin.GetStorage(filePlugin.ImageStorageName)
+	}
+
+	objectPath, _ := storage.GetUploadPathFromFile("original", filePlugin.ImageFormat, record)
+
+	tmpFilePath, err := downloadOriginalObject(ctx.Request().Context(), storage, objectPath)
+	if err != nil {
+		return nil, fmt.Errorf("CopyImageToFolder error on download image %d: %w", record.ID, err)
+	}
+	defer os.Remove(tmpFilePath)
+
+	err = checkUploadQuota(ctx, tmpFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	newFile := NewImageModel()
+	newFile.CreatorID = getCreatorID(ctx)
+	newFile.TenantID, err = getTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	description := ""
+	if record.Description != nil {
+		description = *record.Description
+	}
+
+	err = UploadImageFromLocalhost(record.Originalname, description, tmpFilePath, filePlugin.GetTenantImageStorageName(newFile.TenantID), newFile, ctx.App)
+	if err != nil {
+		return nil, err
+	}
+
+	newFile.Label = record.Label
+	newFile.FolderID = folderID
+	newFile.ExpiresAt = record.ExpiresAt
+
+	err = newFile.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	triggerImageAfterUpload(ctx, newFile)
+
+	return newFile, nil
+}
@@ -0,0 +1,324 @@
+package files
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+const (
+	// FolderVisibilityInherit - Use the parent folder visibility, root folders are public
+	FolderVisibilityInherit = "inherit"
+	FolderVisibilityPublic  = "public"
+	// FolderVisibilityPrivate - Folder, sub folders and records are only found by the folder creator and
+	// by users with the find_any_folder permission
+	FolderVisibilityPrivate = "private"
+)
+
+var (
+	ErrFolderInvalidVisibility = errors.New("folder visibility should be inherit, public or private")
+	ErrFolderInvalidName       = errors.New("folder name is required")
+	ErrFolderInvalidParent     = errors.New("folder can't be moved to itself or to one of its sub folders")
+	ErrFolderNotEmpty          = errors.New("folder has sub folders, files or images")
+)
+
+func NewFolderModel() *FolderModel {
+	return &FolderModel{
+		Visibility: FolderVisibilityInherit,
+		CreatedAt:  time.Now(),
+	}
+}
+
+// FolderModel - Folder to organize files and images, folders without parent are in the library root
+type FolderModel struct {
+	ID          uint64  `gorm:"column:id;primary_key" json:"id" filter:"param:id;type:number"`
+	Name        string  `gorm:"column:name;type:varchar(255);not null" json:"name" filter:"param:name;type:string"`
+	Description *string `gorm:"column:description;type:text" json:"description" filter:"param:description;type:string"`
+	ParentID    *uint64 `gorm:"column:parentId;index" json:"parentId" filter:"param:parentId;type:number"`
+	// Ids of the ancestors and of the folder, like /1/5/9/, used to query folder trees
+	Path                string    `gorm:"column:path;type:varchar(767);not null;default:'';index" json:"path"`
+	Visibility          string    `gorm:"column:visibility;type:varchar(20);not null;default:'inherit'" json:"visibility" filter:"param:visibility;type:string"`
+	EffectiveVisibility string    `gorm:"column:effectiveVisibility;type:varchar(20);not null;default:'public'" json:"effectiveVisibility"`
+	CreatorID           *int64    `gorm:"column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
+	TenantID            string    `gorm:"column:tenantId;type:varchar(100);not null;default:''" json:"-"`
+	CreatedAt           time.Time `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
+	UpdatedAt           time.Time `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
+}
+
+// TableName get sql table name
+func (m *FolderModel) TableName() string {
+	return "folders"
+}
+
+func (m *FolderModel) GetIDString() string {
+	return strconv.FormatInt(int64(m.ID), 10)
+}
+
+func (m *FolderModel) ToJSON() string {
+	jsonString, _ := json.MarshalIndent(m, "", "  ")
+	return string(jsonString)
+}
+
+// IsPrivate - Check if the folder is private, with own or inherited visibility
+func (m *FolderModel) IsPrivate() bool {
+	return m.EffectiveVisibility == FolderVisibilityPrivate
+}
+
+// Contains - Check if the folder is this folder or one of its sub folders
+func (m *FolderModel) Contains(folder *FolderModel) bool {
+	return folder.ID == m.ID || (m.Path != "" && strings.HasPrefix(folder.Path, m.Path))
+}
+
+// Save - Create or update the folder. The path and the effective visibility of the folder and of its sub
+// folders are updated in the same transaction, so parent and visibility changes are applied to the tree
+func (m *FolderModel) Save() error {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return saveFolder(tx, m)
+	})
+}
+
+// saveFolder - Validate and save the folder tree in one transaction
+func saveFolder(tx *gorm.DB, m *FolderModel) error {
+	if strings.TrimSpace(m.Name) == "" {
+		return ErrFolderInvalidName
+	}
+
+	if m.Visibility == "" {
+		m.Visibility = FolderVisibilityInherit
+	}
+
+	if m.Visibility != FolderVisibilityInherit && m.Visibility != FolderVisibilityPublic && m.Visibility != FolderVisibilityPrivate {
+		return ErrFolderInvalidVisibility
+	}
+
+	var parent *FolderModel
+	if m.ParentID != nil {
+		parent = &FolderModel{}
+		err := tx.Where("id = ? AND tenantId = ?", *m.ParentID, m.TenantID).First(parent).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrFolderInvalidParent
+			}
+			return err
+		}
+
+		if m.ID != 0 && m.Contains(parent) {
+			return ErrFolderInvalidParent
+		}
+	}
+
+	if m.ID == 0 {
+		err := tx.Create(m).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return updateFolderTree(tx, m, parent)
+}
+
+// Delete - Delete one empty folder, folders with sub folders or records return ErrFolderNotEmpty.
+// Trashed records keep the folder id and are moved to the library root when restored
+func (m *FolderModel) Delete() error {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&FolderModel{}, &FileModel{}, &ImageModel{}} {
+			column := "folderId"
+			if _, ok := model.(*FolderModel); ok {
+				column = "parentId"
+			}
+
+			var count int64
+			err := tx.Model(model).Where(column+" = ?", m.ID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+
+			if count > 0 {
+				return ErrFolderNotEmpty
+			}
+		}
+
+		for _, model := range []interface{}{&FileModel{}, &ImageModel{}} {
+			err := tx.Unscoped().Model(model).Where("folderId = ?", m.ID).Update("folderId", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(m).Error
+	})
+}
+
+// getFolderEffectiveVisibility - Resolve the inherited visibility with the parent folder
+func getFolderEffectiveVisibility(visibility string, parent *FolderModel) string {
+	if visibility != FolderVisibilityInherit {
+		return visibility
+	}
+
+	if parent == nil {
+		return FolderVisibilityPublic
+	}
+
+	return parent.EffectiveVisibility
+}
+
+// updateFolderTree - Save the folder with the path and visibility from the parent and update its sub folders
+func updateFolderTree(tx *gorm.DB, folder *FolderModel, parent *FolderModel) error {
+	oldPath := folder.Path
+
+	folder.Path = "/" + folder.GetIDString() + "/"
+	if parent != nil {
+		folder.Path = parent.Path + folder.GetIDString() + "/"
+	}
+	folder.EffectiveVisibility = getFolderEffectiveVisibility(folder.Visibility, parent)
+
+	err := tx.Save(folder).Error
+	if err != nil {
+		return err
+	}
+
+	if oldPath == "" {
+		return nil
+	}
+
+	var children []*FolderModel
+	err = tx.
+		Where("path LIKE ? AND id <> ?", oldPath+"%", folder.ID).
+		Find(&children).Error
+	if err != nil {
+		return err
+	}
+
+	// parents are updated before their sub folders
+	sort.Slice(children, func(i, j int) bool {
+		return strings.Count(children[i].Path, "/") < strings.Count(children[j].Path, "/")
+	})
+
+	updated := map[uint64]*FolderModel{folder.ID: folder}
+
+	for _, child := range children {
+		p := updated[*child.ParentID]
+		if p == nil {
+			continue
+		}
+
+		child.Path = p.Path + child.GetIDString() + "/"
+		child.EffectiveVisibility = getFolderEffectiveVisibility(child.Visibility, p)
+
+		err = tx.Model(child).Updates(map[string]interface{}{
+			"path":                child.Path,
+			"effectiveVisibility": child.EffectiveVisibility,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		updated[child.ID] = child
+	}
+
+	return nil
+}
+
+// FolderFindOne - Find one folder record by id
+func FolderFindOne(id string, record *FolderModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
+
+	return db.Where("id = ?", id).First(record).Error
+}
+
+// requestFolderFindOne - Find one folder in the request tenant
+func requestFolderFindOne(ctx *bolo.RequestContext, id string, record *FolderModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return FolderFindOne(id, record, scope)
+}
+
+// canFindFolder - Private folders are only found by the creator and by users with find_any_folder
+func canFindFolder(ctx *bolo.RequestContext, folder *FolderModel) bool {
+	if !folder.IsPrivate() || ctx.Can("find_any_folder") {
+		return true
+	}
+
+	return isRecordCreator(ctx, folder.CreatorID)
+}
+
+// checkFolderVisibility - Check if the request can find the records of one folder
+func checkFolderVisibility(ctx *bolo.RequestContext, folderID *uint64) (bool, error) {
+	if folderID == nil || ctx.Can("find_any_folder") {
+		return true, nil
+	}
+
+	folder := FolderModel{}
+	err := FolderFindOne(strconv.FormatUint(*folderID, 10), &folder)
+	if err != nil {
+		// records of deleted folders are in the root
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return canFindFolder(ctx, &folder), nil
+}
+
+// getHiddenFoldersQuery - Query with the ids of the private folders the request can't find
+func getHiddenFoldersQuery(ctx *bolo.RequestContext) *gorm.DB {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	query := db.Model(&FolderModel{}).
+		Select("id").
+		Where("effectiveVisibility = ?", FolderVisibilityPrivate)
+
+	if userID := getAuthenticatedUserID(ctx); userID != "" {
+		query = query.Where("creatorId IS NULL OR creatorId <> ?", userID)
+	}
+
+	return query
+}
+
+// scopeQueryByFolderVisibility - Remove records of private folders from one file or image query
+func scopeQueryByFolderVisibility(ctx *bolo.RequestContext, query *gorm.DB) *gorm.DB {
+	if ctx.Can("find_any_folder") {
+		return query
+	}
+
+	return query.Where("folderId IS NULL OR folderId NOT IN (?)", getHiddenFoldersQuery(ctx))
+}
+
+// applyFolderSelector - Filter queries with ?inFolder=<id> to the records of the folder and of its sub folders,
+// direct children are filtered with ?folderId=<id> and the root with ?folderId_is-null=true
+func applyFolderSelector(ctx *bolo.RequestContext, query *gorm.DB) (*gorm.DB, error) {
+	inFolder := ctx.QueryParam("inFolder")
+	if inFolder == "" {
+		return query, nil
+	}
+
+	folder := FolderModel{}
+	err := requestFolderFindOne(ctx, inFolder, &folder)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return query.Where("1 = 0"), nil
+		}
+		return nil, err
+	}
+
+	db := bolo.GetDefaultDatabaseConnection()
+
+	return query.Where("folderId IN (?)", db.Model(&FolderModel{}).
+		Select("id").
+		Where("path LIKE ?", folder.Path+"%"),
+	), nil
+}
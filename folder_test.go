@@ -0,0 +1,231 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/acl"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolders(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FolderController
+
+	role, _ := acl.NewRole(&acl.NewRoleOpts{Name: "folder-tester", Permissions: []string{"find_file", "find_any_file", "find_folder"}})
+	app.SetRole("folder-tester", *role)
+
+	newCtx := func(method, url, body, userID string, roles ...string) (*bolo.RequestContext, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		ctx, rec := GetRequestContextStub(app, req, roles...)
+		if userID != "" {
+			ctx.IsAuthenticated = true
+			ctx.AuthenticatedUser = &UserStub{ID: userID}
+		}
+		return ctx, rec
+	}
+
+	createFolder := func(body string) *FolderModel {
+		ctx, rec := newCtx(http.MethodPost, "/api/v2/folder", body, "8001", "administrator")
+
+		err := ctl.Create(ctx)
+		assert.Nil(err)
+
+		resp := FolderFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record
+	}
+
+	uploadFile := func() *FileModel {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "folder.txt")
+		part.Write([]byte("folder file"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := filePlugin.FileController.UploadFile(ctx)
+		assert.Nil(err)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record
+	}
+
+	queryFiles := func(query, userID string, roles ...string) []uint64 {
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/file?limit=1000&"+query, "", userID, roles...)
+
+		err := filePlugin.FileController.Query(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		ids := []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		// lists are limited by PAGER_LIMIT_MAX, the count isn't
+		assert.LessOrEqual(int64(len(ids)), resp.Meta.Count)
+		return ids
+	}
+
+	move := func(folderID, body string) (*FolderMoveResult, error) {
+		ctx, rec := newCtx(http.MethodPost, "/api/v2/folder/"+folderID+"/move", body, "8001", "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(folderID)
+
+		err := ctl.Move(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := FolderMoveJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Result, nil
+	}
+
+	photos := createFolder(`{"folder": {"name": "Photos"}}`)
+	events := createFolder(`{"folder": {"name": "Events", "parentId": ` + photos.GetIDString() + `}}`)
+
+	t.Run("Should create folders with tree paths", func(t *testing.T) {
+		assert.Equal("/"+photos.GetIDString()+"/", photos.Path)
+		assert.Equal(photos.Path+events.GetIDString()+"/", events.Path)
+		assert.Equal(FolderVisibilityInherit, events.Visibility)
+		assert.Equal(FolderVisibilityPublic, events.EffectiveVisibility)
+	})
+
+	t.Run("Should reject invalid folders", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodPost, "/api/v2/folder", `{"folder": {"name": ""}}`, "8001", "administrator")
+		err := ctl.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		ctx, _ = newCtx(http.MethodPost, "/api/v2/folder", `{"folder": {"name": "a", "visibility": "secret"}}`, "8001", "administrator")
+		err = ctl.Create(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	file := uploadFile()
+	other := uploadFile()
+
+	t.Run("Should move files to one folder and query by folder", func(t *testing.T) {
+		result, err := move(events.GetIDString(), `{"fileIds": ["`+file.GetIDString()+`"]}`)
+		assert.Nil(err)
+		assert.Equal(int64(1), result.Files)
+
+		assert.Equal([]uint64{file.ID}, queryFiles("folderId="+events.GetIDString(), "", "administrator"))
+		assert.Empty(queryFiles("folderId="+photos.GetIDString(), "", "administrator"))
+		assert.Equal([]uint64{file.ID}, queryFiles("inFolder="+photos.GetIDString(), "", "administrator"))
+		assert.Contains(queryFiles("folderId_is-null=true", "", "administrator"), other.ID)
+		assert.NotContains(queryFiles("folderId_is-null=true", "", "administrator"), file.ID)
+	})
+
+	t.Run("Should not move one folder inside itself", func(t *testing.T) {
+		_, err := move(events.GetIDString(), `{"fileIds": ["`+other.GetIDString()+`"], "folderIds": ["`+photos.GetIDString()+`"]}`)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		// nothing is moved if one folder move is invalid
+		found := FileModel{}
+		err = FileFindOne(other.GetIDString(), &found)
+		assert.Nil(err)
+		assert.Nil(found.FolderID)
+	})
+
+	t.Run("Should inherit the private visibility from the parent", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodPost, "/api/v2/folder/"+photos.GetIDString(), `{"folder": {"visibility": "private"}}`, "8001", "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(photos.GetIDString())
+		err := ctl.Update(ctx)
+		assert.Nil(err)
+
+		record := FolderModel{}
+		err = FolderFindOne(events.GetIDString(), &record)
+		assert.Nil(err)
+		assert.Equal(FolderVisibilityPrivate, record.EffectiveVisibility)
+
+		// the folder creator still finds the records
+		assert.Contains(queryFiles("", "8001", "folder-tester"), file.ID)
+
+		ids := queryFiles("", "8002", "folder-tester")
+		assert.NotContains(ids, file.ID)
+		assert.Contains(ids, other.ID)
+
+		ctx, _ = newCtx(http.MethodGet, "/api/v2/folder/"+events.GetIDString(), "", "8002", "folder-tester")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(events.GetIDString())
+		err = ctl.FindOne(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should move sub folders and update the tree", func(t *testing.T) {
+		result, err := move("root", `{"folderIds": ["`+events.GetIDString()+`"]}`)
+		assert.Nil(err)
+		assert.Equal(int64(1), result.Folders)
+
+		record := FolderModel{}
+		err = FolderFindOne(events.GetIDString(), &record)
+		assert.Nil(err)
+		assert.Nil(record.ParentID)
+		assert.Equal("/"+events.GetIDString()+"/", record.Path)
+		assert.Equal(FolderVisibilityPublic, record.EffectiveVisibility)
+
+		assert.Contains(queryFiles("", "8002", "folder-tester"), file.ID)
+	})
+
+	t.Run("Should copy files to one folder", func(t *testing.T) {
+		ctx, rec := newCtx(http.MethodPost, "/api/v2/folder/"+photos.GetIDString()+"/copy", `{"fileIds": ["`+other.GetIDString()+`"]}`, "8001", "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(photos.GetIDString())
+
+		err := ctl.Copy(ctx)
+		assert.Nil(err)
+
+		resp := FolderCopyJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Len(resp.Result.Files, 1)
+
+		copied := resp.Result.Files[0]
+		assert.NotEqual(other.ID, copied.ID)
+		assert.NotEqual(other.Name, copied.Name)
+		assert.Equal(other.Checksum, copied.Checksum)
+		assert.Equal(photos.ID, *copied.FolderID)
+	})
+
+	t.Run("Should only delete empty folders", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodDelete, "/api/v2/folder/"+events.GetIDString(), "", "8001", "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(events.GetIDString())
+		err := ctl.Delete(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusConflict, err.(*echo.HTTPError).Code)
+
+		_, err = move("root", `{"fileIds": ["`+file.GetIDString()+`"]}`)
+		assert.Nil(err)
+
+		err = ctl.Delete(ctx)
+		assert.Nil(err)
+	})
+}
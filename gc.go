@@ -0,0 +1,279 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	files_dtos "github.com/go-bolo/files/dtos"
+	"github.com/sirupsen/logrus"
+)
+
+// only objects with the default storage layout (2006/01/02/style/name) are collected, with the optional
+// tenant prefix of tenant files (tenant-a/2006/01/02/style/name)
+var gcStoragePathRegex = regexp.MustCompile(`^(?:[a-zA-Z0-9][a-zA-Z0-9_.-]{0,99}/)?\d{4}/\d{2}/\d{2}/[^/]+/[^/]+$`)
+
+type GCOptions struct {
+	// Only report orphans, don't delete anything
+	DryRun bool
+	// Records and stored objects created less than UnassociatedMinAge ago are skipped, default 7 days
+	UnassociatedMinAge time.Duration
+	// Default 100
+	BatchSize int
+}
+
+type GCOrphanObject struct {
+	StorageName string `json:"storageName"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+}
+
+type GCReport struct {
+	DryRun              bool             `json:"dryRun"`
+	OrphanObjects       []GCOrphanObject `json:"orphanObjects"`
+	UnassociatedFiles   []uint64         `json:"unassociatedFiles"`
+	UnassociatedImages  []uint64         `json:"unassociatedImages"`
+	DanglingFileAssocs  []uint64         `json:"danglingFileAssocs"`
+	DanglingImageAssocs []uint64         `json:"danglingImageAssocs"`
+	Errors              []string         `json:"errors"`
+}
+
+// RunGC - Find and delete orphans: associations pointing to missing records, records without
+// associations, folder or tags and stored objects without records. Unassociated records are moved to trash
+func RunGC(ctx context.Context, app bolo.App, opts *GCOptions) (*GCReport, error) {
+	if opts.UnassociatedMinAge <= 0 {
+		opts.UnassociatedMinAge = 7 * 24 * time.Hour
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	report := GCReport{
+		DryRun:              opts.DryRun,
+		OrphanObjects:       []GCOrphanObject{},
+		UnassociatedFiles:   []uint64{},
+		UnassociatedImages:  []uint64{},
+		DanglingFileAssocs:  []uint64{},
+		DanglingImageAssocs: []uint64{},
+		Errors:              []string{},
+	}
+
+	createdBefore := time.Now().Add(-opts.UnassociatedMinAge)
+
+	err := gcDanglingAssocs(app, opts, "fileassocs", "files", "fileId", &FileAssocsModel{}, &report.DanglingFileAssocs)
+	if err != nil {
+		return &report, fmt.Errorf("RunGC error on collect file assocs: %w", err)
+	}
+
+	err = gcDanglingAssocs(app, opts, "imageassocs", "images", "imageId", &ImageAssocsModel{}, &report.DanglingImageAssocs)
+	if err != nil {
+		return &report, fmt.Errorf("RunGC error on collect image assocs: %w", err)
+	}
+
+	err = gcUnassociatedRecords(app, opts, createdBefore, "files", "fileassocs", "filetags", "fileId", &FileModel{}, &report.UnassociatedFiles)
+	if err != nil {
+		return &report, fmt.Errorf("RunGC error on collect files: %w", err)
+	}
+
+	err = gcUnassociatedRecords(app, opts, createdBefore, "images", "imageassocs", "imagetags", "imageId", &ImageModel{}, &report.UnassociatedImages)
+	if err != nil {
+		return &report, fmt.Errorf("RunGC error on collect images: %w", err)
+	}
+
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	storageNames := []string{}
+	for name := range filePlugin.Storages {
+		storageNames = append(storageNames, name)
+	}
+	sort.Strings(storageNames)
+
+	for _, name := range storageNames {
+		err = gcOrphanObjects(ctx, app, opts, createdBefore, name, &report)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("storage %s: %s", name, err.Error()))
+		}
+	}
+
+	return &report, nil
+}
+
+func gcDanglingAssocs(app bolo.App, opts *GCOptions, assocsTable, table, column string, model interface{}, collected *[]uint64) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		ids := []uint64{}
+		err := db.Table(assocsTable).
+			Joins("LEFT JOIN "+table+" ON "+table+".id = "+assocsTable+"."+column).
+			Where(table+".id IS NULL AND "+assocsTable+".id > ?", lastID).
+			Order(assocsTable+".id ASC").
+			Limit(opts.BatchSize).
+			Pluck(assocsTable+".id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		lastID = ids[len(ids)-1]
+		*collected = append(*collected, ids...)
+
+		if !opts.DryRun {
+			err = db.Where("id IN ?", ids).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(ids) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+// records kept in folders or tagged are organized by users, so they aren't unassociated
+func gcUnassociatedRecords(app bolo.App, opts *GCOptions, createdBefore time.Time, table, assocsTable, tagsTable, column string, model interface{}, collected *[]uint64) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		ids := []uint64{}
+		err := db.Model(model).
+			Where("createdAt < ? AND id > ?", createdBefore, lastID).
+			Where("NOT EXISTS (SELECT 1 FROM "+assocsTable+" WHERE "+assocsTable+"."+column+" = "+table+".id)").
+			Where("folderId IS NULL").
+			Where("NOT EXISTS (SELECT 1 FROM "+tagsTable+" WHERE "+tagsTable+"."+column+" = "+table+".id)").
+			Order("id ASC").
+			Limit(opts.BatchSize).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		lastID = ids[len(ids)-1]
+		*collected = append(*collected, ids...)
+
+		if !opts.DryRun {
+			// move to trash, the stored objects are deleted by the trash purge job
+			err = db.Where("id IN ?", ids).Delete(model).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(ids) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+func gcOrphanObjects(ctx context.Context, app bolo.App, opts *GCOptions, createdBefore time.Time, storageName string, report *GCReport) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	storage, ok := filePlugin.GetStorage(storageName).(ObjectStorager)
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"storageName": storageName,
+		}).Debug("gcOrphanObjects storage can't list objects, skipping")
+		return nil
+	}
+
+	batch := []files_dtos.StoredObject{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		orphans, err := findOrphanObjects(app, batch)
+		if err != nil {
+			return err
+		}
+		batch = []files_dtos.StoredObject{}
+
+		for _, obj := range orphans {
+			report.OrphanObjects = append(report.OrphanObjects, GCOrphanObject{
+				StorageName: storageName,
+				Path:        obj.Path,
+				Size:        obj.Size,
+			})
+
+			if opts.DryRun {
+				continue
+			}
+
+			err = storage.DeleteObject(ctx, obj.Path)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("storage %s: error on delete %s: %s", storageName, obj.Path, err.Error()))
+			}
+		}
+
+		return nil
+	}
+
+	err := storage.ListObjects(ctx, func(obj files_dtos.StoredObject) error {
+		if !gcStoragePathRegex.MatchString(obj.Path) || !obj.UpdatedAt.Before(createdBefore) {
+			return nil
+		}
+
+		batch = append(batch, obj)
+		if len(batch) < opts.BatchSize {
+			return nil
+		}
+
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// filter objects without a file or image record, trashed records still own their objects
+func findOrphanObjects(app bolo.App, objects []files_dtos.StoredObject) ([]files_dtos.StoredObject, error) {
+	db := app.GetDB()
+
+	names := []string{}
+	for _, obj := range objects {
+		names = append(names, path.Base(obj.Path))
+	}
+
+	fileNames := []string{}
+	err := db.Unscoped().Model(&FileModel{}).Where("name IN ?", names).Pluck("name", &fileNames).Error
+	if err != nil {
+		return nil, err
+	}
+
+	imageNames := []string{}
+	err = db.Unscoped().Model(&ImageModel{}).Where("name IN ?", names).Pluck("name", &imageNames).Error
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, name := range append(fileNames, imageNames...) {
+		existing[name] = true
+	}
+
+	orphans := []files_dtos.StoredObject{}
+	for _, obj := range objects {
+		if !existing[path.Base(obj.Path)] {
+			orphans = append(orphans, obj)
+		}
+	}
+
+	return orphans, nil
+}
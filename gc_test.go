@@ -0,0 +1,115 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunGC(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	db := app.GetDB()
+
+	oldImage := GetImageModelStub()
+	oldImage.CreatedAt = time.Now().Add(-30 * 24 * time.Hour)
+	err := oldImage.Save()
+	assert.Nil(err)
+
+	folder := NewFolderModel()
+	folder.Name = "gc"
+	err = folder.Save()
+	assert.Nil(err)
+
+	folderImage := GetImageModelStub()
+	folderImage.CreatedAt = oldImage.CreatedAt
+	folderImage.FolderID = &folder.ID
+	err = folderImage.Save()
+	assert.Nil(err)
+
+	tag := NewTagModel()
+	tag.Name = "GC kept"
+	err = tag.Save()
+	assert.Nil(err)
+
+	taggedImage := GetImageModelStub()
+	taggedImage.CreatedAt = oldImage.CreatedAt
+	err = taggedImage.Save()
+	assert.Nil(err)
+	_, err = AddTags(db, AccessRecordTypeImage, []uint64{taggedImage.ID}, []uint64{tag.ID})
+	assert.Nil(err)
+
+	danglingAssoc := ImageAssocsModel{
+		ModelName: "content",
+		ModelID:   "41",
+		Field:     "gc",
+		ImageID:   999999,
+	}
+	err = db.Create(&danglingAssoc).Error
+	assert.Nil(err)
+
+	orphanPath := filepath.Join("/tmp/_test_files", "2020/01/01/original/gc-orphan.webp")
+	os.MkdirAll(filepath.Dir(orphanPath), os.ModePerm)
+	err = os.WriteFile(orphanPath, []byte("orphan"), 0644)
+	assert.Nil(err)
+	oldTime := time.Now().Add(-30 * 24 * time.Hour)
+	os.Chtimes(orphanPath, oldTime, oldTime)
+
+	tenantOrphanPath := filepath.Join("/tmp/_test_files", "gc-tenant/2020/01/01/original/gc-tenant-orphan.webp")
+	os.MkdirAll(filepath.Dir(tenantOrphanPath), os.ModePerm)
+	err = os.WriteFile(tenantOrphanPath, []byte("orphan"), 0644)
+	assert.Nil(err)
+	os.Chtimes(tenantOrphanPath, oldTime, oldTime)
+
+	t.Run("Should only report orphans in dry run mode", func(t *testing.T) {
+		report, err := RunGC(context.Background(), app, &GCOptions{DryRun: true, BatchSize: 2})
+		assert.Nil(err)
+
+		assert.Contains(report.UnassociatedImages, oldImage.ID)
+		assert.NotContains(report.UnassociatedImages, folderImage.ID)
+		assert.NotContains(report.UnassociatedImages, taggedImage.ID)
+		assert.Contains(report.DanglingImageAssocs, danglingAssoc.ID)
+
+		paths := []string{}
+		for _, obj := range report.OrphanObjects {
+			paths = append(paths, obj.Path)
+		}
+		assert.Contains(paths, "2020/01/01/original/gc-orphan.webp")
+		assert.Contains(paths, "gc-tenant/2020/01/01/original/gc-tenant-orphan.webp")
+
+		_, err = os.Stat(orphanPath)
+		assert.Nil(err)
+
+		found := ImageModel{}
+		err = ImageFindOne(oldImage.GetIDString(), &found)
+		assert.Nil(err)
+	})
+
+	t.Run("Should delete orphans", func(t *testing.T) {
+		_, err := RunGC(context.Background(), app, &GCOptions{BatchSize: 2})
+		assert.Nil(err)
+
+		_, err = os.Stat(orphanPath)
+		assert.True(os.IsNotExist(err))
+		_, err = os.Stat(tenantOrphanPath)
+		assert.True(os.IsNotExist(err))
+
+		var count int64
+		db.Model(&ImageAssocsModel{}).Where("id = ?", danglingAssoc.ID).Count(&count)
+		assert.Equal(int64(0), count)
+
+		trashed := ImageModel{}
+		err = TrashedImageFindOne(oldImage.GetIDString(), &trashed)
+		assert.Nil(err)
+
+		for _, kept := range []ImageModel{folderImage, taggedImage} {
+			found := ImageModel{}
+			err = ImageFindOne(kept.GetIDString(), &found)
+			assert.Nil(err)
+		}
+	})
+}
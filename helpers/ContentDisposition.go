@@ -0,0 +1,67 @@
+package files_helpers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// ContentDisposition - Build one Content-Disposition header value with one ASCII filename fallback
+// and the RFC 5987 encoded filename* for browsers with UTF-8 support
+func ContentDisposition(dispositionType, filename string) string {
+	filename = SanitizeFileName(filename)
+	if filename == "" {
+		return dispositionType
+	}
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType, asciiFileName(filename), encodeRFC5987(filename))
+}
+
+// SanitizeFileName - Remove paths and control characters from one user or client provided file name
+func SanitizeFileName(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == "/" {
+		return ""
+	}
+
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+}
+
+func asciiFileName(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+}
+
+// encodeRFC5987 - Percent encode all bytes that are not attr-char
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+		return true
+	}
+
+	return strings.IndexByte("!#$&+-.^_`|~", c) != -1
+}
@@ -2,6 +2,7 @@ package files_helpers
 
 import (
 	"io"
+	"mime/multipart"
 	"os"
 
 	"github.com/go-bolo/bolo"
@@ -13,6 +14,11 @@ func CopyRequestFileToTMP(c *bolo.RequestContext, field string, dest string) err
 		return err
 	}
 
+	return CopyMultipartFileToTMP(file, dest)
+}
+
+// CopyMultipartFileToTMP - Copy one uploaded multipart file to dest
+func CopyMultipartFileToTMP(file *multipart.FileHeader, dest string) error {
 	src, err := file.Open()
 	if err != nil {
 		return err
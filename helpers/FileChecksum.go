@@ -0,0 +1,29 @@
+package files_helpers
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// FileChecksum - Get the hex encoded md5 checksum of one local file
+func FileChecksum(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return ReaderChecksum(f)
+}
+
+// ReaderChecksum - Get the hex encoded md5 checksum of all reader content
+func ReaderChecksum(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
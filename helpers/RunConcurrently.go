@@ -0,0 +1,35 @@
+package files_helpers
+
+import (
+	"context"
+	"sync"
+)
+
+// RunConcurrently - Call fn for every index in [0, size) with at most concurrency calls at same time,
+// stops starting new calls if the context is canceled and waits the running ones
+func RunConcurrently(ctx context.Context, size, concurrency int, fn func(i int)) {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := 0; i < size; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,52 @@
+package files_helpers
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+
+	files_dtos "github.com/go-bolo/files/dtos"
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultCacheControl - Cache-Control used to serve objects without this storage attribute
+var DefaultCacheControl = "public, max-age=86400"
+
+// ServeObject - Send one stored object with ETag, Last-Modified and Cache-Control headers. Handles
+// If-None-Match, If-Modified-Since and If-Range with 304 responses and Range requests with 206
+// partial content, including multi-range requests
+func ServeObject(c echo.Context, content io.ReadSeeker, info *files_dtos.StoredObject) error {
+	h := c.Response().Header()
+
+	if info.ETag != "" {
+		h.Set("ETag", quoteETag(info.ETag))
+	}
+
+	if info.CacheControl != "" {
+		h.Set("Cache-Control", info.CacheControl)
+	} else if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", DefaultCacheControl)
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(info.Path))
+	}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+
+	// ServeContent uses the ETag header set above in conditional requests
+	http.ServeContent(c.Response(), c.Request(), path.Base(info.Path), info.UpdatedAt, content)
+
+	return nil
+}
+
+func quoteETag(etag string) string {
+	if len(etag) >= 2 && (etag[0] == '"' || (len(etag) > 2 && etag[:2] == "W/")) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
@@ -0,0 +1,206 @@
+package files
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	files_database "github.com/go-bolo/files/database"
+	files_processor "github.com/go-bolo/files/processor"
+	"github.com/pkg/errors"
+)
+
+// IsFormatIgnored - Check if the image format should not be processed (e.g., GIF, SVG)
+func (p *FilePlugin) IsFormatIgnored(extension string) bool {
+	if p.ImageFormatToIgnore == "" || extension == "" {
+		return false
+	}
+
+	ignoreFormats := strings.Split(p.ImageFormatToIgnore, ",")
+	for _, ignoreFormat := range ignoreFormats {
+		ignoreFormat = strings.TrimSpace(ignoreFormat)
+		if strings.EqualFold(extension, ignoreFormat) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetImageStorage - Get the storage where the image is saved, fallback to the default image storage
+func (p *FilePlugin) GetImageStorage(record *ImageModel) Storager {
+	if record.StorageName != "" {
+		if storage := p.GetStorage(record.StorageName); storage != nil {
+			return storage
+		}
+	}
+
+	return p.GetStorage(p.ImageStorageName)
+}
+
+// IsPendingStyleURL - Check if the style url points to the API and the style file is not generated yet
+func IsPendingStyleURL(record *ImageModel, style string) bool {
+	url := record.URLs[style]
+	return url != "" && strings.HasSuffix(url, "/api/v1/image/"+style+"/"+record.Name)
+}
+
+// GetStyleFingerprint - Get one short hash of the style configuration, changes if the style size or
+// the image format changes. Returns empty string for unknown styles
+func (p *FilePlugin) GetStyleFingerprint(style string) string {
+	styleCfg, ok := p.ImageStyles[style]
+	if !ok {
+		return ""
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d:%d:%s", styleCfg.Width, styleCfg.Height, p.ImageFormat)))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// IsStyleOutdated - Check if the style file was generated with other style configuration. Styles without
+// fingerprint were generated before the style versions and are treated as current, so existing images are
+// not regenerated on first access. Their fingerprint is saved when they are first served, see saveStyleVersion
+func (p *FilePlugin) IsStyleOutdated(record *ImageModel, style string) bool {
+	if !p.isGeneratedStyle(record, style) {
+		return false
+	}
+
+	fingerprint := record.StyleVersions[style]
+	if fingerprint == "" {
+		return false
+	}
+
+	return fingerprint != p.GetStyleFingerprint(style)
+}
+
+// isStyleUnversioned - Check if the style file was generated before the style versions
+func (p *FilePlugin) isStyleUnversioned(record *ImageModel, style string) bool {
+	return p.isGeneratedStyle(record, style) && record.StyleVersions[style] == ""
+}
+
+// isGeneratedStyle - Check if the style has one stored style file, ignored formats use the original file
+func (p *FilePlugin) isGeneratedStyle(record *ImageModel, style string) bool {
+	url := record.URLs[style]
+	if style == "original" || url == "" || url == record.URLs["original"] || IsPendingStyleURL(record, style) {
+		return false
+	}
+
+	return record.Extension == nil || !p.IsFormatIgnored(*record.Extension)
+}
+
+// saveStyleVersion - Save the current fingerprint of one style generated before the style versions, so the
+// next style configuration change regenerates it. Only the style versions are saved
+func saveStyleVersion(app bolo.App, record *ImageModel, style string) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	if record.StyleVersions == nil {
+		record.StyleVersions = files_database.ImageURLsField{}
+	}
+	record.StyleVersions[style] = filePlugin.GetStyleFingerprint(style)
+
+	return app.GetDB().Model(record).UpdateColumn("styleVersions", record.StyleVersions).Error
+}
+
+// GetVersionedStyleURL - Add the style fingerprint in the url to invalidate CDN caches on style changes
+func GetVersionedStyleURL(url, fingerprint string) string {
+	if fingerprint == "" {
+		return url
+	}
+
+	if strings.Contains(url, "?") {
+		return url + "&v=" + fingerprint
+	}
+
+	return url + "?v=" + fingerprint
+}
+
+// GetPendingStyleURL - Get the API url used to generate the image style on first access
+func GetPendingStyleURL(app bolo.App, record *ImageModel, style string) string {
+	return BuidFileBaseURL(app) + "/api/v1/image/" + style + "/" + record.Name
+}
+
+// GenerateImageStyle - Resize the original image and upload the style file, the record URLs are
+// updated but not saved
+func GenerateImageStyle(app bolo.App, record *ImageModel, style string) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	storage := filePlugin.GetImageStorage(record)
+
+	if record.URLs == nil {
+		return fmt.Errorf("GenerateImageStyle: image %d has no urls", record.ID)
+	}
+
+	// Skip processing for ignored formats to preserve their properties (e.g., GIF animation)
+	if record.Extension != nil && filePlugin.IsFormatIgnored(*record.Extension) {
+		// For ignored formats, just use the original URL for all styles
+		record.URLs[style] = record.URLs["original"]
+		return nil
+	}
+
+	styleCfg, ok := filePlugin.ImageStyles[style]
+	if !ok {
+		return fmt.Errorf("GenerateImageStyle: invalid image style %s", style)
+	}
+
+	url := record.URLs["original"]
+
+	// one tmp dir by call, styles of one image can be generated concurrently in lazy regenerations. The
+	// files keep the record name, as processors may get the format from the file extension
+	tmpDir, err := os.MkdirTemp("", "files-style-*")
+	if err != nil {
+		return errors.Wrap(err, "GenerateImageStyle Error on create tmp dir")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	originalPath := path.Join(tmpDir, record.Name) + "_original"
+
+	processor := filePlugin.Processor
+
+	tmpFilePath := path.Join(tmpDir, record.Name+"_"+style)
+
+	resizeOpts := files_processor.Options{
+		"width":  strconv.Itoa(styleCfg.Width),
+		"height": strconv.Itoa(styleCfg.Height),
+		"url":    url,
+		"format": filePlugin.ImageFormat,
+	}
+
+	err = processor.Resize(originalPath, tmpFilePath, record.Name, resizeOpts)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(tmpFilePath)
+	if err != nil {
+		return err
+	}
+
+	dest, _ := storage.GetUploadPathFromFile(style, filePlugin.ImageFormat, record)
+
+	err = storage.UploadFile(record, tmpFilePath, dest)
+	if err != nil {
+		return errors.Wrap(err, "GenerateImageStyle Error on upload file")
+	}
+
+	url, _ = storage.GetUrlFromFile(style, record)
+	fingerprint := filePlugin.GetStyleFingerprint(style)
+
+	if record.StyleVersions == nil {
+		record.StyleVersions = files_database.ImageURLsField{}
+	}
+
+	record.URLs[style] = GetVersionedStyleURL(url, fingerprint)
+	record.StyleVersions[style] = fingerprint
+	record.SetStyleSize(style, info.Size())
+
+	triggerAfterEvent(app, EventStyleGenerated, &StyleGeneratedEvent{
+		Image: record,
+		Style: style,
+		Size:  info.Size(),
+	})
+
+	return nil
+}
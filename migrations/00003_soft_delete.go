@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration3() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "soft-delete",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				for _, table := range []string{"files", "images"} {
+					err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN deletedAt datetime DEFAULT NULL`).Error
+					if err != nil {
+						return fmt.Errorf("failed to add deletedAt column in "+table+" table: %w", err)
+					}
+
+					err = tx.Exec(`CREATE INDEX idx_` + table + `_deletedAt ON ` + table + ` (deletedAt)`).Error
+					if err != nil {
+						return fmt.Errorf("failed to create deletedAt index in "+table+" table: %w", err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration4() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "checksum",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				for _, table := range []string{"files", "images"} {
+					err := tx.Exec(`ALTER TABLE ` + table + ` ADD COLUMN checksum varchar(64) DEFAULT NULL`).Error
+					if err != nil {
+						return fmt.Errorf("failed to add checksum column in "+table+" table: %w", err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration5() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "style-versions",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				err := tx.Exec(`ALTER TABLE images ADD COLUMN styleVersions blob DEFAULT NULL`).Error
+				if err != nil {
+					return fmt.Errorf("failed to add styleVersions column in images table: %w", err)
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,43 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration6() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "storage-quotas",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					`ALTER TABLE images ADD COLUMN styleSizes blob DEFAULT NULL`,
+					`ALTER TABLE images ADD COLUMN stylesSize bigint NOT NULL DEFAULT 0`,
+				}
+
+				for _, table := range []string{"files", "images"} {
+					queries = append(queries,
+						`ALTER TABLE `+table+` ADD COLUMN tenantId varchar(100) NOT NULL DEFAULT ''`,
+						`CREATE INDEX `+table+`_tenantId ON `+table+` (tenantId)`,
+						`CREATE INDEX `+table+`_creatorId_tenantId ON `+table+` (creatorId, tenantId)`,
+					)
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run storage quotas migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
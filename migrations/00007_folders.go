@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration7() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "folders",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					`CREATE TABLE IF NOT EXISTS folders (
+						id int(11) NOT NULL AUTO_INCREMENT,
+						name varchar(255) NOT NULL,
+						description text,
+						parentId int(11) DEFAULT NULL,
+						path varchar(767) NOT NULL DEFAULT '',
+						visibility varchar(20) NOT NULL DEFAULT 'inherit',
+						effectiveVisibility varchar(20) NOT NULL DEFAULT 'public',
+						creatorId int(11) DEFAULT NULL,
+						tenantId varchar(100) NOT NULL DEFAULT '',
+						createdAt datetime NOT NULL,
+						updatedAt datetime NOT NULL,
+						PRIMARY KEY (id),
+						KEY folders_parentId (parentId),
+						KEY folders_path (path),
+						KEY folders_tenantId (tenantId),
+						CONSTRAINT folders_parent_fk FOREIGN KEY (parentId) REFERENCES folders (id) ON DELETE RESTRICT ON UPDATE CASCADE
+					)`,
+				}
+
+				for _, table := range []string{"files", "images"} {
+					queries = append(queries,
+						`ALTER TABLE `+table+` ADD COLUMN folderId int(11) DEFAULT NULL`,
+						`CREATE INDEX `+table+`_folderId ON `+table+` (folderId)`,
+					)
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run folders migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration8() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "tags",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					`CREATE TABLE IF NOT EXISTS mediatags (
+						id int(11) NOT NULL AUTO_INCREMENT,
+						name varchar(255) NOT NULL,
+						slug varchar(255) NOT NULL,
+						tenantId varchar(100) NOT NULL DEFAULT '',
+						creatorId int(11) DEFAULT NULL,
+						createdAt datetime NOT NULL,
+						updatedAt datetime NOT NULL,
+						PRIMARY KEY (id),
+						UNIQUE KEY mediatags_tenantId_slug (tenantId, slug)
+					)`,
+					`CREATE TABLE IF NOT EXISTS filetags (
+						fileId int(11) NOT NULL,
+						tagId int(11) NOT NULL,
+						createdAt datetime NOT NULL,
+						PRIMARY KEY (fileId, tagId),
+						KEY filetags_tagId (tagId)
+					)`,
+					`CREATE TABLE IF NOT EXISTS imagetags (
+						imageId int(11) NOT NULL,
+						tagId int(11) NOT NULL,
+						createdAt datetime NOT NULL,
+						PRIMARY KEY (imageId, tagId),
+						KEY imagetags_tagId (tagId)
+					)`,
+					// used in the orientation filter and facet
+					`ALTER TABLE images ADD COLUMN width int(11) NOT NULL DEFAULT 0`,
+					`ALTER TABLE images ADD COLUMN height int(11) NOT NULL DEFAULT 0`,
+					`CREATE INDEX images_mime ON images (mime)`,
+					`CREATE INDEX files_mime ON files (mime)`,
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run tags migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
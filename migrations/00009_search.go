@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration9() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "search",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					// index of the MySQL search backend, rebuild it with the files:search-reindex command
+					`CREATE TABLE IF NOT EXISTS mediasearch (
+						recordType varchar(20) NOT NULL,
+						recordId int(11) NOT NULL,
+						label text,
+						description text,
+						originalname varchar(255),
+						tags text,
+						extractedText mediumtext,
+						PRIMARY KEY (recordType, recordId),
+						FULLTEXT KEY mediasearch_text (label, description, originalname, tags, extractedText)
+					) ENGINE=InnoDB`,
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run search migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
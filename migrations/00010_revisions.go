@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration10() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "revisions",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					`CREATE TABLE IF NOT EXISTS mediarevisions (
+						id int(11) NOT NULL AUTO_INCREMENT,
+						recordType varchar(20) NOT NULL,
+						recordId int(11) NOT NULL,
+						number int(11) NOT NULL,
+						size bigint NOT NULL DEFAULT 0,
+						checksum varchar(64) DEFAULT NULL,
+						mime varchar(255) DEFAULT NULL,
+						extension varchar(255) DEFAULT NULL,
+						originalname varchar(255) DEFAULT NULL,
+						width int(11) NOT NULL DEFAULT 0,
+						height int(11) NOT NULL DEFAULT 0,
+						storageName varchar(255) DEFAULT NULL,
+						tenantId varchar(100) NOT NULL DEFAULT '',
+						creatorId int(11) DEFAULT NULL,
+						createdAt datetime NOT NULL,
+						replacedById int(11) DEFAULT NULL,
+						replacedAt datetime NOT NULL,
+						PRIMARY KEY (id),
+						UNIQUE KEY mediarevisions_record_number (recordType, recordId, number)
+					)`,
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run revisions migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+func GetMigration11() *bolo.Migration {
+	return &bolo.Migration{
+		Name: "expiration",
+		Up: func(app bolo.App) error {
+			db := app.GetDB()
+			return db.Transaction(func(tx *gorm.DB) error {
+				queries := []string{
+					`ALTER TABLE files ADD COLUMN expiresAt datetime DEFAULT NULL`,
+					`ALTER TABLE images ADD COLUMN expiresAt datetime DEFAULT NULL`,
+					// used by the expiration purge job
+					`CREATE INDEX files_expiresAt ON files (expiresAt)`,
+					`CREATE INDEX images_expiresAt ON images (expiresAt)`,
+				}
+
+				for _, query := range queries {
+					err := tx.Exec(query).Error
+					if err != nil {
+						return fmt.Errorf("failed to run expiration migration %q: %w", query, err)
+					}
+				}
+
+				return nil
+			})
+		},
+		Down: func(app bolo.App) error {
+			return nil
+		},
+	}
+}
@@ -0,0 +1,137 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOwnershipTransferInvalidUser = errors.New("toUserId should be one numeric user id")
+	ErrOwnershipTransferNoFilter    = errors.New("fromUserId, fileIds or imageIds is required")
+)
+
+// TeamResolver - Get the ids of the users in the authenticated user team, used in seletor=team queries
+type TeamResolver interface {
+	GetTeamMemberIDs(ctx *bolo.RequestContext) ([]string, error)
+}
+
+// getCreatorID - Get the authenticated user id to save as record creator, nil for anonymous requests
+func getCreatorID(ctx *bolo.RequestContext) *int64 {
+	return parseCreatorID(getAuthenticatedUserID(ctx))
+}
+
+// parseCreatorID - Creator ids are saved as numbers, not numeric user ids are ignored
+func parseCreatorID(userID string) *int64 {
+	if userID == "" {
+		return nil
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &id
+}
+
+// applyOwnerSelector - Filter queries with ?seletor=owner to the records uploaded by the authenticated user
+// and with ?seletor=team to the records uploaded by the user team members
+func applyOwnerSelector(ctx *bolo.RequestContext, query *gorm.DB) (*gorm.DB, error) {
+	seletor := ctx.QueryParam("seletor")
+	if seletor != "owner" && seletor != "team" {
+		return query, nil
+	}
+
+	userID := getAuthenticatedUserID(ctx)
+	if userID == "" {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	if seletor == "owner" {
+		return query.Where("creatorId = ?", userID), nil
+	}
+
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	if filePlugin.TeamResolver == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "team seletor is not available")
+	}
+
+	memberIDs, err := filePlugin.TeamResolver.GetTeamMemberIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Where("creatorId IN ?", append(memberIDs, userID)), nil
+}
+
+// OwnershipTransferOptions - Move records to other user, all records from FromUserID are moved if no ids are set
+type OwnershipTransferOptions struct {
+	FromUserID string   `json:"fromUserId"`
+	ToUserID   string   `json:"toUserId"`
+	FileIDs    []string `json:"fileIds"`
+	ImageIDs   []string `json:"imageIds"`
+}
+
+type OwnershipTransferResult struct {
+	Files  int64 `json:"files"`
+	Images int64 `json:"images"`
+}
+
+// TransferOwnership - Change the creator of files and images in one transaction, trashed records are included.
+// The scopes filter the moved records, like the request tenant scope
+func TransferOwnership(app bolo.App, opts *OwnershipTransferOptions, scopes ...func(*gorm.DB) *gorm.DB) (*OwnershipTransferResult, error) {
+	toUserID := parseCreatorID(opts.ToUserID)
+	if toUserID == nil {
+		return nil, ErrOwnershipTransferInvalidUser
+	}
+
+	if opts.FromUserID == "" && len(opts.FileIDs) == 0 && len(opts.ImageIDs) == 0 {
+		return nil, ErrOwnershipTransferNoFilter
+	}
+
+	result := OwnershipTransferResult{}
+	// with ids only the selected records are moved
+	onlyIDs := len(opts.FileIDs) > 0 || len(opts.ImageIDs) > 0
+
+	err := app.GetDB().Transaction(func(tx *gorm.DB) error {
+		var err error
+
+		result.Files, err = transferModelOwnership(tx.Scopes(scopes...), &FileModel{}, opts.FromUserID, opts.FileIDs, *toUserID, onlyIDs)
+		if err != nil {
+			return err
+		}
+
+		result.Images, err = transferModelOwnership(tx.Scopes(scopes...), &ImageModel{}, opts.FromUserID, opts.ImageIDs, *toUserID, onlyIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func transferModelOwnership(tx *gorm.DB, model interface{}, fromUserID string, ids []string, toUserID int64, onlyIDs bool) (int64, error) {
+	if onlyIDs && len(ids) == 0 {
+		return 0, nil
+	}
+
+	query := tx.Unscoped().Model(model)
+
+	if fromUserID != "" {
+		query = query.Where("creatorId = ?", fromUserID)
+	}
+
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	}
+
+	r := query.Update("creatorId", toUserID)
+
+	return r.RowsAffected, r.Error
+}
@@ -0,0 +1,153 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type teamResolverStub struct {
+	members []string
+}
+
+func (r *teamResolverStub) GetTeamMemberIDs(ctx *bolo.RequestContext) ([]string, error) {
+	return r.members, nil
+}
+
+func TestOwnership(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	upload := func(userID string) *FileModel {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "owned.txt")
+		part.Write([]byte("owned file"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		ctx.AuthenticatedUser = &UserStub{ID: userID}
+
+		err := ctl.UploadFile(ctx)
+		assert.Nil(err)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record
+	}
+
+	query := func(userID, seletor string) ([]uint64, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file?limit=1000&seletor="+seletor, nil)
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		ctx.AuthenticatedUser = &UserStub{ID: userID}
+
+		err := ctl.Query(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		ids := []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		assert.Equal(int64(len(ids)), resp.Meta.Count)
+		return ids, nil
+	}
+
+	first := upload("5001")
+	second := upload("5002")
+
+	t.Run("Should set the creator on upload", func(t *testing.T) {
+		assert.NotNil(first.CreatorID)
+		assert.Equal(int64(5001), *first.CreatorID)
+	})
+
+	t.Run("Should only list owned files with seletor=owner", func(t *testing.T) {
+		ids, err := query("5001", "owner")
+		assert.Nil(err)
+		assert.Equal([]uint64{first.ID}, ids)
+	})
+
+	t.Run("Should list team files with seletor=team", func(t *testing.T) {
+		_, err := query("5001", "team")
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		filePlugin.TeamResolver = &teamResolverStub{members: []string{"5002"}}
+		defer func() { filePlugin.TeamResolver = nil }()
+
+		ids, err := query("5001", "team")
+		assert.Nil(err)
+		assert.ElementsMatch([]uint64{first.ID, second.ID}, ids)
+	})
+
+	t.Run("Should transfer ownership in bulk", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/files-maintenance/transfer-ownership", strings.NewReader(`{"fromUserId": "5001", "toUserId": "5003"}`))
+		req.Header.Set("Content-Type", "application/json")
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := filePlugin.MaintenanceController.TransferOwnership(ctx)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Contains(rec.Body.String(), `"files":1`)
+
+		ids, err := query("5003", "owner")
+		assert.Nil(err)
+		assert.Equal([]uint64{first.ID}, ids)
+	})
+
+	t.Run("Should only transfer the ownership of the request tenant records", func(t *testing.T) {
+		filePlugin.TenantResolver = &HeaderTenantResolver{}
+		defer func() { filePlugin.TenantResolver = nil }()
+
+		owned := []*FileModel{}
+		for _, tenantID := range []string{"owner-tenant-a", "owner-tenant-b"} {
+			creatorID := int64(5004)
+			record := GetFileModelStub()
+			record.CreatorID = &creatorID
+			record.TenantID = tenantID
+			err := record.Save()
+			assert.Nil(err)
+			owned = append(owned, &record)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/files-maintenance/transfer-ownership", strings.NewReader(`{"fromUserId": "5004", "toUserId": "5005"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant-ID", "owner-tenant-a")
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := filePlugin.MaintenanceController.TransferOwnership(ctx)
+		assert.Nil(err)
+		assert.Contains(rec.Body.String(), `"files":1`)
+
+		for i, creatorID := range []int64{5005, 5004} {
+			found := FileModel{}
+			err = FileFindOne(owned[i].GetIDString(), &found)
+			assert.Nil(err)
+			assert.Equal(creatorID, *found.CreatorID)
+		}
+	})
+
+	t.Run("Should require one filter to transfer ownership", func(t *testing.T) {
+		_, err := TransferOwnership(app, &OwnershipTransferOptions{ToUserID: "5003"})
+		assert.ErrorIs(err, ErrOwnershipTransferNoFilter)
+	})
+}
@@ -0,0 +1,274 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+const (
+	QuotaScopeUser   = "user"
+	QuotaScopeTenant = "tenant"
+)
+
+// QuotaCfg - Storage limits in bytes, 0 is unlimited. Set Resolver to get the limits from user plans
+type QuotaCfg struct {
+	UserLimit   int64
+	TenantLimit int64
+	Resolver    QuotaResolver
+}
+
+type QuotaLimits struct {
+	User   int64 `json:"user"`
+	Tenant int64 `json:"tenant"`
+}
+
+// QuotaResolver - Get the storage limits of one user and tenant, 0 is unlimited
+type QuotaResolver interface {
+	GetQuotaLimits(ctx *bolo.RequestContext, userID, tenantID string) (*QuotaLimits, error)
+}
+
+// StorageUsage - Bytes used by records, styles are the generated image styles and revisions the previous
+// contents of replaced records. Trashed records are included until they are purged because their objects
+// are still stored
+type StorageUsage struct {
+	Files     int64 `json:"files"`
+	Images    int64 `json:"images"`
+	Styles    int64 `json:"styles"`
+	Revisions int64 `json:"revisions"`
+	Used      int64 `json:"used"`
+	Limit     int64 `json:"limit"`
+}
+
+// QuotaExceededError - Upload rejected because the used bytes plus the upload size is over the limit
+type QuotaExceededError struct {
+	Scope string
+	Used  int64
+	Limit int64
+	Size  int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %s uses %d of %d bytes, upload has %d bytes", ErrQuotaExceeded.Error(), e.Scope, e.Used, e.Limit, e.Size)
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// GetUserStorageUsage - Get the bytes used by the records created by the user
+func GetUserStorageUsage(app bolo.App, userID string) (*StorageUsage, error) {
+	return getStorageUsage(app.GetDB(), "creatorId", userID)
+}
+
+// GetTenantStorageUsage - Get the bytes used by the records of the tenant
+func GetTenantStorageUsage(app bolo.App, tenantID string) (*StorageUsage, error) {
+	return getStorageUsage(app.GetDB(), "tenantId", tenantID)
+}
+
+// getStorageUsage - Usage is always computed from the records, so deletes, purges and new styles are counted
+// without one separated counter. Each record counts its own stored objects, records with same checksum are
+// stored twice and are counted twice
+func getStorageUsage(db *gorm.DB, column, value string) (*StorageUsage, error) {
+	usage := StorageUsage{}
+
+	err := db.Unscoped().
+		Model(&FileModel{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where(column+" = ?", value).
+		Scan(&usage.Files).Error
+	if err != nil {
+		return nil, fmt.Errorf("getStorageUsage files: %w", err)
+	}
+
+	sums := struct {
+		Images int64
+		Styles int64
+	}{}
+
+	err = db.Unscoped().
+		Model(&ImageModel{}).
+		Select("COALESCE(SUM(size), 0) AS images, COALESCE(SUM(stylesSize), 0) AS styles").
+		Where(column+" = ?", value).
+		Scan(&sums).Error
+	if err != nil {
+		return nil, fmt.Errorf("getStorageUsage images: %w", err)
+	}
+
+	usage.Images = sums.Images
+	usage.Styles = sums.Styles
+
+	// revisions are counted to the owner of the record
+	for _, record := range []struct{ recordType, table string }{
+		{AccessRecordTypeFile, "files"},
+		{AccessRecordTypeImage, "images"},
+	} {
+		var revisions int64
+		err = db.Model(&RevisionModel{}).
+			Select("COALESCE(SUM(mediarevisions.size), 0)").
+			Joins("INNER JOIN "+record.table+" ON "+record.table+".id = mediarevisions.recordId AND mediarevisions.recordType = ?", record.recordType).
+			Where(record.table+"."+column+" = ?", value).
+			Scan(&revisions).Error
+		if err != nil {
+			return nil, fmt.Errorf("getStorageUsage %s revisions: %w", record.recordType, err)
+		}
+
+		usage.Revisions += revisions
+	}
+
+	usage.Used = usage.Files + usage.Images + usage.Styles + usage.Revisions
+
+	return &usage, nil
+}
+
+// GetQuotaLimits - Get the limits from the quota resolver or from the static configuration
+func (p *FilePlugin) GetQuotaLimits(ctx *bolo.RequestContext, userID, tenantID string) (*QuotaLimits, error) {
+	if p.Quota.Resolver != nil {
+		return p.Quota.Resolver.GetQuotaLimits(ctx, userID, tenantID)
+	}
+
+	return &QuotaLimits{User: p.Quota.UserLimit, Tenant: p.Quota.TenantLimit}, nil
+}
+
+// CheckUploadQuota - Check if the request user and tenant can store more size bytes. Anonymous uploads
+// and uploads without tenant skip the related limit
+func CheckUploadQuota(ctx *bolo.RequestContext, size int64) error {
+	return checkUserUploadQuota(ctx, getAuthenticatedUserID(ctx), size)
+}
+
+// checkUserUploadQuota - Check if the user that will own the upload and the request tenant can store more
+// size bytes, the owner is other user than the request user in uploads like avatars set by admins
+func checkUserUploadQuota(ctx *bolo.RequestContext, userID string, size int64) error {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+
+	// usage is counted by creatorId and only numeric user ids are saved as creator
+	if parseCreatorID(userID) == nil {
+		userID = ""
+	}
+
+	tenantID, err := getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	limits, err := filePlugin.GetQuotaLimits(ctx, userID, tenantID)
+	if err != nil {
+		return err
+	}
+
+	if userID != "" && limits.User > 0 {
+		usage, err := GetUserStorageUsage(ctx.App, userID)
+		if err != nil {
+			return err
+		}
+
+		if usage.Used+size > limits.User {
+			return &QuotaExceededError{Scope: QuotaScopeUser, Used: usage.Used, Limit: limits.User, Size: size}
+		}
+	}
+
+	if tenantID != "" && limits.Tenant > 0 {
+		usage, err := GetTenantStorageUsage(ctx.App, tenantID)
+		if err != nil {
+			return err
+		}
+
+		if usage.Used+size > limits.Tenant {
+			return &QuotaExceededError{Scope: QuotaScopeTenant, Used: usage.Used, Limit: limits.Tenant, Size: size}
+		}
+	}
+
+	return nil
+}
+
+// checkUploadQuota - Check the quota with the size of local files, quota errors are returned as 413
+func checkUploadQuota(ctx *bolo.RequestContext, filePaths ...string) error {
+	var size int64
+	for _, filePath := range filePaths {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+	}
+
+	return quotaHTTPError(CheckUploadQuota(ctx, size))
+}
+
+func quotaHTTPError(err error) error {
+	var quotaErr *QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		return &bolo.HTTPError{
+			Code: http.StatusRequestEntityTooLarge,
+			Message: map[string]any{
+				"message": ErrQuotaExceeded.Error(),
+				"scope":   quotaErr.Scope,
+				"used":    quotaErr.Used,
+				"limit":   quotaErr.Limit,
+				"size":    quotaErr.Size,
+			},
+			Internal: err,
+		}
+	}
+
+	return err
+}
+
+type StorageUsageJSONResponse struct {
+	User   *StorageUsage `json:"user,omitempty"`
+	Tenant *StorageUsage `json:"tenant,omitempty"`
+}
+
+// Usage - Get the storage usage and limits of the authenticated user and tenant, users with manage_files
+// can get the usage of other users with ?userId=
+func (ctl *FileController) Usage(c echo.Context) error {
+	ctx := c.(*bolo.RequestContext)
+	filePlugin := ctl.App.GetPlugin("files").(*FilePlugin)
+
+	userID := getAuthenticatedUserID(ctx)
+	if userID == "" {
+		return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	if queryUserID := c.QueryParam("userId"); queryUserID != "" && queryUserID != userID {
+		if !ctx.Can("manage_files") {
+			return echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+		}
+		userID = queryUserID
+	}
+
+	tenantID, err := getTenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	limits, err := filePlugin.GetQuotaLimits(ctx, userID, tenantID)
+	if err != nil {
+		return err
+	}
+
+	resp := StorageUsageJSONResponse{}
+
+	resp.User, err = GetUserStorageUsage(ctl.App, userID)
+	if err != nil {
+		return err
+	}
+	resp.User.Limit = limits.User
+
+	if tenantID != "" {
+		resp.Tenant, err = GetTenantStorageUsage(ctl.App, tenantID)
+		if err != nil {
+			return err
+		}
+		resp.Tenant.Limit = limits.Tenant
+	}
+
+	return c.JSON(http.StatusOK, &resp)
+}
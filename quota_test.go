@@ -0,0 +1,159 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantResolverStub struct {
+	tenantID string
+}
+
+func (r *tenantResolverStub) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	return r.tenantID, nil
+}
+
+func TestStorageQuota(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	quota := filePlugin.Quota
+	defer func() { filePlugin.Quota = quota }()
+
+	upload := func(userID, content string) (*FileModel, error) {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "quota.txt")
+		part.Write([]byte(content))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		ctx.AuthenticatedUser = &UserStub{ID: userID}
+
+		err := ctl.UploadFile(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record, nil
+	}
+
+	getUsage := func(userID string) *StorageUsageJSONResponse {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/file/usage", nil)
+		ctx, rec := GetRequestContextStub(app, req, "authenticated")
+		ctx.AuthenticatedUser = &UserStub{ID: userID}
+
+		err := ctl.Usage(ctx)
+		assert.Nil(err)
+
+		resp := StorageUsageJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return &resp
+	}
+
+	filePlugin.Quota = QuotaCfg{UserLimit: 25}
+
+	first, err := upload("6001", "0123456789")
+	assert.Nil(err)
+
+	t.Run("Should reject uploads over the user quota", func(t *testing.T) {
+		_, err := upload("6001", "01234567890123456789")
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*bolo.HTTPError).Code)
+
+		// other users have their own quota
+		_, err = upload("6002", "01234567890123456789")
+		assert.Nil(err)
+	})
+
+	t.Run("Should check the size of all files in multiple uploads", func(t *testing.T) {
+		uploadMany := func(count int) error {
+			body := bytes.Buffer{}
+			w := multipart.NewWriter(&body)
+			for i := 0; i < count; i++ {
+				part, _ := w.CreateFormFile("files[]", "quota.txt")
+				part.Write([]byte("0123456789"))
+			}
+			w.Close()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+			req.Header.Set("Content-Type", w.FormDataContentType())
+
+			ctx, _ := GetRequestContextStub(app, req, "administrator")
+			ctx.AuthenticatedUser = &UserStub{ID: "6005"}
+
+			return ctl.UploadFile(ctx)
+		}
+
+		err := uploadMany(3)
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*bolo.HTTPError).Code)
+		assert.Equal(int64(0), getUsage("6005").User.Used)
+
+		err = uploadMany(2)
+		assert.Nil(err)
+		assert.Equal(int64(20), getUsage("6005").User.Used)
+	})
+
+	t.Run("Should count image styles in usage", func(t *testing.T) {
+		image := GetImageModelStub()
+		creatorID := int64(6001)
+		image.CreatorID = &creatorID
+		image.SetStyleSize("thumbnail", 4)
+		image.SetStyleSize("medium", 6)
+		err := image.Save()
+		assert.Nil(err)
+		defer image.Destroy()
+
+		usage := getUsage("6001")
+		assert.Equal(int64(10), usage.User.Files)
+		assert.Equal(int64(10), usage.User.Images)
+		assert.Equal(int64(10), usage.User.Styles)
+		assert.Equal(int64(30), usage.User.Used)
+		assert.Equal(int64(25), usage.User.Limit)
+		assert.Nil(usage.Tenant)
+	})
+
+	t.Run("Should release the quota when the file is destroyed", func(t *testing.T) {
+		err := DestroyFileRecord(app, first)
+		assert.Nil(err)
+
+		assert.Equal(int64(0), getUsage("6001").User.Used)
+
+		_, err = upload("6001", "01234567890123456789")
+		assert.Nil(err)
+	})
+
+	t.Run("Should check the tenant quota", func(t *testing.T) {
+		filePlugin.TenantResolver = &tenantResolverStub{tenantID: "quota-tenant"}
+		defer func() { filePlugin.TenantResolver = nil }()
+		filePlugin.Quota = QuotaCfg{TenantLimit: 15}
+
+		_, err := upload("6003", "0123456789")
+		assert.Nil(err)
+
+		_, err = upload("6004", "0123456789")
+		assert.NotNil(err)
+		assert.Equal(http.StatusRequestEntityTooLarge, err.(*bolo.HTTPError).Code)
+
+		usage := getUsage("6003")
+		assert.Equal(int64(10), usage.Tenant.Used)
+		assert.Equal(int64(15), usage.Tenant.Limit)
+	})
+}
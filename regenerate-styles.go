@@ -0,0 +1,286 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	files_database "github.com/go-bolo/files/database"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type RegenerateStylesOptions struct {
+	// Styles to regenerate, empty to regenerate all configured styles
+	Styles []string `json:"styles"`
+	// Only images created in this range
+	CreatedFrom *time.Time `json:"createdFrom"`
+	CreatedTo   *time.Time `json:"createdTo"`
+	// Only images saved in this storage
+	StorageName string `json:"storageName"`
+	// Only images with one of this mime types
+	Mimes []string `json:"mimes"`
+	// Reset the style urls to be generated on first access instead of generating them now
+	Lazy bool `json:"lazy"`
+	// Only regenerate styles generated with one old style configuration, styles without fingerprint are skipped
+	OnlyOutdated bool `json:"onlyOutdated"`
+	// Images processed at same time, default 4
+	Concurrency int `json:"concurrency"`
+	// Default 100
+	BatchSize int `json:"batchSize"`
+	// Resume cursor, only images with id greater than this are processed
+	AfterID uint64 `json:"afterId"`
+	// Optional report to fill, allows to read the progress while the regeneration runs
+	Report *RegenerateStylesReport `json:"-"`
+}
+
+type RegenerateStylesFailure struct {
+	ImageID uint64 `json:"imageId"`
+	Style   string `json:"style"`
+	Error   string `json:"error"`
+}
+
+type RegenerateStylesReport struct {
+	// Images that match the filters
+	Total     int64 `json:"total"`
+	Processed int64 `json:"processed"`
+	// Generated or reset styles
+	Regenerated     int                       `json:"regenerated"`
+	ObsoleteDeleted int                       `json:"obsoleteDeleted"`
+	Failures        []RegenerateStylesFailure `json:"failures"`
+	// Use as AfterID to resume the regeneration
+	LastID  uint64 `json:"lastId"`
+	Running bool   `json:"running"`
+
+	mu sync.Mutex
+}
+
+// MarshalJSON - Marshal the report, safe to call while the regeneration is running
+func (r *RegenerateStylesReport) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return json.Marshal(&struct {
+		Total           int64                     `json:"total"`
+		Processed       int64                     `json:"processed"`
+		Regenerated     int                       `json:"regenerated"`
+		ObsoleteDeleted int                       `json:"obsoleteDeleted"`
+		Failures        []RegenerateStylesFailure `json:"failures"`
+		LastID          uint64                    `json:"lastId"`
+		Running         bool                      `json:"running"`
+	}{r.Total, r.Processed, r.Regenerated, r.ObsoleteDeleted, r.Failures, r.LastID, r.Running})
+}
+
+func (r *RegenerateStylesReport) isRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Running
+}
+
+func (r *RegenerateStylesReport) setRunning(running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Running = running
+}
+
+// RegenerateStyles - Regenerate the image styles of all images that match the filters and delete the
+// style objects of styles removed from the plugin configuration
+func RegenerateStyles(ctx context.Context, app bolo.App, opts *RegenerateStylesOptions) (*RegenerateStylesReport, error) {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	db := app.GetDB()
+
+	report := opts.Report
+	if report == nil {
+		report = &RegenerateStylesReport{}
+	}
+
+	report.mu.Lock()
+	report.Failures = []RegenerateStylesFailure{}
+	report.LastID = opts.AfterID
+	report.mu.Unlock()
+
+	report.setRunning(true)
+	defer report.setRunning(false)
+
+	styles := opts.Styles
+	if len(styles) == 0 {
+		for style := range filePlugin.ImageStyles {
+			styles = append(styles, style)
+		}
+	}
+
+	for _, style := range styles {
+		if _, ok := filePlugin.ImageStyles[style]; !ok {
+			return report, fmt.Errorf("RegenerateStyles: invalid image style %s", style)
+		}
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	query := db.Model(&ImageModel{})
+
+	if opts.CreatedFrom != nil {
+		query = query.Where("createdAt >= ?", opts.CreatedFrom)
+	}
+
+	if opts.CreatedTo != nil {
+		query = query.Where("createdAt <= ?", opts.CreatedTo)
+	}
+
+	if opts.StorageName != "" {
+		query = query.Where("storageName = ?", opts.StorageName)
+	}
+
+	if len(opts.Mimes) > 0 {
+		query = query.Where("mime IN ?", opts.Mimes)
+	}
+
+	var total int64
+	err := query.Session(&gorm.Session{}).Where("id > ?", opts.AfterID).Count(&total).Error
+	if err != nil {
+		return report, fmt.Errorf("RegenerateStyles error on count images: %w", err)
+	}
+
+	report.mu.Lock()
+	report.Total = total
+	report.mu.Unlock()
+
+	lastID := opts.AfterID
+
+	for {
+		var records []ImageModel
+		err := query.Session(&gorm.Session{}).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(opts.BatchSize).
+			Find(&records).Error
+		if err != nil {
+			return report, fmt.Errorf("RegenerateStyles error on find images: %w", err)
+		}
+
+		if len(records) == 0 {
+			return report, nil
+		}
+
+		files_helpers.RunConcurrently(ctx, len(records), opts.Concurrency, func(i int) {
+			regenerateRecordStyles(app, &records[i], styles, opts, report)
+		})
+
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		lastID = records[len(records)-1].ID
+
+		report.mu.Lock()
+		report.LastID = lastID
+		logrus.WithFields(logrus.Fields{
+			"processed": report.Processed,
+			"total":     report.Total,
+			"failures":  len(report.Failures),
+			"lastId":    report.LastID,
+		}).Info("RegenerateStyles progress")
+		report.mu.Unlock()
+	}
+}
+
+func regenerateRecordStyles(app bolo.App, record *ImageModel, styles []string, opts *RegenerateStylesOptions, report *RegenerateStylesReport) {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	storage := filePlugin.GetImageStorage(record)
+
+	failures := []RegenerateStylesFailure{}
+	regenerated := 0
+	obsoleteDeleted := 0
+
+	if record.URLs == nil {
+		record.URLs = files_database.ImageURLsField{}
+	}
+
+	if record.StyleVersions == nil {
+		record.StyleVersions = files_database.ImageURLsField{}
+	}
+
+	ignored := record.Extension != nil && filePlugin.IsFormatIgnored(*record.Extension)
+
+	for _, style := range sortedStyles(record.URLs) {
+		if _, ok := filePlugin.ImageStyles[style]; ok || style == "original" {
+			continue
+		}
+
+		// obsolete styles of ignored formats or not generated yet have no object
+		if !ignored && !IsPendingStyleURL(record, style) {
+			err := storage.DeleteImageStyle(record, style, filePlugin.ImageFormat)
+			if err != nil {
+				failures = append(failures, RegenerateStylesFailure{ImageID: record.ID, Style: style, Error: err.Error()})
+				continue
+			}
+		}
+
+		delete(record.URLs, style)
+		delete(record.StyleVersions, style)
+		record.RemoveStyleSize(style)
+		obsoleteDeleted++
+	}
+
+	for _, style := range styles {
+		var err error
+
+		if opts.OnlyOutdated && !filePlugin.IsStyleOutdated(record, style) {
+			continue
+		}
+
+		if opts.Lazy && !ignored {
+			if record.URLs[style] != "" && !IsPendingStyleURL(record, style) {
+				err = storage.DeleteImageStyle(record, style, filePlugin.ImageFormat)
+			}
+
+			if err == nil {
+				record.URLs[style] = GetPendingStyleURL(app, record, style)
+				delete(record.StyleVersions, style)
+				record.RemoveStyleSize(style)
+			}
+		} else {
+			err = GenerateImageStyle(app, record, style)
+		}
+
+		if err != nil {
+			failures = append(failures, RegenerateStylesFailure{ImageID: record.ID, Style: style, Error: err.Error()})
+			continue
+		}
+
+		regenerated++
+	}
+
+	err := app.GetDB().
+		Model(&ImageModel{}).
+		Where("id = ?", record.ID).
+		Updates(map[string]interface{}{
+			"urls":          record.URLs,
+			"styleVersions": record.StyleVersions,
+			"styleSizes":    record.StyleSizes,
+			"stylesSize":    record.StylesSize,
+		}).Error
+	if err != nil {
+		failures = append(failures, RegenerateStylesFailure{ImageID: record.ID, Error: err.Error()})
+	}
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	report.Processed++
+	report.Regenerated += regenerated
+	report.ObsoleteDeleted += obsoleteDeleted
+	report.Failures = append(report.Failures, failures...)
+}
@@ -0,0 +1,204 @@
+package files
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	files_database "github.com/go-bolo/files/database"
+	files_processor "github.com/go-bolo/files/processor"
+	files_storages "github.com/go-bolo/files/storages"
+	"github.com/stretchr/testify/assert"
+)
+
+type copyProcessorStub struct{}
+
+func (p *copyProcessorStub) Resize(sourcePath, destPath, fileName string, opts files_processor.Options) error {
+	return os.WriteFile(destPath, []byte("resized "+opts["width"]), 0644)
+}
+
+func TestRegenerateStyles(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	storagePath := "/tmp/_test_files_regenerate"
+	defer os.RemoveAll(storagePath)
+
+	storage := files_storages.NewLocal(&files_storages.LocalCfg{App: app, DestinationPath: storagePath})
+	filePlugin.SetStorage("regenerate-test", storage)
+	defer delete(filePlugin.Storages, "regenerate-test")
+
+	processor := filePlugin.Processor
+	filePlugin.Processor = &copyProcessorStub{}
+	defer func() { filePlugin.Processor = processor }()
+
+	tmpFilePath := filepath.Join(os.TempDir(), "regenerate-test.txt")
+	err := os.WriteFile(tmpFilePath, []byte("image"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	newImage := func(name, mime string) *ImageModel {
+		record := GetImageModelStub()
+		record.Name = name
+		record.Mime = &mime
+		record.StorageName = "regenerate-test"
+		record.CreatedAt = time.Now()
+
+		urls := files_database.ImageURLsField{}
+		for _, style := range []string{"original", "thumbnail", "removed-style"} {
+			p, _ := storage.GetUploadPathFromFile(style, "", &record)
+			err := storage.UploadFile(&record, tmpFilePath, p)
+			assert.Nil(err)
+			urls[style], _ = storage.GetUrlFromFile(style, &record)
+		}
+		record.SetURLs(urls)
+
+		err := record.Save()
+		assert.Nil(err)
+
+		return &record
+	}
+
+	objectExists := func(record *ImageModel, style string) bool {
+		p, _ := storage.GetUploadPathFromFile(style, "", record)
+		_, err := os.Stat(filepath.Join(storagePath, p))
+		return err == nil
+	}
+
+	image := newImage("regenerate-1.png", "image/png")
+	skipped := newImage("regenerate-2.jpg", "image/jpeg")
+
+	t.Run("Should regenerate styles and delete obsolete styles", func(t *testing.T) {
+		report, err := RegenerateStyles(context.Background(), app, &RegenerateStylesOptions{
+			Styles:      []string{"thumbnail"},
+			StorageName: "regenerate-test",
+			Mimes:       []string{"image/png"},
+			Concurrency: 2,
+		})
+		assert.Nil(err)
+		assert.Equal(int64(1), report.Total)
+		assert.Equal(int64(1), report.Processed)
+		assert.Equal(1, report.Regenerated)
+		assert.Equal(1, report.ObsoleteDeleted)
+		assert.Len(report.Failures, 0)
+		assert.Equal(image.ID, report.LastID)
+
+		updated := ImageModel{}
+		err = ImageFindOne(image.GetIDString(), &updated)
+		assert.Nil(err)
+		assert.Empty(updated.URLs["removed-style"])
+		assert.False(objectExists(image, "removed-style"))
+
+		data, _ := os.ReadFile(filepath.Join(storagePath, mustUploadPath(storage, "thumbnail", image)))
+		assert.Equal("resized 75", string(data))
+
+		fingerprint := filePlugin.GetStyleFingerprint("thumbnail")
+		assert.Equal(fingerprint, updated.StyleVersions["thumbnail"])
+		assert.True(strings.HasSuffix(updated.URLs["thumbnail"], "?v="+fingerprint))
+		assert.False(filePlugin.IsStyleOutdated(&updated, "thumbnail"))
+
+		assert.True(objectExists(skipped, "removed-style"))
+	})
+
+	t.Run("Should only regenerate outdated styles after style config changes", func(t *testing.T) {
+		thumbnailCfg := filePlugin.ImageStyles["thumbnail"]
+		oldFingerprint := filePlugin.GetStyleFingerprint("thumbnail")
+
+		filePlugin.ImageStyles["thumbnail"] = ImageStyleCfg{Width: 80, Height: 80}
+		defer func() { filePlugin.ImageStyles["thumbnail"] = thumbnailCfg }()
+
+		assert.NotEqual(oldFingerprint, filePlugin.GetStyleFingerprint("thumbnail"))
+
+		record := ImageModel{}
+		err := ImageFindOne(image.GetIDString(), &record)
+		assert.Nil(err)
+		assert.True(filePlugin.IsStyleOutdated(&record, "thumbnail"))
+
+		report, err := RegenerateStyles(context.Background(), app, &RegenerateStylesOptions{
+			StorageName:  "regenerate-test",
+			Mimes:        []string{"image/png"},
+			OnlyOutdated: true,
+		})
+		assert.Nil(err)
+		// the other configured styles were never generated for this image
+		assert.Equal(1, report.Regenerated)
+
+		data, _ := os.ReadFile(filepath.Join(storagePath, mustUploadPath(storage, "thumbnail", image)))
+		assert.Equal("resized 80", string(data))
+
+		err = ImageFindOne(image.GetIDString(), &record)
+		assert.Nil(err)
+		assert.False(filePlugin.IsStyleOutdated(&record, "thumbnail"))
+	})
+
+	t.Run("Should treat styles without fingerprint as current", func(t *testing.T) {
+		record := ImageModel{}
+		err := ImageFindOne(image.GetIDString(), &record)
+		assert.Nil(err)
+
+		record.StyleVersions = nil
+		assert.False(filePlugin.IsStyleOutdated(&record, "thumbnail"))
+	})
+
+	t.Run("Should save the fingerprint of styles without fingerprint when served", func(t *testing.T) {
+		err := app.GetDB().Model(image).UpdateColumn("styleVersions", files_database.ImageURLsField{}).Error
+		assert.Nil(err)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/image/thumbnail/"+image.GetIDString(), nil)
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		ctx.SetParamNames("style", "id")
+		ctx.SetParamValues("thumbnail", image.GetIDString())
+
+		err = filePlugin.ImageController.FindOne(ctx)
+		assert.Nil(err)
+
+		record := ImageModel{}
+		err = ImageFindOne(image.GetIDString(), &record)
+		assert.Nil(err)
+		assert.Equal(filePlugin.GetStyleFingerprint("thumbnail"), record.StyleVersions["thumbnail"])
+
+		// the next style change regenerates the style
+		thumbnailCfg := filePlugin.ImageStyles["thumbnail"]
+		filePlugin.ImageStyles["thumbnail"] = ImageStyleCfg{Width: 90, Height: 90}
+		defer func() { filePlugin.ImageStyles["thumbnail"] = thumbnailCfg }()
+
+		assert.True(filePlugin.IsStyleOutdated(&record, "thumbnail"))
+	})
+
+	t.Run("Should reset styles in lazy mode and resume from cursor", func(t *testing.T) {
+		report, err := RegenerateStyles(context.Background(), app, &RegenerateStylesOptions{
+			StorageName: "regenerate-test",
+			Lazy:        true,
+			AfterID:     image.ID,
+		})
+		assert.Nil(err)
+		assert.Equal(int64(1), report.Processed)
+		assert.Equal(skipped.ID, report.LastID)
+
+		updated := ImageModel{}
+		err = ImageFindOne(skipped.GetIDString(), &updated)
+		assert.Nil(err)
+		assert.True(IsPendingStyleURL(&updated, "thumbnail"))
+		assert.True(IsPendingStyleURL(&updated, "banner"))
+		assert.False(objectExists(skipped, "thumbnail"))
+		assert.False(objectExists(skipped, "removed-style"))
+	})
+
+	t.Run("Should return error with invalid style", func(t *testing.T) {
+		_, err := RegenerateStyles(context.Background(), app, &RegenerateStylesOptions{
+			Styles: []string{"invalid"},
+		})
+		assert.NotNil(err)
+	})
+}
+
+func mustUploadPath(storage Storager, style string, record *ImageModel) string {
+	p, _ := storage.GetUploadPathFromFile(style, "", record)
+	return p
+}
@@ -0,0 +1,226 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrRemoteImportInvalidURL = errors.New("invalid remote url")
+	ErrRemoteImportBlocked    = errors.New("remote address is not allowed")
+	ErrRemoteImportTooLarge   = errors.New("remote file is too large")
+)
+
+// RemoteImportCfg - Limits used to download files from remote urls
+type RemoteImportCfg struct {
+	// Max file size in bytes, default 25MB
+	MaxSize int64
+	// Max time to download the file, default 30s
+	Timeout time.Duration
+	// Default 3
+	MaxRedirects int
+	// Allow loopback and private network addresses, only for development and tests
+	AllowPrivateNetworks bool
+}
+
+// RemoteFile - Information of one downloaded remote file
+type RemoteFile struct {
+	FileName    string
+	ContentType string
+	Size        int64
+	// url after redirects
+	URL string
+}
+
+// RemoteImportRequest - Body of the import endpoints
+type RemoteImportRequest struct {
+	URL         string `json:"url"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	// Optional RFC 3339 date, the imported record is deleted after it
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// remoteImportHTTPError - Get the http error for one DownloadRemoteFile error
+func remoteImportHTTPError(err error) error {
+	switch {
+	case errors.Is(err, ErrRemoteImportInvalidURL), errors.Is(err, ErrRemoteImportBlocked):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrRemoteImportTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		return &echo.HTTPError{
+			Code:     http.StatusBadGateway,
+			Message:  "error on download remote file",
+			Internal: err,
+		}
+	}
+}
+
+// networks not blocked by the net.IP helpers
+var blockedNetworks = []string{
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+}
+
+func isBlockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, cidr := range blockedNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DownloadRemoteFile - Download one http(s) url to dest. The address is checked after the DNS
+// resolution on each connection, including redirects
+func DownloadRemoteFile(ctx context.Context, cfg *RemoteImportCfg, rawURL, dest string) (*RemoteFile, error) {
+	maxSize := cfg.MaxSize
+	if maxSize <= 0 {
+		maxSize = 25 * 1024 * 1024
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	maxRedirects := cfg.MaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = 3
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, ErrRemoteImportInvalidURL
+	}
+
+	dialer := net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if cfg.AllowPrivateNetworks {
+				return nil
+			}
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || isBlockedIP(ip) {
+				return ErrRemoteImportBlocked
+			}
+
+			return nil
+		},
+	}
+
+	client := http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// never use proxies from env, the proxy address would be checked instead of the remote one
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrRemoteImportInvalidURL
+			}
+
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, ErrRemoteImportInvalidURL
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrRemoteImportBlocked) {
+			return nil, ErrRemoteImportBlocked
+		}
+		if errors.Is(err, ErrRemoteImportInvalidURL) {
+			return nil, ErrRemoteImportInvalidURL
+		}
+		return nil, fmt.Errorf("error on download remote file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("error on download remote file, status %d", resp.StatusCode)
+	}
+
+	if resp.ContentLength > maxSize {
+		return nil, ErrRemoteImportTooLarge
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := io.Copy(f, io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error on download remote file: %w", err)
+	}
+
+	if size > maxSize {
+		return nil, ErrRemoteImportTooLarge
+	}
+
+	return &RemoteFile{
+		FileName:    getRemoteFileName(resp),
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        size,
+		URL:         resp.Request.URL.String(),
+	}, nil
+}
+
+// get the file name from the Content-Disposition header or from the url path
+func getRemoteFileName(resp *http.Response) string {
+	if cd := resp.Header.Get("Content-Disposition"); cd != "" {
+		_, params, err := mime.ParseMediaType(cd)
+		if err == nil && params["filename"] != "" {
+			return path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+		}
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if name == "" || name == "." || name == "/" {
+		return "download"
+	}
+
+	return name
+}
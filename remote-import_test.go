@@ -0,0 +1,123 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadRemoteFile(t *testing.T) {
+	assert := assert.New(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/docs/report.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("remote content"))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", `attachment; filename="../Contract.pdf"`)
+		w.Write([]byte("pdf"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 100)))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dest := filepath.Join(os.TempDir(), "remote-import-test")
+	defer os.Remove(dest)
+
+	allowed := RemoteImportCfg{AllowPrivateNetworks: true, MaxSize: 50}
+
+	t.Run("Should download the remote file", func(t *testing.T) {
+		remoteFile, err := DownloadRemoteFile(context.Background(), &allowed, server.URL+"/docs/report.txt", dest)
+		assert.Nil(err)
+		assert.Equal("report.txt", remoteFile.FileName)
+		assert.Equal(int64(14), remoteFile.Size)
+
+		data, _ := os.ReadFile(dest)
+		assert.Equal("remote content", string(data))
+	})
+
+	t.Run("Should get the file name from Content-Disposition", func(t *testing.T) {
+		remoteFile, err := DownloadRemoteFile(context.Background(), &allowed, server.URL+"/download", dest)
+		assert.Nil(err)
+		assert.Equal("Contract.pdf", remoteFile.FileName)
+	})
+
+	t.Run("Should block private network addresses", func(t *testing.T) {
+		_, err := DownloadRemoteFile(context.Background(), &RemoteImportCfg{}, server.URL+"/docs/report.txt", dest)
+		assert.ErrorIs(err, ErrRemoteImportBlocked)
+	})
+
+	t.Run("Should reject invalid urls", func(t *testing.T) {
+		_, err := DownloadRemoteFile(context.Background(), &allowed, "file:///etc/passwd", dest)
+		assert.ErrorIs(err, ErrRemoteImportInvalidURL)
+	})
+
+	t.Run("Should reject large files", func(t *testing.T) {
+		_, err := DownloadRemoteFile(context.Background(), &allowed, server.URL+"/large", dest)
+		assert.ErrorIs(err, ErrRemoteImportTooLarge)
+	})
+
+	t.Run("Should limit redirects", func(t *testing.T) {
+		_, err := DownloadRemoteFile(context.Background(), &allowed, server.URL+"/loop", dest)
+		assert.NotNil(err)
+		assert.Contains(err.Error(), "redirects")
+	})
+
+	t.Run("Should block reserved ips", func(t *testing.T) {
+		for _, ip := range []string{"127.0.0.1", "10.1.2.3", "169.254.169.254", "100.64.0.1", "::1", "fd00::1", "0.0.0.0"} {
+			assert.True(isBlockedIP(net.ParseIP(ip)), ip)
+		}
+
+		assert.False(isBlockedIP(net.ParseIP("8.8.8.8")))
+	})
+}
+
+func TestFileControllerImport(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("imported content"))
+	}))
+	defer server.Close()
+
+	remoteImport := filePlugin.RemoteImport
+	filePlugin.RemoteImport = RemoteImportCfg{AllowPrivateNetworks: true}
+	defer func() { filePlugin.RemoteImport = remoteImport }()
+
+	sourceURL := server.URL + "/files/notes.txt"
+	body := `{"url": "` + sourceURL + `", "label": "Notes"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/file/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, rec := GetRequestContextStub(app, req, "administrator")
+	err := filePlugin.FileController.Import(ctx)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, rec.Code)
+
+	resp := FileFindOneJSONResponse{}
+	err = json.Unmarshal(rec.Body.Bytes(), &resp)
+	assert.Nil(err)
+	assert.Equal("notes.txt", resp.Record.Originalname)
+	assert.Equal("Notes", *resp.Record.Label)
+
+	saved := FileModel{}
+	err = FileFindOne(resp.Record.GetIDString(), &saved)
+	assert.Nil(err)
+	saved.LoadData()
+	assert.Equal(sourceURL, saved.ExtraData.Keys["sourceURL"])
+}
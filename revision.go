@@ -0,0 +1,640 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrReplaceFormatMismatch = errors.New("image contents can only be replaced with one image of the same stored format")
+
+// RevisionModel - Previous contents of one file or image, saved when the contents are replaced. The object is
+// stored with the record name in the "revision-<number>" style, so the record urls don't change
+type RevisionModel struct {
+	ID           uint64  `gorm:"column:id;primary_key" json:"id"`
+	RecordType   string  `gorm:"column:recordType;type:varchar(20);not null;uniqueIndex:mediarevisions_record_number" json:"recordType"`
+	RecordID     uint64  `gorm:"column:recordId;not null;uniqueIndex:mediarevisions_record_number" json:"recordId"`
+	Number       int     `gorm:"column:number;not null;uniqueIndex:mediarevisions_record_number" json:"number"`
+	Size         int64   `gorm:"column:size;not null;default:0" json:"size"`
+	Checksum     string  `gorm:"column:checksum;type:varchar(64)" json:"checksum"`
+	Mime         *string `gorm:"column:mime;type:varchar(255)" json:"mime"`
+	Extension    *string `gorm:"column:extension;type:varchar(255)" json:"extension"`
+	Originalname string  `gorm:"column:originalname;type:varchar(255)" json:"originalname"`
+	// Image dimensions, 0 in files
+	Width       int    `gorm:"column:width;not null;default:0" json:"width"`
+	Height      int    `gorm:"column:height;not null;default:0" json:"height"`
+	StorageName string `gorm:"column:storageName;type:varchar(255)" json:"storageName"`
+	TenantID    string `gorm:"column:tenantId;type:varchar(100);not null;default:''" json:"-"`
+	// Who uploaded the contents and when
+	CreatorID *int64    `gorm:"column:creatorId;type:int(11)" json:"creatorId"`
+	CreatedAt time.Time `gorm:"column:createdAt;type:datetime;not null" json:"createdAt"`
+	// Who replaced the contents and when
+	ReplacedByID *int64    `gorm:"column:replacedById;type:int(11)" json:"replacedById"`
+	ReplacedAt   time.Time `gorm:"column:replacedAt;type:datetime;not null" json:"replacedAt"`
+}
+
+// TableName get sql table name
+func (m *RevisionModel) TableName() string {
+	return "mediarevisions"
+}
+
+// GetStyle - Style used in the revision object path
+func (m *RevisionModel) GetStyle() string {
+	return getRevisionStyle(m.Number)
+}
+
+func getRevisionStyle(number int) string {
+	return "revision-" + strconv.Itoa(number)
+}
+
+// GetRecordRevisions - Get the revisions of one file or image, newest first
+func GetRecordRevisions(db *gorm.DB, recordType string, recordID uint64) ([]*RevisionModel, error) {
+	revisions := []*RevisionModel{}
+	err := db.
+		Where("recordType = ? AND recordId = ?", recordType, recordID).
+		Order("number DESC").
+		Find(&revisions).Error
+
+	return revisions, err
+}
+
+// GetRecordRevision - Get one revision by number, returns gorm.ErrRecordNotFound if it doesn't exist
+func GetRecordRevision(db *gorm.DB, recordType string, recordID uint64, number string) (*RevisionModel, error) {
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	revision := RevisionModel{}
+	err = db.
+		Where("recordType = ? AND recordId = ? AND number = ?", recordType, recordID, n).
+		First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// replaceLocks - Content replacements of one record run one at a time, so each one saves the next revision
+// number and backs up the contents saved by the previous one. Records are spread in a fixed set of locks
+var replaceLocks [64]sync.Mutex
+
+// lockRecordContents - Lock the contents of one record, call the returned func to unlock
+func lockRecordContents(recordType string, recordID uint64) func() {
+	h := fnv.New32a()
+	h.Write([]byte(recordType + ":" + strconv.FormatUint(recordID, 10)))
+
+	mu := &replaceLocks[h.Sum32()%uint32(len(replaceLocks))]
+	mu.Lock()
+
+	return mu.Unlock
+}
+
+// newRevision - Start one revision of the current record contents. Contents uploaded before the first
+// replacement belong to the record creator, later contents to the user that replaced them
+func newRevision(ctx *bolo.RequestContext, recordType string, recordID uint64, creatorID *int64, createdAt time.Time) (*RevisionModel, error) {
+	last := RevisionModel{}
+	err := ctx.App.GetDB().
+		Where("recordType = ? AND recordId = ?", recordType, recordID).
+		Order("number DESC").
+		Limit(1).
+		Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+
+	revision := RevisionModel{
+		RecordType:   recordType,
+		RecordID:     recordID,
+		Number:       last.Number + 1,
+		CreatorID:    creatorID,
+		CreatedAt:    createdAt,
+		ReplacedByID: getCreatorID(ctx),
+		ReplacedAt:   time.Now(),
+	}
+
+	if last.ID != 0 {
+		revision.CreatorID = last.ReplacedByID
+		revision.CreatedAt = last.ReplacedAt
+	}
+
+	return &revision, nil
+}
+
+// saveRevisionObject - Copy the stored original to the revision object. Returns one local copy of the
+// original, used to restore it if the replacement fails, remove it after use
+func saveRevisionObject(ctx context.Context, storage Storager, file files_dtos.FileDTO, format string, revision *RevisionModel) (string, error) {
+	originalPath, _ := storage.GetUploadPathFromFile("original", format, file)
+
+	tmpFilePath, err := downloadOriginalObject(ctx, storage, originalPath)
+	if err != nil {
+		return "", fmt.Errorf("error on download original: %w", err)
+	}
+
+	revisionPath, _ := storage.GetUploadPathFromFile(revision.GetStyle(), format, file)
+
+	err = storage.UploadFile(file, tmpFilePath, revisionPath)
+	if err != nil {
+		os.Remove(tmpFilePath)
+		return "", fmt.Errorf("error on upload revision: %w", err)
+	}
+
+	return tmpFilePath, nil
+}
+
+// finishReplace - Save the revision and the replaced record in one transaction. If the transaction fails the
+// previous original is uploaded again and the revision object is deleted, unless the revision number was
+// saved by other replacement
+func finishReplace(app bolo.App, storage Storager, file files_dtos.FileDTO, format, backupFilePath string, revision *RevisionModel, save func(tx *gorm.DB) error) error {
+	err := app.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(revision).Error
+		if err != nil {
+			return err
+		}
+
+		return save(tx)
+	})
+	if err == nil {
+		return nil
+	}
+
+	// one revision with the same number saved by other process owns the stored original and revision objects
+	var saved int64
+	countErr := app.GetDB().Model(&RevisionModel{}).
+		Where("recordType = ? AND recordId = ? AND number = ?", revision.RecordType, revision.RecordID, revision.Number).
+		Count(&saved).Error
+	if countErr != nil || saved > 0 {
+		logrus.WithFields(logrus.Fields{
+			"recordType": revision.RecordType,
+			"recordId":   revision.RecordID,
+			"number":     revision.Number,
+			"error":      countErr,
+		}).Error("finishReplace revision saved by other replacement, the stored objects are kept")
+		return err
+	}
+
+	originalPath, _ := storage.GetUploadPathFromFile("original", format, file)
+
+	rollbackErr := storage.UploadFile(file, backupFilePath, originalPath)
+	if rollbackErr == nil {
+		rollbackErr = storage.DeleteImageStyle(file, revision.GetStyle(), format)
+	}
+	if rollbackErr != nil {
+		logrus.WithFields(logrus.Fields{
+			"recordType": revision.RecordType,
+			"recordId":   revision.RecordID,
+			"error":      rollbackErr,
+		}).Error("finishReplace error on restore previous original")
+	}
+
+	return err
+}
+
+// pruneRevisions - Delete the oldest revisions over the FilePlugin.MaxRevisions limit. Rows are only deleted
+// after their objects, failures are logged and retried in the next replacement
+func pruneRevisions(app bolo.App, recordType string, recordID uint64, storage Storager, file files_dtos.FileDTO, format string) {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	if filePlugin.MaxRevisions < 0 {
+		return
+	}
+
+	db := app.GetDB()
+
+	revisions, err := GetRecordRevisions(db, recordType, recordID)
+	if err != nil || len(revisions) <= filePlugin.MaxRevisions {
+		return
+	}
+
+	for _, revision := range revisions[filePlugin.MaxRevisions:] {
+		err := deleteRevision(db, getRevisionStorage(filePlugin, revision, storage), revision, file, format)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"recordType": recordType,
+				"recordId":   recordID,
+				"number":     revision.Number,
+				"error":      err,
+			}).Warn("pruneRevisions error on delete revision")
+		}
+	}
+}
+
+func deleteRevision(db *gorm.DB, storage Storager, revision *RevisionModel, file files_dtos.FileDTO, format string) error {
+	if storage != nil {
+		err := storage.DeleteImageStyle(file, revision.GetStyle(), format)
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.Delete(revision).Error
+}
+
+// deleteStoredRevisions - Delete the objects of all record revisions, used before destroying the record.
+// Returns one DestroyError with the revision styles that failed
+func deleteStoredRevisions(app bolo.App, recordType string, recordID uint64, recordStorage Storager, file files_dtos.FileDTO, format string) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	revisions, err := GetRecordRevisions(app.GetDB(), recordType, recordID)
+	if err != nil {
+		return err
+	}
+
+	failures := map[string]error{}
+
+	for _, revision := range revisions {
+		storage := getRevisionStorage(filePlugin, revision, recordStorage)
+		if storage == nil {
+			failures[revision.GetStyle()] = ErrStorageNotFound
+			continue
+		}
+
+		err := storage.DeleteImageStyle(file, revision.GetStyle(), format)
+		if err != nil {
+			failures[revision.GetStyle()] = err
+		}
+	}
+
+	if len(failures) > 0 {
+		return &DestroyError{RecordID: recordID, Failures: failures}
+	}
+
+	return nil
+}
+
+// deleteRecordRevisions - Delete the revision rows of one record, objects are deleted with deleteStoredRevisions
+func deleteRecordRevisions(tx *gorm.DB, recordType string, recordID uint64) error {
+	return tx.Where("recordType = ? AND recordId = ?", recordType, recordID).Delete(&RevisionModel{}).Error
+}
+
+// getRevisionStorage - Get the storage where the revision object is saved, fallback to the record storage
+func getRevisionStorage(filePlugin *FilePlugin, revision *RevisionModel, recordStorage Storager) Storager {
+	if storage := filePlugin.GetStorage(revision.StorageName); storage != nil {
+		return storage
+	}
+
+	return recordStorage
+}
+
+// downloadRevisionObject - Save the revision object in one local tmp file, remove it after use
+func downloadRevisionObject(ctx context.Context, storage Storager, file files_dtos.FileDTO, format string, revision *RevisionModel) (string, error) {
+	revisionPath, _ := storage.GetUploadPathFromFile(revision.GetStyle(), format, file)
+
+	return downloadOriginalObject(ctx, storage, revisionPath)
+}
+
+// ReplaceFileContents - Replace the stored original of one file with the local file, the file id, name and
+// urls are kept. The previous contents are saved as one new revision, that is returned. Replacements of one
+// record run one at a time and the record is loaded again before the replacement
+func ReplaceFileContents(ctx *bolo.RequestContext, record *FileModel, fileName, filePath string) (*RevisionModel, error) {
+	app := ctx.App
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	unlock := lockRecordContents(AccessRecordTypeFile, record.ID)
+	defer unlock()
+
+	// other replacement may have changed the contents while waiting the lock
+	current := FileModel{}
+	err := app.GetDB().Where("id = ?", record.ID).First(&current).Error
+	if err != nil {
+		return nil, err
+	}
+	*record = current
+
+	description := ""
+	if record.Description != nil {
+		description = *record.Description
+	}
+
+	before := BeforeUploadEvent{
+		RecordType:  AccessRecordTypeFile,
+		File:        record,
+		FileName:    fileName,
+		Description: description,
+		FilePath:    filePath,
+		StorageName: record.StorageName,
+		Replace:     true,
+	}
+
+	err = triggerVetoEvent(app, EventBeforeUpload, &before)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName = before.FileName
+	if before.Description != description {
+		record.Description = &before.Description
+	}
+
+	storage := filePlugin.GetFileStorage(record)
+
+	revision, err := newRevision(ctx, AccessRecordTypeFile, record.ID, record.CreatorID, record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Checksum = record.Checksum
+	revision.Mime = record.Mime
+	revision.Extension = record.Extension
+	revision.Originalname = record.Originalname
+	revision.StorageName = record.StorageName
+	revision.TenantID = record.TenantID
+	if record.Size != nil {
+		revision.Size = *record.Size
+	}
+
+	backupFilePath, err := saveRevisionObject(ctx.Request().Context(), storage, record, "", revision)
+	if err != nil {
+		return nil, fmt.Errorf("ReplaceFileContents error on save revision of file %d: %w", record.ID, err)
+	}
+	defer os.Remove(backupFilePath)
+
+	mimeType, extension, _ := files_helpers.GetFileExtensionAndMimeType(filePath)
+	if extension != "" {
+		record.Extension = &extension
+		record.Mime = &mimeType
+	} else {
+		record.Extension, record.Mime = nil, nil
+		if ext := strings.TrimPrefix(path.Ext(fileName), "."); ext != "" {
+			record.Extension = &ext
+		}
+	}
+
+	fileStatus, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	size := fileStatus.Size()
+
+	record.Checksum, err = files_helpers.FileChecksum(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("ReplaceFileContents error on get file checksum: %w", err)
+	}
+
+	record.Size = &size
+	record.Originalname = fileName
+
+	originalPath, _ := storage.GetUploadPathFromFile("original", "", record)
+
+	err = storage.UploadFile(record, filePath, originalPath)
+	if err != nil {
+		storage.DeleteImageStyle(record, revision.GetStyle(), "")
+		return nil, fmt.Errorf("ReplaceFileContents error on upload file: %w", err)
+	}
+
+	record.extractedText = extractSearchText(filePlugin, filePath, mimeType)
+
+	err = finishReplace(app, storage, record, "", backupFilePath, revision, func(tx *gorm.DB) error {
+		err := tx.Save(record).Error
+		if err != nil {
+			return err
+		}
+
+		return IndexFileSearch(tx, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ReplaceFileContents error on save file %d: %w", record.ID, err)
+	}
+
+	pruneRevisions(app, AccessRecordTypeFile, record.ID, storage, record, "")
+
+	triggerAfterReplace(ctx, record, nil)
+
+	return revision, nil
+}
+
+// RestoreFileRevision - Replace the file contents with the contents of one revision, the current contents
+// are saved as one new revision
+func RestoreFileRevision(ctx *bolo.RequestContext, record *FileModel, revision *RevisionModel) (*RevisionModel, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	storage := getRevisionStorage(filePlugin, revision, filePlugin.GetFileStorage(record))
+
+	tmpFilePath, err := downloadRevisionObject(ctx.Request().Context(), storage, record, "", revision)
+	if err != nil {
+		return nil, fmt.Errorf("RestoreFileRevision error on download revision %d of file %d: %w", revision.Number, record.ID, err)
+	}
+	defer os.Remove(tmpFilePath)
+
+	return ReplaceFileContents(ctx, record, revision.Originalname, tmpFilePath)
+}
+
+// getImageStoredFormat - Format of the stored image original, images are converted to the plugin ImageFormat
+// on upload, except the ignored formats
+func getImageStoredFormat(filePlugin *FilePlugin, record *ImageModel) string {
+	if record.Extension != nil && filePlugin.IsFormatIgnored(*record.Extension) {
+		return *record.Extension
+	}
+
+	return filePlugin.ImageFormat
+}
+
+// ReplaceImageContents - Replace the stored original of one image with the local file, the image id, name
+// and original url are kept and the styles are generated again. The new image should be stored in the same
+// format, so ignored formats like gif can only be replaced with the same format. The previous contents are
+// saved as one new revision, that is returned
+func ReplaceImageContents(ctx *bolo.RequestContext, record *ImageModel, fileName, filePath string) (*RevisionModel, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+
+	extension := getImageUploadExtension(fileName, filePath)
+	storedExtension := filePlugin.ImageFormat
+	if filePlugin.IsFormatIgnored(extension) {
+		storedExtension = extension
+	}
+
+	if !strings.EqualFold(strings.TrimPrefix(path.Ext(record.Name), "."), storedExtension) {
+		return nil, ErrReplaceFormatMismatch
+	}
+
+	return replaceImageContents(ctx, record, fileName, filePath, nil)
+}
+
+// RestoreImageRevision - Replace the image contents with the contents of one revision, the current contents
+// are saved as one new revision
+func RestoreImageRevision(ctx *bolo.RequestContext, record *ImageModel, revision *RevisionModel) (*RevisionModel, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	format := getImageStoredFormat(filePlugin, record)
+	storage := getRevisionStorage(filePlugin, revision, filePlugin.GetImageStorage(record))
+
+	tmpFilePath, err := downloadRevisionObject(ctx.Request().Context(), storage, record, format, revision)
+	if err != nil {
+		return nil, fmt.Errorf("RestoreImageRevision error on download revision %d of image %d: %w", revision.Number, record.ID, err)
+	}
+	defer os.Remove(tmpFilePath)
+
+	return replaceImageContents(ctx, record, revision.Originalname, tmpFilePath, revision)
+}
+
+// replaceImageContents - Upload the new image contents. Revisions are already processed, so restored
+// contents are uploaded without processing
+func replaceImageContents(ctx *bolo.RequestContext, record *ImageModel, fileName, filePath string, restored *RevisionModel) (*RevisionModel, error) {
+	app := ctx.App
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	unlock := lockRecordContents(AccessRecordTypeImage, record.ID)
+	defer unlock()
+
+	// other replacement may have changed the contents while waiting the lock
+	current := ImageModel{}
+	err := app.GetDB().Where("id = ?", record.ID).First(&current).Error
+	if err != nil {
+		return nil, err
+	}
+	*record = current
+
+	description := ""
+	if record.Description != nil {
+		description = *record.Description
+	}
+
+	before := BeforeUploadEvent{
+		RecordType:  AccessRecordTypeImage,
+		Image:       record,
+		FileName:    fileName,
+		Description: description,
+		FilePath:    filePath,
+		StorageName: record.StorageName,
+		Replace:     true,
+	}
+
+	err = triggerVetoEvent(app, EventBeforeUpload, &before)
+	if err != nil {
+		return nil, err
+	}
+
+	fileName = before.FileName
+	if before.Description != description {
+		record.Description = &before.Description
+	}
+
+	storage := filePlugin.GetImageStorage(record)
+	format := getImageStoredFormat(filePlugin, record)
+
+	revision, err := newRevision(ctx, AccessRecordTypeImage, record.ID, record.CreatorID, record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Checksum = record.Checksum
+	revision.Mime = record.Mime
+	revision.Extension = record.Extension
+	revision.Originalname = record.Originalname
+	revision.Width = record.Width
+	revision.Height = record.Height
+	revision.StorageName = record.StorageName
+	revision.TenantID = record.TenantID
+	if record.Size != nil {
+		revision.Size = *record.Size
+	}
+
+	backupFilePath, err := saveRevisionObject(ctx.Request().Context(), storage, record, format, revision)
+	if err != nil {
+		return nil, fmt.Errorf("replaceImageContents error on save revision of image %d: %w", record.ID, err)
+	}
+	defer os.Remove(backupFilePath)
+
+	// style objects of the previous contents, they are only deleted after the new contents are saved so
+	// one failed replacement keeps the image with all styles
+	previousStyles := []string{}
+	for style := range record.URLs {
+		if style == "original" || style == "" || record.URLs[style] == record.URLs["original"] || IsPendingStyleURL(record, style) {
+			continue
+		}
+
+		previousStyles = append(previousStyles, style)
+		record.RemoveStyleSize(style)
+
+		if _, ok := filePlugin.ImageStyles[style]; !ok {
+			delete(record.URLs, style)
+		}
+	}
+	record.StyleVersions = nil
+
+	storageName := record.StorageName
+	if storageName == "" {
+		storageName = filePlugin.ImageStorageName
+	}
+
+	if restored != nil {
+		err = uploadRestoredImage(app, storage, record, format, filePath, restored)
+	} else {
+		err = uploadImageFromLocalhost(fileName, before.Description, filePath, storageName, record, app, record.Name)
+	}
+	if err != nil {
+		storage.DeleteImageStyle(record, revision.GetStyle(), format)
+		return nil, fmt.Errorf("replaceImageContents error on upload image: %w", err)
+	}
+
+	err = finishReplace(app, storage, record, format, backupFilePath, revision, func(tx *gorm.DB) error {
+		err := tx.Save(record).Error
+		if err != nil {
+			return err
+		}
+
+		return IndexImageSearch(tx, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("replaceImageContents error on save image %d: %w", record.ID, err)
+	}
+
+	deletePreviousStyles(storage, record, previousStyles, filePlugin.ImageFormat)
+
+	pruneRevisions(app, AccessRecordTypeImage, record.ID, storage, record, format)
+
+	triggerAfterReplace(ctx, nil, record)
+
+	return revision, nil
+}
+
+// deletePreviousStyles - Delete the style objects of the replaced contents. Styles already generated for the
+// new contents are stored in the same paths, so they are kept
+func deletePreviousStyles(storage Storager, record *ImageModel, styles []string, format string) {
+	for _, style := range styles {
+		url := record.URLs[style]
+		if url != "" && url != record.URLs["original"] && !IsPendingStyleURL(record, style) {
+			continue
+		}
+
+		err := storage.DeleteImageStyle(record, style, format)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"imageId": record.ID,
+				"style":   style,
+				"error":   err,
+			}).Warn("replaceImageContents error on delete style")
+		}
+	}
+}
+
+// uploadRestoredImage - Upload one revision as the image original, with the revision metadata
+func uploadRestoredImage(app bolo.App, storage Storager, record *ImageModel, format, filePath string, restored *RevisionModel) error {
+	originalPath, _ := storage.GetUploadPathFromFile("original", format, record)
+
+	err := storage.UploadFile(record, filePath, originalPath)
+	if err != nil {
+		return err
+	}
+
+	size := restored.Size
+	record.Size = &size
+	record.Checksum = restored.Checksum
+	record.Mime = restored.Mime
+	record.Extension = restored.Extension
+	record.Originalname = restored.Originalname
+	record.Width = restored.Width
+	record.Height = restored.Height
+
+	return record.ResetURLs(app)
+}
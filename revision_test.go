@@ -0,0 +1,353 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	files_helpers "github.com/go-bolo/files/helpers"
+	files_processor "github.com/go-bolo/files/processor"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevisions(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	tmpFilePath := filepath.Join(os.TempDir(), "revision-test.txt")
+	err := os.WriteFile(tmpFilePath, []byte("first version"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	creatorID := int64(7001)
+	record := NewFileModel()
+	record.CreatorID = &creatorID
+	err = UploadFileFromLocalhost("contract.txt", "", tmpFilePath, "file", record, app)
+	assert.Nil(err)
+	err = record.Save()
+	assert.Nil(err)
+
+	name, url := record.Name, record.URLs["original"]
+
+	// params are the :id and :number route params
+	call := func(handler func(c echo.Context) error, method, fileName, contents string, params ...string) (*httptest.ResponseRecorder, error) {
+		body := bytes.Buffer{}
+		contentType := ""
+		if fileName != "" {
+			w := multipart.NewWriter(&body)
+			part, _ := w.CreateFormFile("file", fileName)
+			part.Write([]byte(contents))
+			w.Close()
+			contentType = w.FormDataContentType()
+		}
+
+		req := httptest.NewRequest(method, "/api/v2/file", &body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		ctx.AuthenticatedUser = &UserStub{ID: "7002"}
+		ctx.SetParamNames([]string{"id", "number"}[:len(params)]...)
+		ctx.SetParamValues(params...)
+
+		return rec, handler(ctx)
+	}
+
+	replace := func(fileName, contents string) *FileReplaceJSONResponse {
+		rec, err := call(ctl.Replace, http.MethodPost, fileName, contents, record.GetIDString())
+		assert.Nil(err)
+
+		resp := FileReplaceJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return &resp
+	}
+
+	listRevisions := func() []*RevisionModel {
+		rec, err := call(ctl.QueryRevisions, http.MethodGet, "", "", record.GetIDString())
+		assert.Nil(err)
+
+		resp := RevisionListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Records
+	}
+
+	download := func(number int) *httptest.ResponseRecorder {
+		rec, err := call(ctl.DownloadRevision, http.MethodGet, "", "", record.GetIDString(), strconv.Itoa(number))
+		assert.Nil(err)
+		return rec
+	}
+
+	downloadCurrent := func() string {
+		rec, err := call(ctl.Download, http.MethodGet, "", "", record.GetIDString())
+		assert.Nil(err)
+		return rec.Body.String()
+	}
+
+	t.Run("Should replace the contents keeping the id, name and url", func(t *testing.T) {
+		firstChecksum := record.Checksum
+
+		resp := replace("contract-v2.txt", "second version!")
+		assert.Equal(record.ID, resp.Record.ID)
+		assert.Equal(name, resp.Record.Name)
+		assert.Equal(url, resp.Record.URLs["original"])
+		assert.Equal("contract-v2.txt", resp.Record.Originalname)
+		assert.Equal(int64(15), *resp.Record.Size)
+		assert.NotEqual(firstChecksum, resp.Record.Checksum)
+		assert.Equal("second version!", downloadCurrent())
+
+		assert.Equal(1, resp.Revision.Number)
+		assert.Equal(firstChecksum, resp.Revision.Checksum)
+		assert.Equal(int64(13), resp.Revision.Size)
+		assert.Equal("contract.txt", resp.Revision.Originalname)
+		// uploaded by the record creator and replaced by the request user
+		assert.Equal(creatorID, *resp.Revision.CreatorID)
+		assert.Equal(int64(7002), *resp.Revision.ReplacedByID)
+
+		rec := download(1)
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("first version", rec.Body.String())
+		assert.Contains(rec.Header().Get("Content-Disposition"), "contract.txt")
+
+		revisions := listRevisions()
+		assert.Len(revisions, 1)
+	})
+
+	t.Run("Should restore one revision as new contents", func(t *testing.T) {
+		rec, err := call(ctl.RestoreRevision, http.MethodPost, "", "", record.GetIDString(), "1")
+		assert.Nil(err)
+
+		resp := FileReplaceJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal(name, resp.Record.Name)
+		assert.Equal("contract.txt", resp.Record.Originalname)
+		assert.Equal("first version", downloadCurrent())
+
+		// the replaced contents were uploaded by the user that replaced the first version
+		assert.Equal(2, resp.Revision.Number)
+		assert.Equal(int64(7002), *resp.Revision.CreatorID)
+		assert.Equal("second version!", download(2).Body.String())
+
+		revisions := listRevisions()
+		assert.Equal([]int{2, 1}, []int{revisions[0].Number, revisions[1].Number})
+
+		usage, err := GetUserStorageUsage(app, "7001")
+		assert.Nil(err)
+		assert.Equal(int64(13+15), usage.Revisions)
+		assert.Equal(int64(13+13+15), usage.Used)
+	})
+
+	t.Run("Should delete the oldest revisions over the limit", func(t *testing.T) {
+		filePlugin.MaxRevisions = 2
+		defer func() { filePlugin.MaxRevisions = 10 }()
+
+		storage := filePlugin.GetFileStorage(record)
+		firstPath, _ := storage.GetUploadPathFromFile(getRevisionStyle(1), "", record)
+
+		replace("contract-v3.txt", "third version")
+
+		revisions := listRevisions()
+		assert.Equal([]int{3, 2}, []int{revisions[0].Number, revisions[1].Number})
+		_, err := call(ctl.DownloadRevision, http.MethodGet, "", "", record.GetIDString(), "1")
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+
+		_, err = os.Stat("/tmp/_test_files/" + firstPath)
+		assert.True(os.IsNotExist(err))
+	})
+
+	t.Run("Should return not found for unknown revisions and require one file", func(t *testing.T) {
+		_, err := call(ctl.RestoreRevision, http.MethodPost, "", "", record.GetIDString(), "99")
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+
+		_, err = call(ctl.Replace, http.MethodPost, "", "", record.GetIDString())
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should only replace images with the same stored format", func(t *testing.T) {
+		image := GetImageModelStub()
+		image.Name = "animation.gif"
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/image", nil)
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+
+		_, err := ReplaceImageContents(ctx, &image, "photo.jpg", tmpFilePath)
+		assert.ErrorIs(err, ErrReplaceFormatMismatch)
+	})
+
+	t.Run("Should delete the revisions with the record", func(t *testing.T) {
+		storage := filePlugin.GetFileStorage(record)
+		revisionPath, _ := storage.GetUploadPathFromFile(getRevisionStyle(3), "", record)
+
+		err := DestroyFileRecord(app, record)
+		assert.Nil(err)
+
+		revisions, err := GetRecordRevisions(app.GetDB(), AccessRecordTypeFile, record.ID)
+		assert.Nil(err)
+		assert.Empty(revisions)
+
+		_, err = os.Stat("/tmp/_test_files/" + revisionPath)
+		assert.True(os.IsNotExist(err))
+	})
+}
+
+type failProcessorStub struct{}
+
+func (p *failProcessorStub) Resize(sourcePath, destPath, fileName string, opts files_processor.Options) error {
+	return errors.New("resize failed")
+}
+
+func TestImageRevisions(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	processor := filePlugin.Processor
+	filePlugin.Processor = &copyProcessorStub{}
+	defer func() { filePlugin.Processor = processor }()
+
+	src := filepath.Join(os.TempDir(), "revision-image.png")
+	writeTestPNG(t, src, 20, 20)
+	defer os.Remove(src)
+
+	tmpFilePath := filepath.Join(os.TempDir(), "revision-image-upload.png")
+	copyTestFile := func() {
+		data, _ := os.ReadFile(src)
+		err := os.WriteFile(tmpFilePath, data, 0644)
+		assert.Nil(err)
+	}
+	defer os.Remove(tmpFilePath)
+
+	copyTestFile()
+	record := NewImageModel()
+	err := UploadImageFromLocalhost("photo.png", "", tmpFilePath, "image", record, app)
+	assert.Nil(err)
+	err = GenerateImageStyle(app, record, "thumbnail")
+	assert.Nil(err)
+	err = record.Save()
+	assert.Nil(err)
+
+	storage := filePlugin.GetImageStorage(record)
+	thumbnailPath, _ := storage.GetUploadPathFromFile("thumbnail", filePlugin.ImageFormat, record)
+	thumbnailURL := record.URLs["thumbnail"]
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/image", nil)
+	ctx, _ := GetRequestContextStub(app, req, "administrator")
+
+	t.Run("Should keep the image styles if the replacement fails", func(t *testing.T) {
+		filePlugin.Processor = &failProcessorStub{}
+		defer func() { filePlugin.Processor = &copyProcessorStub{} }()
+
+		copyTestFile()
+		current := ImageModel{}
+		err := ImageFindOne(record.GetIDString(), &current)
+		assert.Nil(err)
+
+		_, err = ReplaceImageContents(ctx, &current, "photo-v2.png", tmpFilePath)
+		assert.NotNil(err)
+
+		saved := ImageModel{}
+		err = ImageFindOne(record.GetIDString(), &saved)
+		assert.Nil(err)
+		assert.Equal(thumbnailURL, saved.URLs["thumbnail"])
+
+		_, err = os.Stat("/tmp/_test_files/" + thumbnailPath)
+		assert.Nil(err)
+	})
+
+	t.Run("Should delete the previous image styles after the replacement", func(t *testing.T) {
+		copyTestFile()
+		current := ImageModel{}
+		err := ImageFindOne(record.GetIDString(), &current)
+		assert.Nil(err)
+
+		revision, err := ReplaceImageContents(ctx, &current, "photo-v2.png", tmpFilePath)
+		assert.Nil(err)
+		assert.Equal(1, revision.Number)
+
+		saved := ImageModel{}
+		err = ImageFindOne(record.GetIDString(), &saved)
+		assert.Nil(err)
+		assert.True(IsPendingStyleURL(&saved, "thumbnail"))
+
+		_, err = os.Stat("/tmp/_test_files/" + thumbnailPath)
+		assert.True(os.IsNotExist(err))
+	})
+}
+
+func TestConcurrentReplace(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	tmpFilePath := filepath.Join(os.TempDir(), "concurrent-replace.txt")
+	err := os.WriteFile(tmpFilePath, []byte("version 0"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	record := NewFileModel()
+	err = UploadFileFromLocalhost("notes.txt", "", tmpFilePath, "file", record, app)
+	assert.Nil(err)
+	err = record.Save()
+	assert.Nil(err)
+
+	wg := sync.WaitGroup{}
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			p := filepath.Join(os.TempDir(), "concurrent-replace-"+strconv.Itoa(i)+".txt")
+			err := os.WriteFile(p, []byte("version "+strconv.Itoa(i)), 0644)
+			assert.Nil(err)
+			defer os.Remove(p)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/file", nil)
+			ctx, _ := GetRequestContextStub(app, req, "administrator")
+
+			// each request loads its own copy of the record
+			current := FileModel{}
+			err = FileFindOne(record.GetIDString(), &current)
+			assert.Nil(err)
+
+			_, err = ReplaceFileContents(ctx, &current, "notes.txt", p)
+			assert.Nil(err)
+		}(i)
+	}
+	wg.Wait()
+
+	revisions, err := GetRecordRevisions(app.GetDB(), AccessRecordTypeFile, record.ID)
+	assert.Nil(err)
+	assert.Equal([]int{4, 3, 2, 1}, []int{revisions[0].Number, revisions[1].Number, revisions[2].Number, revisions[3].Number})
+
+	saved := FileModel{}
+	err = FileFindOne(record.GetIDString(), &saved)
+	assert.Nil(err)
+
+	storage := filePlugin.GetFileStorage(&saved)
+	originalPath, _ := storage.GetUploadPathFromFile("original", "", &saved)
+	checksum, err := files_helpers.FileChecksum("/tmp/_test_files/" + originalPath)
+	assert.Nil(err)
+	assert.Equal(saved.Checksum, checksum)
+
+	// every revision keeps one object with the contents it describes
+	for _, revision := range revisions {
+		revisionPath, _ := storage.GetUploadPathFromFile(revision.GetStyle(), "", &saved)
+		checksum, err := files_helpers.FileChecksum("/tmp/_test_files/" + revisionPath)
+		assert.Nil(err)
+		assert.Equal(revision.Checksum, checksum)
+	}
+}
@@ -0,0 +1,194 @@
+package files
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+// LikeSearchBackend - Default search backend, matches the terms with LIKE in the record columns and tag
+// names. It doesn't have one index and results are not ranked
+type LikeSearchBackend struct{}
+
+func (b *LikeSearchBackend) Index(db *gorm.DB, doc *SearchDocument) error {
+	return nil
+}
+
+func (b *LikeSearchBackend) Remove(db *gorm.DB, recordType string, recordID uint64) error {
+	return nil
+}
+
+func (b *LikeSearchBackend) Search(query *gorm.DB, opts *SearchOptions) *gorm.DB {
+	table, column := getTagTable(opts.RecordType)
+	like := "%" + opts.Terms + "%"
+
+	tagged := bolo.GetDefaultDatabaseConnection().
+		Table(table).
+		Select(table+"."+column).
+		Joins("INNER JOIN mediatags ON mediatags.id = "+table+".tagId").
+		Where("mediatags.name LIKE ?", like)
+
+	return query.Where(
+		"(name LIKE ? OR label LIKE ? OR description LIKE ? OR originalname LIKE ? OR id IN (?))",
+		like, like, like, like, tagged,
+	)
+}
+
+// SQLiteSearchBackend - Search backend with one SQLite FTS5 table, ranked by bm25. The mattn/go-sqlite3
+// driver needs the sqlite_fts5 build tag. SQLite databases don't run the MySQL migrations, so call Setup on
+// app start to create the index table
+type SQLiteSearchBackend struct{}
+
+// Setup - Create the FTS5 index table if not exists
+func (b *SQLiteSearchBackend) Setup(db *gorm.DB) error {
+	return db.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS mediasearch USING fts5(
+		recordType UNINDEXED,
+		recordId UNINDEXED,
+		label,
+		description,
+		originalname,
+		tags,
+		extractedText
+	)`).Error
+}
+
+// sqliteSearchRowID - FTS5 tables can only be updated fast by rowid, so the rowid is built from the record
+func sqliteSearchRowID(recordType string, recordID uint64) uint64 {
+	if recordType == AccessRecordTypeImage {
+		return recordID*2 + 1
+	}
+
+	return recordID * 2
+}
+
+func (b *SQLiteSearchBackend) Index(db *gorm.DB, doc *SearchDocument) error {
+	rowID := sqliteSearchRowID(doc.RecordType, doc.RecordID)
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		extractedText, err := getIndexedText(tx, doc, "rowid = ?", rowID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec("DELETE FROM mediasearch WHERE rowid = ?", rowID).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(
+			"INSERT INTO mediasearch (rowid, recordType, recordId, label, description, originalname, tags, extractedText) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			rowID, doc.RecordType, doc.RecordID, doc.Label, doc.Description, doc.Originalname, doc.Tags, extractedText,
+		).Error
+	})
+}
+
+func (b *SQLiteSearchBackend) Remove(db *gorm.DB, recordType string, recordID uint64) error {
+	return db.Exec("DELETE FROM mediasearch WHERE rowid = ?", sqliteSearchRowID(recordType, recordID)).Error
+}
+
+func (b *SQLiteSearchBackend) Search(query *gorm.DB, opts *SearchOptions) *gorm.DB {
+	match := getFTS5Query(opts.Terms)
+	if match == "" {
+		return query.Where("1 = 0")
+	}
+
+	if !opts.Rank {
+		return query.Where(
+			"id IN (SELECT recordId FROM mediasearch WHERE mediasearch MATCH ? AND recordType = ?)",
+			match, opts.RecordType,
+		)
+	}
+
+	// bm25 is lower for better matches
+	return query.
+		Joins("INNER JOIN (SELECT recordId, bm25(mediasearch) AS searchRank FROM mediasearch WHERE mediasearch MATCH ? AND recordType = ?) AS search ON search.recordId = "+opts.Table+".id", match, opts.RecordType).
+		Order("search.searchRank ASC")
+}
+
+// getFTS5Query - Quote the search terms as FTS5 prefix queries, all terms should match
+func getFTS5Query(terms string) string {
+	words := []string{}
+	for _, word := range getSearchWords(terms) {
+		words = append(words, `"`+word+`"*`)
+	}
+
+	return strings.Join(words, " ")
+}
+
+// MySQLSearchBackend - Search backend with one MySQL FULLTEXT index, created in the search migration.
+// Terms shorter than the innodb_ft_min_token_size are ignored by MySQL
+type MySQLSearchBackend struct{}
+
+const mysqlSearchMatch = "MATCH (label, description, originalname, tags, extractedText) AGAINST (? IN BOOLEAN MODE)"
+
+func (b *MySQLSearchBackend) Index(db *gorm.DB, doc *SearchDocument) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		extractedText, err := getIndexedText(tx, doc, "recordType = ? AND recordId = ?", doc.RecordType, doc.RecordID)
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(
+			"REPLACE INTO mediasearch (recordType, recordId, label, description, originalname, tags, extractedText) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			doc.RecordType, doc.RecordID, doc.Label, doc.Description, doc.Originalname, doc.Tags, extractedText,
+		).Error
+	})
+}
+
+func (b *MySQLSearchBackend) Remove(db *gorm.DB, recordType string, recordID uint64) error {
+	return db.Exec("DELETE FROM mediasearch WHERE recordType = ? AND recordId = ?", recordType, recordID).Error
+}
+
+func (b *MySQLSearchBackend) Search(query *gorm.DB, opts *SearchOptions) *gorm.DB {
+	match := getMySQLBooleanQuery(opts.Terms)
+	if match == "" {
+		return query.Where("1 = 0")
+	}
+
+	if !opts.Rank {
+		return query.Where(
+			"id IN (SELECT recordId FROM mediasearch WHERE recordType = ? AND "+mysqlSearchMatch+")",
+			opts.RecordType, match,
+		)
+	}
+
+	return query.
+		Joins("INNER JOIN (SELECT recordId, "+mysqlSearchMatch+" AS searchRank FROM mediasearch WHERE recordType = ? AND "+mysqlSearchMatch+") AS search ON search.recordId = "+opts.Table+".id", match, opts.RecordType, match).
+		Order("search.searchRank DESC")
+}
+
+// getMySQLBooleanQuery - Build one boolean mode query where all terms should match as prefix
+func getMySQLBooleanQuery(terms string) string {
+	words := []string{}
+	for _, word := range getSearchWords(terms) {
+		words = append(words, "+"+word+"*")
+	}
+
+	return strings.Join(words, " ")
+}
+
+// getSearchWords - Split the search terms in words, without the query syntax characters of the backends
+func getSearchWords(terms string) []string {
+	return strings.FieldsFunc(terms, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// getIndexedText - Get the extracted text of the document, documents without one keep the indexed text
+func getIndexedText(tx *gorm.DB, doc *SearchDocument, where string, args ...interface{}) (string, error) {
+	if doc.ExtractedText != nil {
+		return *doc.ExtractedText, nil
+	}
+
+	texts := []string{}
+	err := tx.Table("mediasearch").
+		Where(where, args...).
+		Pluck("extractedText", &texts).Error
+	if err != nil || len(texts) == 0 {
+		return "", err
+	}
+
+	return texts[0], nil
+}
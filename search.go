@@ -0,0 +1,333 @@
+package files
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-bolo/bolo"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SearchDocument - Indexed text of one file or image
+type SearchDocument struct {
+	RecordType   string
+	RecordID     uint64
+	Label        string
+	Description  string
+	Originalname string
+	// Tag names separated by spaces
+	Tags string
+	// Text extracted from the file contents, nil keeps the indexed text
+	ExtractedText *string
+}
+
+// SearchOptions - Search of the ?q= param in files or images queries
+type SearchOptions struct {
+	RecordType string
+	// Table of the query, used in joins
+	Table string
+	Terms string
+	// Order the results by relevance, used in lists without one ?order=
+	Rank bool
+}
+
+// SearchBackend - Full text search of files and images, set with FilePluginCfgs.SearchBackend. Search is used
+// in both list and count queries, so it should only filter records and order them if Rank is true
+type SearchBackend interface {
+	// Index - Add or replace one record in the search index
+	Index(db *gorm.DB, doc *SearchDocument) error
+	// Remove - Remove one record from the search index
+	Remove(db *gorm.DB, recordType string, recordID uint64) error
+	// Search - Filter the query to records that match the search terms
+	Search(query *gorm.DB, opts *SearchOptions) *gorm.DB
+}
+
+// TextExtractor - Extract the text of uploaded files, used in the search index
+type TextExtractor interface {
+	ExtractText(filePath, mimeType string) (string, error)
+}
+
+// PlainTextExtractor - Default text extractor, reads the first MaxSize bytes of text files
+type PlainTextExtractor struct {
+	MaxSize int64
+}
+
+func (e *PlainTextExtractor) ExtractText(filePath, mimeType string) (string, error) {
+	if !isPlainTextMime(mimeType) {
+		return "", nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, e.MaxSize))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.ToValidUTF8(string(data), ""), nil
+}
+
+func isPlainTextMime(mimeType string) bool {
+	mimeType = strings.TrimSpace(strings.Split(mimeType, ";")[0])
+
+	switch mimeType {
+	case "application/json", "application/xml", "application/csv", "application/x-yaml":
+		return true
+	}
+
+	return strings.HasPrefix(mimeType, "text/")
+}
+
+// getSearchBackend - Get the search backend of the files plugin
+func getSearchBackend() SearchBackend {
+	app := bolo.GetApp()
+	if app == nil {
+		return &LikeSearchBackend{}
+	}
+
+	filePlugin, ok := app.GetPlugin("files").(*FilePlugin)
+	if !ok || filePlugin.SearchBackend == nil {
+		return &LikeSearchBackend{}
+	}
+
+	return filePlugin.SearchBackend
+}
+
+// hasSearchIndex - LikeSearchBackend queries the records, so it doesn't need the documents
+func hasSearchIndex(backend SearchBackend) bool {
+	_, ok := backend.(*LikeSearchBackend)
+	return !ok
+}
+
+// applySearch - Filter the files or images query with ?q=
+func applySearch(ctx *bolo.RequestContext, recordType, table string, query *gorm.DB, rank bool) *gorm.DB {
+	q := strings.TrimSpace(ctx.QueryParam("q"))
+	if q == "" {
+		return query
+	}
+
+	return getSearchBackend().Search(query, &SearchOptions{
+		RecordType: recordType,
+		Table:      table,
+		Terms:      q,
+		Rank:       rank,
+	})
+}
+
+// extractSearchText - Extract the text of one uploaded file, extraction errors are logged and the file is
+// indexed without text
+func extractSearchText(filePlugin *FilePlugin, filePath, mimeType string) *string {
+	text := ""
+	if filePlugin.TextExtractor == nil || !hasSearchIndex(filePlugin.SearchBackend) {
+		return &text
+	}
+
+	text, err := filePlugin.TextExtractor.ExtractText(filePath, mimeType)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":    err,
+			"filePath": filePath,
+		}).Warn("extractSearchText error on extract text")
+	}
+
+	if !utf8.ValidString(text) {
+		text = ""
+	}
+
+	return &text
+}
+
+// getSearchDocument - Build the search document of one file or image, with the record tags
+func getSearchDocument(db *gorm.DB, recordType string, recordID uint64, label, description *string, originalname string, extractedText *string) (*SearchDocument, error) {
+	tags, err := getRecordsTags(db, recordType, []uint64{recordID})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, tag := range tags[recordID] {
+		names = append(names, tag.Name)
+	}
+
+	doc := SearchDocument{
+		RecordType:    recordType,
+		RecordID:      recordID,
+		Originalname:  originalname,
+		Tags:          strings.Join(names, " "),
+		ExtractedText: extractedText,
+	}
+
+	if label != nil {
+		doc.Label = *label
+	}
+
+	if description != nil {
+		doc.Description = *description
+	}
+
+	return &doc, nil
+}
+
+// IndexFileSearch - Add or update one file in the search index
+func IndexFileSearch(db *gorm.DB, record *FileModel) error {
+	backend := getSearchBackend()
+	if !hasSearchIndex(backend) {
+		return nil
+	}
+
+	doc, err := getSearchDocument(db, AccessRecordTypeFile, record.ID, record.Label, record.Description, record.Originalname, record.extractedText)
+	if err != nil {
+		return err
+	}
+
+	return backend.Index(db, doc)
+}
+
+// IndexImageSearch - Add or update one image in the search index
+func IndexImageSearch(db *gorm.DB, record *ImageModel) error {
+	backend := getSearchBackend()
+	if !hasSearchIndex(backend) {
+		return nil
+	}
+
+	doc, err := getSearchDocument(db, AccessRecordTypeImage, record.ID, record.Label, record.Description, record.Originalname, nil)
+	if err != nil {
+		return err
+	}
+
+	return backend.Index(db, doc)
+}
+
+// reindexSearchRecords - Update the index of files or images after changes in their tags
+func reindexSearchRecords(db *gorm.DB, recordType string, recordIDs []uint64) error {
+	if len(recordIDs) == 0 || !hasSearchIndex(getSearchBackend()) {
+		return nil
+	}
+
+	if recordType == AccessRecordTypeImage {
+		records := []*ImageModel{}
+		err := db.Where("id IN ?", recordIDs).Find(&records).Error
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			err = IndexImageSearch(db, record)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	records := []*FileModel{}
+	err := db.Where("id IN ?", recordIDs).Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err = IndexFileSearch(db, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReindexSearchOptions - Options of one full search index rebuild
+type ReindexSearchOptions struct {
+	// Download the original of every file to extract the text again, slow in big libraries
+	ExtractText bool
+	BatchSize   int
+}
+
+// ReindexSearch - Index all files and images, used after changing the search backend. Returns the number of
+// indexed records
+func ReindexSearch(ctx context.Context, app bolo.App, opts *ReindexSearchOptions) (int64, error) {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	db := app.GetDB()
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	var total int64
+
+	files := []*FileModel{}
+	r := db.FindInBatches(&files, opts.BatchSize, func(tx *gorm.DB, batch int) error {
+		for _, record := range files {
+			if opts.ExtractText {
+				record.extractedText = extractStoredFileText(ctx, filePlugin, record)
+			}
+
+			err := IndexFileSearch(db, record)
+			if err != nil {
+				return err
+			}
+			total++
+		}
+
+		return ctx.Err()
+	})
+	if r.Error != nil {
+		return total, r.Error
+	}
+
+	images := []*ImageModel{}
+	r = db.FindInBatches(&images, opts.BatchSize, func(tx *gorm.DB, batch int) error {
+		for _, record := range images {
+			err := IndexImageSearch(db, record)
+			if err != nil {
+				return err
+			}
+			total++
+		}
+
+		return ctx.Err()
+	})
+
+	return total, r.Error
+}
+
+// extractStoredFileText - Download the original of one file to extract the text, nil keeps the indexed text
+// if the object can't be downloaded
+func extractStoredFileText(ctx context.Context, filePlugin *FilePlugin, record *FileModel) *string {
+	storage := filePlugin.GetFileStorage(record)
+	if storage == nil {
+		return nil
+	}
+
+	objectPath, err := storage.GetUploadPathFromFile("original", "", record)
+	if err != nil {
+		return nil
+	}
+
+	tmpFilePath, err := downloadOriginalObject(ctx, storage, objectPath)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error":  err,
+			"fileId": record.ID,
+		}).Warn("extractStoredFileText error on download original")
+
+		return nil
+	}
+	defer os.Remove(tmpFilePath)
+
+	mimeType := ""
+	if record.Mime != nil {
+		mimeType = *record.Mime
+	}
+
+	return extractSearchText(filePlugin, tmpFilePath, mimeType)
+}
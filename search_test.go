@@ -0,0 +1,157 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	queryFiles := func(query string) []uint64 {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file?limit=1000&"+query, nil)
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err := filePlugin.FileController.Query(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		ids := []uint64{}
+		for _, r := range *resp.Records {
+			ids = append(ids, r.ID)
+		}
+		// counts use the same filters as the list
+		assert.Equal(int64(len(ids)), resp.Meta.Count)
+		return ids
+	}
+
+	saveFile := func(label, description, originalname, mime string) *FileModel {
+		f := GetFileModelStub()
+		f.Label = &label
+		f.Description = &description
+		f.Originalname = originalname
+		f.Mime = &mime
+
+		err := f.Save()
+		assert.Nil(err)
+		return &f
+	}
+
+	t.Run("Should search with the default backend", func(t *testing.T) {
+		byLabel := saveFile("Zanzibar beach", "", "a.jpg", "image/jpeg")
+		byDescription := saveFile("other", "zanzibar sunset", "b.pdf", "application/pdf")
+		byName := saveFile("other", "", "zanzibar-map.pdf", "application/pdf")
+		byTag := saveFile("other", "", "c.jpg", "image/jpeg")
+		saveFile("other", "", "d.jpg", "image/jpeg")
+
+		tag := NewTagModel()
+		tag.Name = "Zanzibar Trip"
+		err := tag.Save()
+		assert.Nil(err)
+
+		_, err = AddTags(app.GetDB(), AccessRecordTypeFile, []uint64{byTag.ID}, []uint64{tag.ID})
+		assert.Nil(err)
+
+		assert.ElementsMatch([]uint64{byLabel.ID, byDescription.ID, byName.ID, byTag.ID}, queryFiles("q=zanzibar"))
+		assert.ElementsMatch([]uint64{byDescription.ID, byName.ID}, queryFiles("q=zanzibar&mime=application/pdf"))
+	})
+
+	t.Run("Should search and rank with the SQLite FTS5 backend", func(t *testing.T) {
+		backend := &SQLiteSearchBackend{}
+		err := backend.Setup(app.GetDB())
+		if err != nil {
+			t.Skip("SQLite without FTS5, run the tests with -tags sqlite_fts5:", err)
+		}
+
+		filePlugin.SearchBackend = backend
+		defer func() { filePlugin.SearchBackend = &LikeSearchBackend{} }()
+
+		once := saveFile("Quokka", "one photo", "e.jpg", "image/jpeg")
+		twice := saveFile("Quokka island", "quokka quokka selfie", "f.jpg", "image/jpeg")
+		saveFile("Kangaroo", "", "g.jpg", "image/jpeg")
+
+		ids := queryFiles("q=quokka")
+		assert.Equal([]uint64{twice.ID, once.ID}, ids)
+
+		assert.Equal([]uint64{once.ID}, queryFiles("q=quokka+photo"))
+		// prefix search
+		assert.Equal([]uint64{once.ID}, queryFiles("q=quok+pho"))
+		// query syntax characters are ignored
+		assert.Equal([]uint64{once.ID}, queryFiles("q="+url.QueryEscape(`quokka"+photo*`)))
+		assert.Equal([]uint64{twice.ID, once.ID}, queryFiles("q=quokka&order=id&sortDirection=DESC"))
+
+		tag := NewTagModel()
+		tag.Name = "Wombat"
+		err = tag.Save()
+		assert.Nil(err)
+
+		_, err = AddTags(app.GetDB(), AccessRecordTypeFile, []uint64{once.ID}, []uint64{tag.ID})
+		assert.Nil(err)
+		assert.Equal([]uint64{once.ID}, queryFiles("q=wombat"))
+
+		tag.Name = "Numbat"
+		err = tag.Save()
+		assert.Nil(err)
+		assert.Empty(queryFiles("q=wombat"))
+		assert.Equal([]uint64{once.ID}, queryFiles("q=numbat"))
+
+		_, err = RemoveTags(app.GetDB(), AccessRecordTypeFile, []uint64{once.ID}, []uint64{tag.ID})
+		assert.Nil(err)
+		assert.Empty(queryFiles("q=numbat"))
+
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "notes.txt")
+		part.Write([]byte("meeting notes about the platypus project"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+
+		err = filePlugin.FileController.UploadFile(ctx)
+		assert.Nil(err)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal([]uint64{resp.Record.ID}, queryFiles("q=platypus"))
+
+		// updates keep the extracted text
+		label := "Notes"
+		resp.Record.Label = &label
+		err = resp.Record.Save()
+		assert.Nil(err)
+		assert.Equal([]uint64{resp.Record.ID}, queryFiles("q=platypus+notes"))
+
+		err = DestroyFileRecord(app, resp.Record)
+		assert.Nil(err)
+		assert.Empty(queryFiles("q=platypus"))
+
+		total, err := ReindexSearch(ctx.Request().Context(), app, &ReindexSearchOptions{})
+		assert.Nil(err)
+		assert.True(total > 0)
+		assert.Equal([]uint64{twice.ID, once.ID}, queryFiles("q=quokka"))
+	})
+}
+
+func TestGetSearchQueries(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`"summer"* "trip"*`, getFTS5Query(` summer "trip" `))
+	assert.Equal(`+summer* +trip*`, getMySQLBooleanQuery("summer -trip"))
+	assert.Equal("", getFTS5Query(`"*"`))
+	assert.Equal([]string{"ação", "2023"}, getSearchWords("ação, (2023)"))
+}
@@ -0,0 +1,104 @@
+package files
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendFileThroughHTTP(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	storage := app.GetPlugin("files").(*FilePlugin).GetStorage("file")
+
+	tmpFilePath := filepath.Join(os.TempDir(), "serve-test.txt")
+	err := os.WriteFile(tmpFilePath, []byte("0123456789abcdef"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	record := GetFileModelStub()
+	record.Name = "serve-test.txt"
+	record.CreatedAt = time.Now()
+	dest, _ := storage.GetUploadPathFromFile("original", "", &record)
+	err = storage.UploadFile(&record, tmpFilePath, dest)
+	assert.Nil(err)
+
+	send := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file/"+record.Name, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+
+		err := storage.SendFileThroughHTTP(echo.New().NewContext(req, rec), &record, "original", "")
+		assert.Nil(err)
+
+		return rec
+	}
+
+	first := send(nil)
+	etag := first.Header().Get("ETag")
+	lastModified := first.Header().Get("Last-Modified")
+
+	t.Run("Should send the file with cache headers", func(t *testing.T) {
+		assert.Equal(http.StatusOK, first.Code)
+		assert.Equal("0123456789abcdef", first.Body.String())
+		assert.NotEmpty(etag)
+		assert.NotEmpty(lastModified)
+		assert.NotEmpty(first.Header().Get("Cache-Control"))
+		assert.Equal("bytes", first.Header().Get("Accept-Ranges"))
+		assert.True(strings.HasPrefix(first.Header().Get("Content-Type"), "text/plain"))
+	})
+
+	t.Run("Should return not modified with If-None-Match", func(t *testing.T) {
+		rec := send(map[string]string{"If-None-Match": etag})
+		assert.Equal(http.StatusNotModified, rec.Code)
+		assert.Empty(rec.Body.String())
+	})
+
+	t.Run("Should return not modified with If-Modified-Since", func(t *testing.T) {
+		rec := send(map[string]string{"If-Modified-Since": lastModified})
+		assert.Equal(http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("Should return one partial content", func(t *testing.T) {
+		rec := send(map[string]string{"Range": "bytes=2-5"})
+		assert.Equal(http.StatusPartialContent, rec.Code)
+		assert.Equal("2345", rec.Body.String())
+		assert.Equal("bytes 2-5/16", rec.Header().Get("Content-Range"))
+	})
+
+	t.Run("Should return multiple ranges", func(t *testing.T) {
+		rec := send(map[string]string{"Range": "bytes=0-1,14-"})
+		assert.Equal(http.StatusPartialContent, rec.Code)
+		assert.True(strings.HasPrefix(rec.Header().Get("Content-Type"), "multipart/byteranges"))
+		assert.Contains(rec.Body.String(), "01")
+		assert.Contains(rec.Body.String(), "ef")
+	})
+
+	t.Run("Should ignore range with outdated If-Range", func(t *testing.T) {
+		rec := send(map[string]string{"Range": "bytes=2-5", "If-Range": `"outdated"`})
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("0123456789abcdef", rec.Body.String())
+	})
+
+	t.Run("Should return not found for missing files", func(t *testing.T) {
+		missing := GetFileModelStub()
+		missing.Name = "serve-missing.txt"
+		missing.CreatedAt = time.Now()
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/file/"+missing.Name, nil)
+		rec := httptest.NewRecorder()
+
+		err := storage.SendFileThroughHTTP(echo.New().NewContext(req, rec), &missing, "original", "")
+		assert.Nil(err)
+		assert.Equal(http.StatusNotFound, rec.Code)
+	})
+}
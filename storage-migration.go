@@ -0,0 +1,599 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/go-bolo/bolo"
+	files_database "github.com/go-bolo/files/database"
+	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type StorageMigrationOptions struct {
+	// Source storage name, only records with this StorageName are migrated
+	From string `json:"from"`
+	// Target storage name
+	To string `json:"to"`
+	// "files", "images" or empty to migrate both
+	RecordType string `json:"recordType"`
+	// Records migrated at same time, default 4
+	Concurrency int `json:"concurrency"`
+	// Default 100
+	BatchSize int `json:"batchSize"`
+	// Delete the source objects after the record is migrated
+	DeleteSource bool `json:"deleteSource"`
+	// Optional JSON file used to save and resume the progress, only set from the migrate-storage command
+	// because the options of the maintenance API are read from the request body
+	CheckpointFile string `json:"-"`
+	// Optional report to fill, allows to read the progress while the migration runs
+	Report *StorageMigrationReport `json:"-"`
+}
+
+type StorageMigrationCheckpoint struct {
+	// Last processed id by record type
+	LastIDs map[string]uint64 `json:"lastIds"`
+}
+
+type StorageMigrationFailure struct {
+	RecordType string `json:"recordType"`
+	RecordID   uint64 `json:"recordId"`
+	Error      string `json:"error"`
+}
+
+type StorageMigrationReport struct {
+	From               string                    `json:"from"`
+	To                 string                    `json:"to"`
+	Migrated           int                       `json:"migrated"`
+	Failures           []StorageMigrationFailure `json:"failures"`
+	SourceDeleteErrors []string                  `json:"sourceDeleteErrors"`
+	Running            bool                      `json:"running"`
+
+	mu sync.Mutex
+}
+
+// MarshalJSON - Marshal the report, safe to call while the migration is running
+func (r *StorageMigrationReport) MarshalJSON() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return json.Marshal(&struct {
+		From               string                    `json:"from"`
+		To                 string                    `json:"to"`
+		Migrated           int                       `json:"migrated"`
+		Failures           []StorageMigrationFailure `json:"failures"`
+		SourceDeleteErrors []string                  `json:"sourceDeleteErrors"`
+		Running            bool                      `json:"running"`
+	}{r.From, r.To, r.Migrated, r.Failures, r.SourceDeleteErrors, r.Running})
+}
+
+func (r *StorageMigrationReport) isRunning() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.Running
+}
+
+func (r *StorageMigrationReport) setRunning(running bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Running = running
+}
+
+func (r *StorageMigrationReport) addFailure(recordType string, id uint64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Failures = append(r.Failures, StorageMigrationFailure{RecordType: recordType, RecordID: id, Error: err.Error()})
+}
+
+func (r *StorageMigrationReport) addMigrated(sourceDeleteErrors []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Migrated++
+	r.SourceDeleteErrors = append(r.SourceDeleteErrors, sourceDeleteErrors...)
+}
+
+// MigrateStorage - Copy the original, style and revision objects of every record saved in opts.From storage to
+// opts.To storage and update the record StorageName and URLs. Each copy is verified before the record
+// update and records that fail stay in the source storage, so the migration can be run again
+func MigrateStorage(ctx context.Context, app bolo.App, opts *StorageMigrationOptions) (*StorageMigrationReport, error) {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	report := opts.Report
+	if report == nil {
+		report = &StorageMigrationReport{}
+	}
+
+	report.mu.Lock()
+	report.From = opts.From
+	report.To = opts.To
+	report.Failures = []StorageMigrationFailure{}
+	report.SourceDeleteErrors = []string{}
+	report.mu.Unlock()
+
+	report.setRunning(true)
+	defer report.setRunning(false)
+
+	if opts.From == "" || opts.To == "" || opts.From == opts.To {
+		return report, errors.New("MigrateStorage: from and to should be different storage names")
+	}
+
+	src, ok := filePlugin.GetStorage(opts.From).(ObjectStorager)
+	if !ok {
+		return report, fmt.Errorf("MigrateStorage: storage %s not found or can't manage objects", opts.From)
+	}
+
+	dst, ok := filePlugin.GetStorage(opts.To).(ObjectStorager)
+	if !ok {
+		return report, fmt.Errorf("MigrateStorage: storage %s not found or can't manage objects", opts.To)
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	checkpoint, err := loadStorageMigrationCheckpoint(opts.CheckpointFile)
+	if err != nil {
+		return report, fmt.Errorf("MigrateStorage error on load checkpoint: %w", err)
+	}
+
+	m := storageMigration{
+		app:        app,
+		opts:       opts,
+		src:        src,
+		dst:        dst,
+		report:     report,
+		checkpoint: checkpoint,
+	}
+
+	if opts.RecordType == "" || opts.RecordType == "files" {
+		err = m.migrateFiles(ctx)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	if opts.RecordType == "" || opts.RecordType == "images" {
+		err = m.migrateImages(ctx)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+type storageMigration struct {
+	app        bolo.App
+	opts       *StorageMigrationOptions
+	src        ObjectStorager
+	dst        ObjectStorager
+	report     *StorageMigrationReport
+	checkpoint *StorageMigrationCheckpoint
+}
+
+func (m *storageMigration) migrateFiles(ctx context.Context) error {
+	db := m.app.GetDB()
+
+	// the checkpoint stops in the first failed record, so it's retried on resume
+	lastID := m.checkpoint.LastIDs["files"]
+	checkpointID := newMigrationCheckpointID(lastID)
+
+	for {
+		var records []FileModel
+		// trashed records are migrated too, so they can be restored
+		err := db.Unscoped().
+			Where("storageName = ? AND id > ?", m.opts.From, lastID).
+			Order("id ASC").
+			Limit(m.opts.BatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("MigrateStorage error on find files: %w", err)
+		}
+
+		if len(records) == 0 {
+			return nil
+		}
+
+		migrated := make([]bool, len(records))
+		m.runBatch(ctx, len(records), func(i int) {
+			record := &records[i]
+
+			urls, srcPaths, err := m.copyObjects(ctx, record, record.URLs, "", nil)
+			var revisionIDs []uint64
+			if err == nil {
+				var revisionPaths []string
+				revisionIDs, revisionPaths, err = m.copyRevisions(ctx, AccessRecordTypeFile, record.ID, record, "")
+				srcPaths = append(srcPaths, revisionPaths...)
+			}
+			if err == nil {
+				err = m.updateRecord(&FileModel{}, AccessRecordTypeFile, record.ID, urls, revisionIDs)
+			}
+			if err != nil {
+				m.report.addFailure("files", record.ID, err)
+				return
+			}
+
+			m.report.addMigrated(m.deleteSource(ctx, srcPaths))
+			migrated[i] = true
+		})
+
+		// canceled batches may have records that never started
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		for i := range records {
+			checkpointID.add(records[i].ID, migrated[i])
+		}
+		lastID = records[len(records)-1].ID
+
+		err = m.saveCheckpoint("files", checkpointID.id)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *storageMigration) migrateImages(ctx context.Context) error {
+	db := m.app.GetDB()
+	filePlugin := m.app.GetPlugin("files").(*FilePlugin)
+
+	// the checkpoint stops in the first failed record, so it's retried on resume
+	lastID := m.checkpoint.LastIDs["images"]
+	checkpointID := newMigrationCheckpointID(lastID)
+
+	for {
+		var records []ImageModel
+		// trashed records are migrated too, so they can be restored
+		err := db.Unscoped().
+			Where("storageName = ? AND id > ?", m.opts.From, lastID).
+			Order("id ASC").
+			Limit(m.opts.BatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("MigrateStorage error on find images: %w", err)
+		}
+
+		if len(records) == 0 {
+			return nil
+		}
+
+		migrated := make([]bool, len(records))
+		m.runBatch(ctx, len(records), func(i int) {
+			record := &records[i]
+
+			isPending := func(style string) bool {
+				return IsPendingStyleURL(record, style)
+			}
+
+			urls, srcPaths, err := m.copyObjects(ctx, record, record.URLs, filePlugin.ImageFormat, isPending)
+			var revisionIDs []uint64
+			if err == nil {
+				var revisionPaths []string
+				revisionIDs, revisionPaths, err = m.copyRevisions(ctx, AccessRecordTypeImage, record.ID, record, getImageStoredFormat(filePlugin, record))
+				srcPaths = append(srcPaths, revisionPaths...)
+			}
+			if err == nil {
+				// keep the style versions used to invalidate CDN caches
+				for style, fingerprint := range record.StyleVersions {
+					if _, ok := urls[style]; ok && !isPending(style) && urls[style] != urls["original"] {
+						urls[style] = GetVersionedStyleURL(urls[style], fingerprint)
+					}
+				}
+
+				err = m.updateRecord(&ImageModel{}, AccessRecordTypeImage, record.ID, urls, revisionIDs)
+			}
+			if err != nil {
+				m.report.addFailure("images", record.ID, err)
+				return
+			}
+
+			m.report.addMigrated(m.deleteSource(ctx, srcPaths))
+			migrated[i] = true
+		})
+
+		// canceled batches may have records that never started
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		for i := range records {
+			checkpointID.add(records[i].ID, migrated[i])
+		}
+		lastID = records[len(records)-1].ID
+
+		err = m.saveCheckpoint("images", checkpointID.id)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// migrationCheckpointID - Highest record id below which every record migrated
+type migrationCheckpointID struct {
+	id     uint64
+	failed bool
+}
+
+func newMigrationCheckpointID(id uint64) *migrationCheckpointID {
+	return &migrationCheckpointID{id: id}
+}
+
+// add one processed record, in id order
+func (c *migrationCheckpointID) add(id uint64, migrated bool) {
+	if c.failed {
+		return
+	}
+
+	if !migrated {
+		c.failed = true
+		return
+	}
+
+	c.id = id
+}
+
+// run fn for every batch item with at most opts.Concurrency items at same time
+func (m *storageMigration) runBatch(ctx context.Context, size int, fn func(i int)) {
+	files_helpers.RunConcurrently(ctx, size, m.opts.Concurrency, fn)
+
+	m.report.mu.Lock()
+	logrus.WithFields(logrus.Fields{
+		"from":     m.opts.From,
+		"to":       m.opts.To,
+		"migrated": m.report.Migrated,
+		"failures": len(m.report.Failures),
+	}).Info("MigrateStorage progress")
+	m.report.mu.Unlock()
+}
+
+// copy all record objects to the target storage, returns the new urls and the source object paths
+func (m *storageMigration) copyObjects(ctx context.Context, file files_dtos.FileDTO, urls files_database.ImageURLsField, format string, isPending func(style string) bool) (files_database.ImageURLsField, []string, error) {
+	src := m.src.(Storager)
+	dst := m.dst.(Storager)
+
+	newURLs := files_database.ImageURLsField{}
+	srcPaths := []string{}
+
+	for _, style := range sortedStyles(urls) {
+		// styles not generated yet keep the API url
+		if isPending != nil && isPending(style) {
+			newURLs[style] = urls[style]
+			continue
+		}
+
+		// styles that reuse the original object, like ignored image formats
+		if style != "original" && urls[style] == urls["original"] {
+			continue
+		}
+
+		srcPath, _ := src.GetUploadPathFromFile(style, format, file)
+		dstPath, _ := dst.GetUploadPathFromFile(style, format, file)
+
+		err := m.copyObject(ctx, file, srcPath, dstPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("style %s: %w", style, err)
+		}
+
+		newURLs[style], _ = dst.GetUrlFromFile(style, file)
+		srcPaths = append(srcPaths, srcPath)
+	}
+
+	for style := range urls {
+		if style != "original" && urls[style] == urls["original"] {
+			newURLs[style] = newURLs["original"]
+		}
+	}
+
+	return newURLs, srcPaths, nil
+}
+
+// copy the revision objects of one record saved in the source storage, revisions without storage name are
+// saved in the record storage. Returns the revision ids and the source object paths
+func (m *storageMigration) copyRevisions(ctx context.Context, recordType string, recordID uint64, file files_dtos.FileDTO, format string) ([]uint64, []string, error) {
+	revisions := []*RevisionModel{}
+	err := m.app.GetDB().
+		Where("recordType = ? AND recordId = ?", recordType, recordID).
+		Where("storageName = ? OR storageName = '' OR storageName IS NULL", m.opts.From).
+		Order("number ASC").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, nil, fmt.Errorf("error on find revisions: %w", err)
+	}
+
+	src := m.src.(Storager)
+	dst := m.dst.(Storager)
+
+	ids := []uint64{}
+	srcPaths := []string{}
+
+	for _, revision := range revisions {
+		srcPath, _ := src.GetUploadPathFromFile(revision.GetStyle(), format, file)
+		dstPath, _ := dst.GetUploadPathFromFile(revision.GetStyle(), format, file)
+
+		err := m.copyObject(ctx, file, srcPath, dstPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("revision %d: %w", revision.Number, err)
+		}
+
+		ids = append(ids, revision.ID)
+		srcPaths = append(srcPaths, srcPath)
+	}
+
+	return ids, srcPaths, nil
+}
+
+// copy one object using a local tmp file and verify the size and checksum of the copy
+func (m *storageMigration) copyObject(ctx context.Context, file files_dtos.FileDTO, srcPath, dstPath string) error {
+	r, err := m.src.OpenObject(ctx, srcPath)
+	if err != nil {
+		return fmt.Errorf("error on open source object %s: %w", srcPath, err)
+	}
+	defer r.Close()
+
+	tmpFile, err := os.CreateTemp("", "files-migration-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	size, err := io.Copy(tmpFile, r)
+	tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("error on download source object %s: %w", srcPath, err)
+	}
+
+	checksum, err := files_helpers.FileChecksum(tmpFile.Name())
+	if err != nil {
+		return err
+	}
+
+	err = m.dst.(Storager).UploadFile(file, tmpFile.Name(), dstPath)
+	if err != nil {
+		return fmt.Errorf("error on upload object %s: %w", dstPath, err)
+	}
+
+	obj, err := m.dst.StatObject(ctx, dstPath)
+	if err != nil {
+		return fmt.Errorf("error on verify object %s: %w", dstPath, err)
+	}
+
+	if obj.Size != size {
+		return fmt.Errorf("copied object %s size mismatch, expected %d got %d", dstPath, size, obj.Size)
+	}
+
+	copied, err := m.dst.OpenObject(ctx, dstPath)
+	if err != nil {
+		return fmt.Errorf("error on verify object %s: %w", dstPath, err)
+	}
+	defer copied.Close()
+
+	copiedChecksum, err := files_helpers.ReaderChecksum(copied)
+	if err != nil {
+		return fmt.Errorf("error on verify object %s: %w", dstPath, err)
+	}
+
+	if copiedChecksum != checksum {
+		return fmt.Errorf("copied object %s checksum mismatch", dstPath)
+	}
+
+	return nil
+}
+
+// update storageName and urls of the record and the storageName of the copied revisions in one transaction,
+// only if the record is still in the source storage
+func (m *storageMigration) updateRecord(model interface{}, recordType string, id uint64, urls files_database.ImageURLsField, revisionIDs []uint64) error {
+	return m.app.GetDB().Transaction(func(tx *gorm.DB) error {
+		r := tx.
+			Unscoped().
+			Model(model).
+			Where("id = ? AND storageName = ?", id, m.opts.From).
+			Updates(map[string]interface{}{
+				"storageName": m.opts.To,
+				"urls":        urls,
+			})
+		if r.Error != nil {
+			return fmt.Errorf("error on update record: %w", r.Error)
+		}
+
+		if r.RowsAffected == 0 {
+			return errors.New("record changed during migration")
+		}
+
+		if len(revisionIDs) == 0 {
+			return nil
+		}
+
+		err := tx.
+			Model(&RevisionModel{}).
+			Where("recordType = ? AND recordId = ? AND id IN ?", recordType, id, revisionIDs).
+			Update("storageName", m.opts.To).Error
+		if err != nil {
+			return fmt.Errorf("error on update revisions: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (m *storageMigration) deleteSource(ctx context.Context, srcPaths []string) []string {
+	if !m.opts.DeleteSource {
+		return nil
+	}
+
+	errs := []string{}
+	for _, p := range srcPaths {
+		err := m.src.DeleteObject(ctx, p)
+		if err != nil {
+			errs = append(errs, p+": "+err.Error())
+		}
+	}
+
+	return errs
+}
+
+func (m *storageMigration) saveCheckpoint(recordType string, lastID uint64) error {
+	if m.checkpoint.LastIDs[recordType] == lastID {
+		return nil
+	}
+
+	m.checkpoint.LastIDs[recordType] = lastID
+
+	if m.opts.CheckpointFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(m.checkpoint)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(m.opts.CheckpointFile, data, 0644)
+	if err != nil {
+		return fmt.Errorf("MigrateStorage error on save checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func loadStorageMigrationCheckpoint(filePath string) (*StorageMigrationCheckpoint, error) {
+	checkpoint := StorageMigrationCheckpoint{LastIDs: map[string]uint64{}}
+
+	if filePath == "" {
+		return &checkpoint, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &checkpoint, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &checkpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if checkpoint.LastIDs == nil {
+		checkpoint.LastIDs = map[string]uint64{}
+	}
+
+	return &checkpoint, nil
+}
@@ -0,0 +1,209 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	files_database "github.com/go-bolo/files/database"
+	files_storages "github.com/go-bolo/files/storages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateStorage(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	srcPath := "/tmp/_test_files_migration_src"
+	dstPath := "/tmp/_test_files_migration_dst"
+	defer os.RemoveAll(srcPath)
+	defer os.RemoveAll(dstPath)
+
+	src := files_storages.NewLocal(&files_storages.LocalCfg{App: app, DestinationPath: srcPath})
+	dst := files_storages.NewLocal(&files_storages.LocalCfg{App: app, DestinationPath: dstPath})
+	filePlugin.SetStorage("migration-src", src)
+	filePlugin.SetStorage("migration-dst", dst)
+	defer delete(filePlugin.Storages, "migration-src")
+	defer delete(filePlugin.Storages, "migration-dst")
+
+	tmpFilePath := filepath.Join(os.TempDir(), "migration-test.txt")
+	err := os.WriteFile(tmpFilePath, []byte("migration content"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	file := GetFileModelStub()
+	file.Name = "migration-file.txt"
+	file.StorageName = "migration-src"
+	file.CreatedAt = time.Now()
+	fileOriginalPath, _ := src.GetUploadPathFromFile("original", "", &file)
+	err = src.UploadFile(&file, tmpFilePath, fileOriginalPath)
+	assert.Nil(err)
+	fileURL, _ := src.GetUrlFromFile("original", &file)
+	file.SetURLs(files_database.ImageURLsField{"original": fileURL})
+	err = file.Save()
+	assert.Nil(err)
+
+	revision := RevisionModel{
+		RecordType:  AccessRecordTypeFile,
+		RecordID:    file.ID,
+		Number:      1,
+		StorageName: "migration-src",
+		CreatedAt:   time.Now(),
+		ReplacedAt:  time.Now(),
+	}
+	err = app.GetDB().Create(&revision).Error
+	assert.Nil(err)
+	revisionPath, _ := src.GetUploadPathFromFile(revision.GetStyle(), "", &file)
+	err = src.UploadFile(&file, tmpFilePath, revisionPath)
+	assert.Nil(err)
+
+	missingFile := GetFileModelStub()
+	missingFile.Name = "migration-missing.txt"
+	missingFile.StorageName = "migration-src"
+	missingFile.SetURLs(files_database.ImageURLsField{"original": "missing"})
+	err = missingFile.Save()
+	assert.Nil(err)
+
+	trashedFile := GetFileModelStub()
+	trashedFile.Name = "migration-trashed.txt"
+	trashedFile.StorageName = "migration-src"
+	trashedFile.CreatedAt = time.Now()
+	trashedOriginalPath, _ := src.GetUploadPathFromFile("original", "", &trashedFile)
+	err = src.UploadFile(&trashedFile, tmpFilePath, trashedOriginalPath)
+	assert.Nil(err)
+	trashedURL, _ := src.GetUrlFromFile("original", &trashedFile)
+	trashedFile.SetURLs(files_database.ImageURLsField{"original": trashedURL})
+	err = trashedFile.Save()
+	assert.Nil(err)
+	err = trashedFile.Delete()
+	assert.Nil(err)
+
+	image := GetImageModelStub()
+	image.Name = "migration-image.jpg"
+	image.StorageName = "migration-src"
+	image.CreatedAt = time.Now()
+	imageURLs := files_database.ImageURLsField{
+		"medium": "http://localhost/api/v1/image/medium/migration-image.jpg",
+	}
+	for _, style := range []string{"original", "thumbnail"} {
+		p, _ := src.GetUploadPathFromFile(style, "", &image)
+		err = src.UploadFile(&image, tmpFilePath, p)
+		assert.Nil(err)
+		imageURLs[style], _ = src.GetUrlFromFile(style, &image)
+	}
+	image.SetURLs(imageURLs)
+	err = image.Save()
+	assert.Nil(err)
+
+	checkpointFile := filepath.Join(os.TempDir(), "migration-checkpoint.json")
+	defer os.Remove(checkpointFile)
+
+	report, err := MigrateStorage(context.Background(), app, &StorageMigrationOptions{
+		From:           "migration-src",
+		To:             "migration-dst",
+		Concurrency:    2,
+		BatchSize:      1,
+		DeleteSource:   true,
+		CheckpointFile: checkpointFile,
+	})
+	assert.Nil(err)
+	assert.False(report.Running)
+	assert.Equal(3, report.Migrated)
+	assert.Len(report.Failures, 1)
+	assert.Equal(missingFile.ID, report.Failures[0].RecordID)
+
+	t.Run("Should copy the objects and update the records", func(t *testing.T) {
+		migratedFile := FileModel{}
+		err := FileFindOne(file.GetIDString(), &migratedFile)
+		assert.Nil(err)
+		assert.Equal("migration-dst", migratedFile.StorageName)
+
+		_, err = os.Stat(filepath.Join(dstPath, fileOriginalPath))
+		assert.Nil(err)
+		_, err = os.Stat(filepath.Join(srcPath, fileOriginalPath))
+		assert.True(os.IsNotExist(err))
+
+		_, err = os.Stat(filepath.Join(dstPath, revisionPath))
+		assert.Nil(err)
+		_, err = os.Stat(filepath.Join(srcPath, revisionPath))
+		assert.True(os.IsNotExist(err))
+
+		revisions, err := GetRecordRevisions(app.GetDB(), AccessRecordTypeFile, file.ID)
+		assert.Nil(err)
+		assert.Equal("migration-dst", revisions[0].StorageName)
+
+		migratedImage := ImageModel{}
+		err = ImageFindOne(image.GetIDString(), &migratedImage)
+		assert.Nil(err)
+		assert.Equal("migration-dst", migratedImage.StorageName)
+		assert.Equal(imageURLs["medium"], migratedImage.URLs["medium"])
+
+		thumbnailPath, _ := dst.GetUploadPathFromFile("thumbnail", "", &image)
+		_, err = os.Stat(filepath.Join(dstPath, thumbnailPath))
+		assert.Nil(err)
+	})
+
+	t.Run("Should migrate the records in the trash", func(t *testing.T) {
+		migratedFile := FileModel{}
+		err := app.GetDB().Unscoped().First(&migratedFile, trashedFile.ID).Error
+		assert.Nil(err)
+		assert.Equal("migration-dst", migratedFile.StorageName)
+		assert.True(migratedFile.IsTrashed())
+
+		_, err = os.Stat(filepath.Join(dstPath, trashedOriginalPath))
+		assert.Nil(err)
+	})
+
+	t.Run("Should keep failed records in the source storage", func(t *testing.T) {
+		notMigrated := FileModel{}
+		err := FileFindOne(missingFile.GetIDString(), &notMigrated)
+		assert.Nil(err)
+		assert.Equal("migration-src", notMigrated.StorageName)
+	})
+
+	t.Run("Should resume from the checkpoint", func(t *testing.T) {
+		checkpoint, err := loadStorageMigrationCheckpoint(checkpointFile)
+		assert.Nil(err)
+		assert.Equal(image.ID, checkpoint.LastIDs["images"])
+		// stops before the failed record
+		assert.Equal(file.ID, checkpoint.LastIDs["files"])
+
+		report, err := MigrateStorage(context.Background(), app, &StorageMigrationOptions{
+			From:           "migration-src",
+			To:             "migration-dst",
+			CheckpointFile: checkpointFile,
+		})
+		assert.Nil(err)
+		assert.Equal(0, report.Migrated)
+		assert.Len(report.Failures, 1)
+		assert.Equal(missingFile.ID, report.Failures[0].RecordID)
+	})
+
+	t.Run("Should not move the checkpoint in canceled migrations", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := MigrateStorage(ctx, app, &StorageMigrationOptions{
+			From:           "migration-src",
+			To:             "migration-dst",
+			CheckpointFile: checkpointFile,
+		})
+		assert.ErrorIs(err, context.Canceled)
+
+		checkpoint, err := loadStorageMigrationCheckpoint(checkpointFile)
+		assert.Nil(err)
+		assert.Equal(file.ID, checkpoint.LastIDs["files"])
+	})
+
+	t.Run("Should not read the checkpoint file from the request body", func(t *testing.T) {
+		opts := StorageMigrationOptions{}
+		err := json.Unmarshal([]byte(`{"from":"a","to":"b","checkpointFile":"/etc/files.json"}`), &opts)
+		assert.Nil(err)
+		assert.Equal("a", opts.From)
+		assert.Empty(opts.CheckpointFile)
+	})
+}
@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/go-bolo/bolo"
 	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
 	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
@@ -59,31 +63,23 @@ func (u *GCP) GetClientOptions() option.ClientOption {
 }
 
 func (u *GCP) SendFileThroughHTTP(c echo.Context, file files_dtos.FileDTO, style, format string) error {
-	bucket := u.BucketName
 	object, _ := u.GetUploadPathFromFile(style, format, file)
 
-	client, err := storage.NewClient(c.Request().Context(), u.GetClientOptions())
+	r, info, err := u.OpenSeekableObject(c.Request().Context(), object)
 	if err != nil {
-		return errors.Wrap(err, "storage.NewClient")
-	}
-	defer client.Close()
-
-	// check if file exists
-	r, err := client.Bucket(bucket).Object(object).NewReader(c.Request().Context())
-	if err != nil {
-		if !errors.Is(err, storage.ErrObjectNotExist) {
-			return err
-		} else {
+		if errors.Is(err, files_dtos.ErrObjectNotFound) {
 			return c.NoContent(http.StatusNotFound)
 		}
+		return err
 	}
+	defer r.Close()
 
-	return c.Stream(http.StatusOK, format, r)
+	return files_helpers.ServeObject(c, r, info)
 }
 
 func (u *GCP) GetUploadPathFromFile(imageStyle, format string, file files_dtos.FileDTO) (string, error) {
 	createdAt := file.GetCreatedAt()
-	datePrefix := createdAt.Format("2006/01/02")
+	datePrefix := files_dtos.GetTenantPathPrefix(file) + createdAt.Format("2006/01/02")
 
 	name := file.GetFileName()
 
@@ -91,12 +87,9 @@ func (u *GCP) GetUploadPathFromFile(imageStyle, format string, file files_dtos.F
 }
 
 func (u *GCP) GetUrlFromFile(imageStyle string, file files_dtos.FileDTO) (string, error) {
-	createdAt := file.GetCreatedAt()
-	datePrefix := createdAt.Format("2006/01/02")
+	object, _ := u.GetUploadPathFromFile(imageStyle, "", file)
 
-	name := file.GetFileName()
-
-	return gcsDomain + "/" + u.BucketName + "/" + datePrefix + "/" + imageStyle + "/" + name, nil
+	return gcsDomain + "/" + u.BucketName + "/" + object, nil
 }
 
 func (u *GCP) UploadFile(file files_dtos.FileDTO, tmpFilePath, destPath string) error {
@@ -184,3 +177,216 @@ func (u *GCP) FileToUploadMetadata(file files_dtos.FileDTO) error {
 func (u *GCP) FileName(file files_dtos.FileDTO) (string, error) {
 	return "", nil
 }
+
+func (u *GCP) ListObjects(ctx context.Context, fn func(obj files_dtos.StoredObject) error) error {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return fmt.Errorf("GCP.ListObjects: storage.NewClient: %w", err)
+	}
+	defer client.Close()
+
+	it := client.Bucket(u.BucketName).Objects(ctx, nil)
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("GCP.ListObjects: %w", err)
+		}
+
+		err = fn(files_dtos.StoredObject{
+			Path:      attrs.Name,
+			Size:      attrs.Size,
+			UpdatedAt: attrs.Updated,
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (u *GCP) DeleteObject(ctx context.Context, objectPath string) error {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return fmt.Errorf("GCP.DeleteObject: storage.NewClient: %w", err)
+	}
+	defer client.Close()
+
+	err = client.Bucket(u.BucketName).Object(objectPath).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (u *GCP) StatObject(ctx context.Context, objectPath string) (*files_dtos.StoredObject, error) {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("GCP.StatObject: storage.NewClient: %w", err)
+	}
+	defer client.Close()
+
+	attrs, err := client.Bucket(u.BucketName).Object(objectPath).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return &files_dtos.StoredObject{
+		Path:      attrs.Name,
+		Size:      attrs.Size,
+		UpdatedAt: attrs.Updated,
+	}, nil
+}
+
+// OpenObject - The returned reader closes the storage client on Close
+func (u *GCP) OpenObject(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return nil, fmt.Errorf("GCP.OpenObject: storage.NewClient: %w", err)
+	}
+
+	r, err := client.Bucket(u.BucketName).Object(objectPath).NewReader(ctx)
+	if err != nil {
+		client.Close()
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return &gcpObjectReader{Reader: r, client: client}, nil
+}
+
+type gcpObjectReader struct {
+	*storage.Reader
+	client *storage.Client
+}
+
+func (r *gcpObjectReader) Close() error {
+	err := r.Reader.Close()
+	r.client.Close()
+	return err
+}
+
+// OpenSeekableObject - Each read after one seek opens one range reader, the returned reader closes
+// the storage client on Close
+func (u *GCP) OpenSeekableObject(ctx context.Context, objectPath string) (io.ReadSeekCloser, *files_dtos.StoredObject, error) {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("GCP.OpenSeekableObject: storage.NewClient: %w", err)
+	}
+
+	obj := client.Bucket(u.BucketName).Object(objectPath)
+
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		client.Close()
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+
+	info := files_dtos.StoredObject{
+		Path:         attrs.Name,
+		Size:         attrs.Size,
+		UpdatedAt:    attrs.Updated,
+		ETag:         attrs.Etag,
+		ContentType:  attrs.ContentType,
+		CacheControl: attrs.CacheControl,
+	}
+
+	return &gcpRangeReader{ctx: ctx, client: client, obj: obj, size: attrs.Size}, &info, nil
+}
+
+type gcpRangeReader struct {
+	ctx    context.Context
+	client *storage.Client
+	obj    *storage.ObjectHandle
+	size   int64
+	pos    int64
+	r      *storage.Reader
+}
+
+func (r *gcpRangeReader) Read(p []byte) (int, error) {
+	if r.pos >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.r == nil {
+		reader, err := r.obj.NewRangeReader(r.ctx, r.pos, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.r = reader
+	}
+
+	n, err := r.r.Read(p)
+	r.pos += int64(n)
+
+	return n, err
+}
+
+func (r *gcpRangeReader) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = r.pos + offset
+	case io.SeekEnd:
+		pos = r.size + offset
+	default:
+		return 0, errors.New("GCP: invalid seek whence")
+	}
+
+	if pos < 0 {
+		return 0, errors.New("GCP: negative seek position")
+	}
+
+	if pos != r.pos && r.r != nil {
+		r.r.Close()
+		r.r = nil
+	}
+
+	r.pos = pos
+
+	return pos, nil
+}
+
+func (r *gcpRangeReader) Close() error {
+	if r.r != nil {
+		r.r.Close()
+	}
+
+	return r.client.Close()
+}
+
+// GetSignedURL - Create one signed GET url, the Content-Disposition is passed as response header override
+func (u *GCP) GetSignedURL(ctx context.Context, objectPath string, opts *files_dtos.SignedURLOptions) (string, error) {
+	client, err := storage.NewClient(ctx, u.GetClientOptions())
+	if err != nil {
+		return "", fmt.Errorf("GCP.GetSignedURL: storage.NewClient: %w", err)
+	}
+	defer client.Close()
+
+	signOpts := storage.SignedURLOptions{
+		Method:  http.MethodGet,
+		Expires: time.Now().Add(opts.Expires),
+		Scheme:  storage.SigningSchemeV4,
+	}
+
+	if opts.ContentDisposition != "" {
+		signOpts.QueryParameters = url.Values{
+			"response-content-disposition": {opts.ContentDisposition},
+		}
+	}
+
+	return client.Bucket(u.BucketName).SignedURL(objectPath, &signOpts)
+}
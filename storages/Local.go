@@ -1,9 +1,14 @@
 package files_storages
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/go-bolo/bolo"
 	files_dtos "github.com/go-bolo/files/dtos"
@@ -33,11 +38,22 @@ type Local struct {
 }
 
 func (s *Local) SendFileThroughHTTP(c echo.Context, file files_dtos.FileDTO, style, format string) error {
-	return nil
+	objectPath, _ := s.GetUploadPathFromFile(style, format, file)
+
+	f, info, err := s.OpenSeekableObject(c.Request().Context(), objectPath)
+	if err != nil {
+		if errors.Is(err, files_dtos.ErrObjectNotFound) {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return err
+	}
+	defer f.Close()
+
+	return files_helpers.ServeObject(c, f, info)
 }
 
 func (s *Local) GetUploadPathFromFile(imageStyle, format string, file files_dtos.FileDTO) (string, error) {
-	datePrefix := time.Now().Format("2006/01/02")
+	datePrefix := files_dtos.GetTenantPathPrefix(file) + file.GetCreatedAt().Format("2006/01/02")
 
 	return datePrefix + "/" + imageStyle + "/" + file.GetFileName(), nil
 }
@@ -67,7 +83,14 @@ func (s *Local) UploadFile(file files_dtos.FileDTO, tmpFilePath string, destPath
 }
 
 func (s *Local) DestroyFile(file files_dtos.FileDTO) error {
-	panic("not implemented") // TODO: Implement
+	for style := range file.GetURLs() {
+		err := s.DeleteImageStyle(file, style, "")
+		if err != nil {
+			return fmt.Errorf("Local.DestroyFile: DeleteImageStyle: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func (s *Local) FileToUploadMetadata(file files_dtos.FileDTO) error {
@@ -79,5 +102,107 @@ func (s *Local) FileName(file files_dtos.FileDTO) (string, error) {
 }
 
 func (s *Local) DeleteImageStyle(file files_dtos.FileDTO, style, format string) error {
-	panic("not implemented") // TODO: Implement
+	dest, err := s.GetUploadPathFromFile(style, format, file)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(s.DestinationPath + "/" + dest)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Local) ListObjects(ctx context.Context, fn func(obj files_dtos.StoredObject) error) error {
+	return filepath.WalkDir(s.DestinationPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(s.DestinationPath, p)
+		if err != nil {
+			return err
+		}
+
+		return fn(files_dtos.StoredObject{
+			Path:      filepath.ToSlash(rel),
+			Size:      info.Size(),
+			UpdatedAt: info.ModTime(),
+		})
+	})
+}
+
+func (s *Local) DeleteObject(ctx context.Context, objectPath string) error {
+	err := os.Remove(s.DestinationPath + "/" + objectPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Local) StatObject(ctx context.Context, objectPath string) (*files_dtos.StoredObject, error) {
+	info, err := os.Stat(s.DestinationPath + "/" + objectPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return &files_dtos.StoredObject{
+		Path:      objectPath,
+		Size:      info.Size(),
+		UpdatedAt: info.ModTime(),
+	}, nil
+}
+
+func (s *Local) OpenObject(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	f, err := os.Open(s.DestinationPath + "/" + objectPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *Local) OpenSeekableObject(ctx context.Context, objectPath string) (io.ReadSeekCloser, *files_dtos.StoredObject, error) {
+	f, err := os.Open(s.DestinationPath + "/" + objectPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, files_dtos.ErrObjectNotFound
+		}
+		return nil, nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, &files_dtos.StoredObject{
+		Path:      objectPath,
+		Size:      stat.Size(),
+		UpdatedAt: stat.ModTime(),
+		ETag:      fmt.Sprintf("%x-%x", stat.ModTime().UnixNano(), stat.Size()),
+	}, nil
 }
@@ -0,0 +1,432 @@
+package files
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-bolo/bolo"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTagInvalidName = errors.New("tag name is required")
+	ErrTagExists      = errors.New("tag with same slug already exists")
+)
+
+func NewTagModel() *TagModel {
+	return &TagModel{
+		CreatedAt: time.Now(),
+	}
+}
+
+// TagModel - Tag of files and images, slugs are unique in each tenant and used in the ?tags= filter
+type TagModel struct {
+	ID        uint64    `gorm:"column:id;primary_key" json:"id" filter:"param:id;type:number"`
+	Name      string    `gorm:"column:name;type:varchar(255);not null" json:"name" filter:"param:name;type:string"`
+	Slug      string    `gorm:"column:slug;type:varchar(255);not null;uniqueIndex:mediatags_tenantId_slug" json:"slug" filter:"param:slug;type:string"`
+	TenantID  string    `gorm:"column:tenantId;type:varchar(100);not null;default:'';uniqueIndex:mediatags_tenantId_slug" json:"-"`
+	CreatorID *int64    `gorm:"column:creatorId;type:int(11)" json:"creatorId" filter:"param:creatorId;type:number"`
+	CreatedAt time.Time `gorm:"column:createdAt;type:datetime;not null" json:"createdAt" filter:"param:createdAt;type:date"`
+	UpdatedAt time.Time `gorm:"column:updatedAt;type:datetime;not null" json:"updatedAt" filter:"param:updatedAt;type:date"`
+}
+
+// TableName get sql table name
+func (m *TagModel) TableName() string {
+	return "mediatags"
+}
+
+func (m *TagModel) GetIDString() string {
+	return strconv.FormatInt(int64(m.ID), 10)
+}
+
+// FileTagModel - Association between one file and one tag
+type FileTagModel struct {
+	FileID    uint64    `gorm:"column:fileId;primaryKey;autoIncrement:false" json:"fileId"`
+	TagID     uint64    `gorm:"column:tagId;primaryKey;autoIncrement:false;index" json:"tagId"`
+	CreatedAt time.Time `gorm:"column:createdAt;type:datetime;not null" json:"createdAt"`
+}
+
+// TableName get sql table name
+func (m *FileTagModel) TableName() string {
+	return "filetags"
+}
+
+// ImageTagModel - Association between one image and one tag
+type ImageTagModel struct {
+	ImageID   uint64    `gorm:"column:imageId;primaryKey;autoIncrement:false" json:"imageId"`
+	TagID     uint64    `gorm:"column:tagId;primaryKey;autoIncrement:false;index" json:"tagId"`
+	CreatedAt time.Time `gorm:"column:createdAt;type:datetime;not null" json:"createdAt"`
+}
+
+// TableName get sql table name
+func (m *ImageTagModel) TableName() string {
+	return "imagetags"
+}
+
+// GetTagSlug - Get the tag slug from one name, like "Summer Trip" -> "summer-trip"
+func GetTagSlug(name string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// Save - Create or update the tag, the slug is generated from the name if empty
+func (m *TagModel) Save() error {
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Slug == "" {
+		m.Slug = GetTagSlug(m.Name)
+	} else {
+		m.Slug = GetTagSlug(m.Slug)
+	}
+
+	if m.Name == "" || m.Slug == "" {
+		return ErrTagInvalidName
+	}
+
+	db := bolo.GetDefaultDatabaseConnection()
+
+	var count int64
+	err := db.Model(&TagModel{}).
+		Where("tenantId = ? AND slug = ? AND id <> ?", m.TenantID, m.Slug, m.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrTagExists
+	}
+
+	if m.ID == 0 {
+		return db.Create(m).Error
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Save(m).Error
+		if err != nil {
+			return err
+		}
+
+		// tag names are indexed with the records
+		return m.reindexTaggedRecords(tx)
+	})
+}
+
+// Delete - Delete the tag and its associations with files and images
+func (m *TagModel) Delete() error {
+	db := bolo.GetDefaultDatabaseConnection()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		fileIDs, imageIDs, err := m.getTaggedRecordIDs(tx)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("tagId = ?", m.ID).Delete(&FileTagModel{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("tagId = ?", m.ID).Delete(&ImageTagModel{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(m).Error
+		if err != nil {
+			return err
+		}
+
+		err = reindexSearchRecords(tx, AccessRecordTypeFile, fileIDs)
+		if err != nil {
+			return err
+		}
+
+		return reindexSearchRecords(tx, AccessRecordTypeImage, imageIDs)
+	})
+}
+
+// getTaggedRecordIDs - Get the ids of files and images with the tag
+func (m *TagModel) getTaggedRecordIDs(tx *gorm.DB) ([]uint64, []uint64, error) {
+	fileIDs := []uint64{}
+	err := tx.Model(&FileTagModel{}).Where("tagId = ?", m.ID).Pluck("fileId", &fileIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	imageIDs := []uint64{}
+	err = tx.Model(&ImageTagModel{}).Where("tagId = ?", m.ID).Pluck("imageId", &imageIDs).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return fileIDs, imageIDs, nil
+}
+
+// reindexTaggedRecords - Update the search index of files and images with the tag
+func (m *TagModel) reindexTaggedRecords(tx *gorm.DB) error {
+	if !hasSearchIndex(getSearchBackend()) {
+		return nil
+	}
+
+	fileIDs, imageIDs, err := m.getTaggedRecordIDs(tx)
+	if err != nil {
+		return err
+	}
+
+	err = reindexSearchRecords(tx, AccessRecordTypeFile, fileIDs)
+	if err != nil {
+		return err
+	}
+
+	return reindexSearchRecords(tx, AccessRecordTypeImage, imageIDs)
+}
+
+// TagFindOne - Find one tag record by id or slug
+func TagFindOne(id string, record *TagModel, scopes ...func(*gorm.DB) *gorm.DB) error {
+	db := bolo.GetDefaultDatabaseConnection().Scopes(scopes...)
+
+	return db.Where("id = ? OR slug = ?", id, id).First(record).Error
+}
+
+// requestTagFindOne - Find one tag in the request tenant
+func requestTagFindOne(ctx *bolo.RequestContext, id string, record *TagModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return TagFindOne(id, record, scope)
+}
+
+// getTagTable - Get the tags join table and record column of files or images
+func getTagTable(recordType string) (string, string) {
+	if recordType == AccessRecordTypeImage {
+		return "imagetags", "imageId"
+	}
+
+	return "filetags", "fileId"
+}
+
+// getTagModel - Get the tags join model of files or images
+func getTagModel(recordType string) interface{} {
+	if recordType == AccessRecordTypeImage {
+		return &ImageTagModel{}
+	}
+
+	return &FileTagModel{}
+}
+
+// AddTags - Tag the records, existing associations are kept. Returns the number of new associations
+func AddTags(db *gorm.DB, recordType string, recordIDs, tagIDs []uint64) (int64, error) {
+	if len(recordIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+
+	table, column := getTagTable(recordType)
+
+	var added int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		existing := []struct {
+			RecordID uint64
+			TagID    uint64
+		}{}
+
+		err := tx.Table(table).
+			Select(column+" AS record_id, tagId AS tag_id").
+			Where(column+" IN ? AND tagId IN ?", recordIDs, tagIDs).
+			Scan(&existing).Error
+		if err != nil {
+			return err
+		}
+
+		found := map[[2]uint64]bool{}
+		for _, e := range existing {
+			found[[2]uint64{e.RecordID, e.TagID}] = true
+		}
+
+		now := time.Now()
+		rows := []map[string]interface{}{}
+		for _, recordID := range recordIDs {
+			for _, tagID := range tagIDs {
+				if !found[[2]uint64{recordID, tagID}] {
+					rows = append(rows, map[string]interface{}{column: recordID, "tagId": tagID, "createdAt": now})
+				}
+			}
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		added = int64(len(rows))
+
+		err = tx.Table(table).CreateInBatches(rows, 500).Error
+		if err != nil {
+			return err
+		}
+
+		return reindexSearchRecords(tx, recordType, recordIDs)
+	})
+
+	return added, err
+}
+
+// RemoveTags - Untag the records, returns the number of removed associations
+func RemoveTags(db *gorm.DB, recordType string, recordIDs, tagIDs []uint64) (int64, error) {
+	if len(recordIDs) == 0 || len(tagIDs) == 0 {
+		return 0, nil
+	}
+
+	_, column := getTagTable(recordType)
+
+	var removed int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		r := tx.
+			Where(column+" IN ? AND tagId IN ?", recordIDs, tagIDs).
+			Delete(getTagModel(recordType))
+		if r.Error != nil {
+			return r.Error
+		}
+
+		removed = r.RowsAffected
+
+		return reindexSearchRecords(tx, recordType, recordIDs)
+	})
+
+	return removed, err
+}
+
+// getRecordsTags - Get the tags of many files or images in one query, by record id
+func getRecordsTags(db *gorm.DB, recordType string, recordIDs []uint64) (map[uint64][]*TagModel, error) {
+	result := map[uint64][]*TagModel{}
+	if len(recordIDs) == 0 {
+		return result, nil
+	}
+
+	table, column := getTagTable(recordType)
+
+	rows := []struct {
+		TagModel
+		RecordID uint64 `gorm:"column:recordId"`
+	}{}
+
+	err := db.Table("mediatags").
+		Select("mediatags.*, "+table+"."+column+" AS recordId").
+		Joins("INNER JOIN "+table+" ON "+table+".tagId = mediatags.id").
+		Where(table+"."+column+" IN ?", recordIDs).
+		Order("mediatags.name ASC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rows {
+		tag := rows[i].TagModel
+		result[rows[i].RecordID] = append(result[rows[i].RecordID], &tag)
+	}
+
+	return result, nil
+}
+
+// LoadFilesTags - Set the tags of one list of files
+func LoadFilesTags(records []*FileModel) error {
+	ids := []uint64{}
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+
+	tags, err := getRecordsTags(bolo.GetDefaultDatabaseConnection(), AccessRecordTypeFile, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		r.Tags = tags[r.ID]
+	}
+
+	return nil
+}
+
+// LoadImagesTags - Set the tags of one list of images
+func LoadImagesTags(records []*ImageModel) error {
+	ids := []uint64{}
+	for _, r := range records {
+		ids = append(ids, r.ID)
+	}
+
+	tags, err := getRecordsTags(bolo.GetDefaultDatabaseConnection(), AccessRecordTypeImage, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		r.Tags = tags[r.ID]
+	}
+
+	return nil
+}
+
+// applyTagSelector - Filter queries with ?tags=slug1,slug2 to records with all tags, or with any of
+// the tags with ?tagsMatch=any
+func applyTagSelector(ctx *bolo.RequestContext, recordType string, query *gorm.DB) (*gorm.DB, error) {
+	slugs := []string{}
+	found := map[string]bool{}
+	for _, slug := range strings.Split(ctx.QueryParam("tags"), ",") {
+		if slug = strings.TrimSpace(slug); slug != "" && !found[slug] {
+			slugs = append(slugs, slug)
+			found[slug] = true
+		}
+	}
+
+	if len(slugs) == 0 {
+		return query, nil
+	}
+
+	tenantID, err := getTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	table, column := getTagTable(recordType)
+	db := bolo.GetDefaultDatabaseConnection()
+
+	subQuery := db.Table(table).
+		Select(table+"."+column).
+		Joins("INNER JOIN mediatags ON mediatags.id = "+table+".tagId").
+		Where("mediatags.tenantId = ? AND mediatags.slug IN ?", tenantID, slugs)
+
+	if ctx.QueryParam("tagsMatch") != "any" {
+		subQuery = subQuery.
+			Group(table+"."+column).
+			Having("COUNT(DISTINCT "+table+".tagId) = ?", len(slugs))
+	}
+
+	return query.Where("id IN (?)", subQuery), nil
+}
+
+// deleteRecordTags - Remove the tag associations of one destroyed record
+func deleteRecordTags(tx *gorm.DB, recordType string, recordID uint64) error {
+	_, column := getTagTable(recordType)
+
+	return tx.Where(column+" = ?", recordID).Delete(getTagModel(recordType)).Error
+}
@@ -0,0 +1,217 @@
+package files
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTagSlug(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("summer-trip", GetTagSlug("Summer Trip"))
+	assert.Equal("summer-trip-2023", GetTagSlug("  Summer   Trip / 2023! "))
+	assert.Equal("ação", GetTagSlug("Ação"))
+	assert.Equal("", GetTagSlug(" -- "))
+}
+
+func TestTags(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.TagController
+
+	newCtx := func(method, url, body string) (*bolo.RequestContext, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		return GetRequestContextStub(app, req, "administrator")
+	}
+
+	createTag := func(body string) (*TagModel, error) {
+		ctx, rec := newCtx(http.MethodPost, "/api/v2/tag", body)
+
+		err := ctl.Create(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		resp := TagFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record, nil
+	}
+
+	bulk := func(action func(echo.Context) error, body string) *TagBulkResult {
+		ctx, rec := newCtx(http.MethodPost, "/api/v2/tag/bulk", body)
+
+		err := action(ctx)
+		assert.Nil(err)
+
+		resp := TagBulkJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Result
+	}
+
+	queryFiles := func(query string) *FileListJSONResponse {
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/file?limit=1000&"+query, "")
+
+		err := filePlugin.FileController.Query(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal(int64(len(*resp.Records)), resp.Meta.Count)
+		return &resp
+	}
+
+	beach, err := createTag(`{"tag": {"name": "Beach Day"}}`)
+	assert.Nil(err)
+	night, err := createTag(`{"tag": {"name": "Night", "slug": "Night Shots"}}`)
+	assert.Nil(err)
+
+	files := []FileModel{}
+	for i := 0; i < 3; i++ {
+		f := GetFileModelStub()
+		err := f.Save()
+		assert.Nil(err)
+		files = append(files, f)
+	}
+
+	pdf := "application/pdf"
+	files[2].Mime = &pdf
+	err = files[2].Save()
+	assert.Nil(err)
+
+	t.Run("Should create tags with slugs", func(t *testing.T) {
+		assert.Equal("beach-day", beach.Slug)
+		assert.Equal("night-shots", night.Slug)
+	})
+
+	t.Run("Should reject invalid and duplicated tags", func(t *testing.T) {
+		_, err := createTag(`{"tag": {"name": " "}}`)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+
+		_, err = createTag(`{"tag": {"name": "beach day"}}`)
+		assert.NotNil(err)
+		assert.Equal(http.StatusConflict, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should bulk tag files", func(t *testing.T) {
+		result := bulk(ctl.BulkTag, `{"fileIds": ["`+files[0].GetIDString()+`", "`+files[1].GetIDString()+`", "`+files[2].GetIDString()+`"], "tagIds": ["beach-day"]}`)
+		assert.Equal(int64(3), result.Files)
+
+		result = bulk(ctl.BulkTag, `{"fileIds": ["`+files[0].GetIDString()+`", "`+files[2].GetIDString()+`"], "tagIds": ["`+night.GetIDString()+`", "beach-day"]}`)
+		assert.Equal(int64(2), result.Files)
+
+		resp := queryFiles("tags=beach-day")
+		assert.Len(*resp.Records, 3)
+
+		for _, r := range *resp.Records {
+			if r.ID == files[0].ID {
+				assert.Len(r.Tags, 2)
+			}
+		}
+	})
+
+	t.Run("Should filter files with all or any tags", func(t *testing.T) {
+		resp := queryFiles("tags=beach-day,night-shots")
+		assert.Equal(int64(2), resp.Meta.Count)
+
+		resp = queryFiles("tags=beach-day,night-shots&tagsMatch=any")
+		assert.Equal(int64(3), resp.Meta.Count)
+
+		resp = queryFiles("tags=night-shots,unknown-tag")
+		assert.Equal(int64(0), resp.Meta.Count)
+	})
+
+	t.Run("Should count facets of the filtered files", func(t *testing.T) {
+		resp := queryFiles("tags=beach-day&facets=tag,mime,orientation")
+
+		assert.Len(resp.Meta.Facets, 2)
+
+		tags := map[string]int64{}
+		for _, v := range resp.Meta.Facets[FacetTag] {
+			tags[v.Value] = v.Count
+		}
+		assert.Equal(map[string]int64{"beach-day": 3, "night-shots": 2}, tags)
+
+		mimes := map[string]int64{}
+		for _, v := range resp.Meta.Facets[FacetMime] {
+			mimes[v.Value] = v.Count
+		}
+		assert.Equal(map[string]int64{"image/jpeg": 2, "application/pdf": 1}, mimes)
+	})
+
+	t.Run("Should bulk untag files", func(t *testing.T) {
+		result := bulk(ctl.BulkUntag, `{"fileIds": ["`+files[0].GetIDString()+`"], "tagIds": ["night-shots"]}`)
+		assert.Equal(int64(1), result.Files)
+
+		resp := queryFiles("tags=night-shots")
+		assert.Equal(int64(1), resp.Meta.Count)
+		assert.Equal(files[2].ID, (*resp.Records)[0].ID)
+	})
+
+	t.Run("Should filter and count image orientations", func(t *testing.T) {
+		sizes := [][2]int{{800, 600}, {1024, 768}, {600, 800}, {0, 0}}
+		ids := []string{}
+		for _, size := range sizes {
+			img := GetImageModelStub()
+			img.Width, img.Height = size[0], size[1]
+			err := img.Save()
+			assert.Nil(err)
+			ids = append(ids, `"`+img.GetIDString()+`"`)
+		}
+
+		result := bulk(ctl.BulkTag, `{"imageIds": [`+strings.Join(ids, ",")+`], "tagIds": ["beach-day"]}`)
+		assert.Equal(int64(4), result.Images)
+
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/image?tags=beach-day&facets=orientation&orientation=landscape", "")
+		err := filePlugin.ImageController.Query(ctx)
+		assert.Nil(err)
+
+		resp := ImageListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal(int64(2), resp.Meta.Count)
+		assert.Len(resp.Meta.Facets[FacetOrientation], 1)
+		assert.Equal(ImageOrientationLandscape, resp.Meta.Facets[FacetOrientation][0].Value)
+
+		ctx, rec = newCtx(http.MethodGet, "/api/v1/image?tags=beach-day&facets=orientation", "")
+		err = filePlugin.ImageController.Query(ctx)
+		assert.Nil(err)
+
+		resp = ImageListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+
+		orientations := map[string]int64{}
+		for _, v := range resp.Meta.Facets[FacetOrientation] {
+			orientations[v.Value] = v.Count
+		}
+		assert.Equal(map[string]int64{"landscape": 2, "portrait": 1, "unknown": 1}, orientations)
+	})
+
+	t.Run("Should delete tags with the associations", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodDelete, "/api/v2/tag/"+night.GetIDString(), "")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(night.GetIDString())
+
+		err := ctl.Delete(ctx)
+		assert.Nil(err)
+
+		var count int64
+		err = app.GetDB().Model(&FileTagModel{}).Where("tagId = ?", night.ID).Count(&count).Error
+		assert.Nil(err)
+		assert.Equal(int64(0), count)
+	})
+}
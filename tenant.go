@@ -0,0 +1,240 @@
+package files
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const tenantIDContextKey = "files.tenantID"
+
+var (
+	ErrInvalidTenantID = errors.New("invalid tenant id")
+	// tenant ids are used as storage key prefixes
+	tenantIDRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,99}$`)
+)
+
+// TenantResolver - Get the tenant of one request. With one tenant resolver all queries are filtered by
+// the request tenant, uploads are saved with the tenant and stored with the tenant id as key prefix
+type TenantResolver interface {
+	GetTenantID(ctx *bolo.RequestContext) (string, error)
+}
+
+// TenantResolverFunc - Use one function as tenant resolver
+type TenantResolverFunc func(ctx *bolo.RequestContext) (string, error)
+
+func (f TenantResolverFunc) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	return f(ctx)
+}
+
+// HostTenantResolver - Get the tenant from the request host. Hosts maps hosts to tenant ids, with one
+// empty Hosts map the host without port is the tenant id
+type HostTenantResolver struct {
+	Hosts map[string]string
+}
+
+func (r *HostTenantResolver) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	host := ctx.Request().Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if r.Hosts == nil {
+		return host, nil
+	}
+
+	return r.Hosts[host], nil
+}
+
+// HeaderTenantResolver - Get the tenant from one request header, X-Tenant-ID by default. Only use it
+// behind one proxy that sets the header
+type HeaderTenantResolver struct {
+	Header string
+}
+
+func (r *HeaderTenantResolver) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	header := r.Header
+	if header == "" {
+		header = "X-Tenant-ID"
+	}
+
+	return ctx.Request().Header.Get(header), nil
+}
+
+// UserTenantResolver - Get the tenant of the authenticated user, anonymous requests use the empty tenant
+type UserTenantResolver struct {
+	GetUserTenantID func(user bolo.UserInterface) (string, error)
+}
+
+func (r *UserTenantResolver) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	if !ctx.IsAuthenticated || ctx.AuthenticatedUser == nil {
+		return "", nil
+	}
+
+	return r.GetUserTenantID(ctx.AuthenticatedUser)
+}
+
+// FirstTenantResolver - Use the first not empty tenant from the resolvers, like user then host
+type FirstTenantResolver []TenantResolver
+
+func (resolvers FirstTenantResolver) GetTenantID(ctx *bolo.RequestContext) (string, error) {
+	for _, r := range resolvers {
+		tenantID, err := r.GetTenantID(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if tenantID != "" {
+			return tenantID, nil
+		}
+	}
+
+	return "", nil
+}
+
+// TenantStorageCfg - Storages used in uploads of one tenant, empty names use the default storages
+type TenantStorageCfg struct {
+	FileStorageName  string
+	ImageStorageName string
+}
+
+// getTenantID - Resolve the request tenant once and keep it in the request context, returns one
+// empty tenant if the plugin has no tenant resolver
+func getTenantID(ctx *bolo.RequestContext) (string, error) {
+	if v, ok := ctx.Get(tenantIDContextKey).(string); ok {
+		return v, nil
+	}
+
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	if filePlugin.TenantResolver == nil {
+		return "", nil
+	}
+
+	tenantID, err := filePlugin.TenantResolver.GetTenantID(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if tenantID != "" && !tenantIDRegexp.MatchString(tenantID) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, ErrInvalidTenantID.Error())
+	}
+
+	ctx.Set(tenantIDContextKey, tenantID)
+
+	return tenantID, nil
+}
+
+// TenantScope - Gorm scope to filter files or images by tenant
+func TenantScope(tenantID string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("tenantId = ?", tenantID)
+	}
+}
+
+// getTenantScope - Get the request tenant scope, without tenant resolver records aren't filtered
+func getTenantScope(ctx *bolo.RequestContext) (func(db *gorm.DB) *gorm.DB, error) {
+	filePlugin := ctx.App.GetPlugin("files").(*FilePlugin)
+	if filePlugin.TenantResolver == nil {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	tenantID, err := getTenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return TenantScope(tenantID), nil
+}
+
+// scopeQueryByTenant - Filter one file or image query by the request tenant
+func scopeQueryByTenant(ctx *bolo.RequestContext, query *gorm.DB) (*gorm.DB, error) {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Scopes(scope), nil
+}
+
+// GetTenantFileStorageName - Get the storage for new files of the tenant
+func (p *FilePlugin) GetTenantFileStorageName(tenantID string) string {
+	if cfg, ok := p.TenantStorages[tenantID]; ok && cfg.FileStorageName != "" {
+		return cfg.FileStorageName
+	}
+
+	return p.FileStorageName
+}
+
+// GetTenantImageStorageName - Get the storage for new images of the tenant
+func (p *FilePlugin) GetTenantImageStorageName(tenantID string) string {
+	if cfg, ok := p.TenantStorages[tenantID]; ok && cfg.ImageStorageName != "" {
+		return cfg.ImageStorageName
+	}
+
+	return p.ImageStorageName
+}
+
+// requestFileFindOne - Find one file in the request tenant, expired files return one 410 Gone error
+func requestFileFindOne(ctx *bolo.RequestContext, id string, record *FileModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = FileFindOne(id, record, scope)
+	if err != nil {
+		return err
+	}
+
+	if record.IsExpired() {
+		return expiredHTTPError()
+	}
+
+	return nil
+}
+
+// requestTrashedFileFindOne - Find one trashed file in the request tenant
+func requestTrashedFileFindOne(ctx *bolo.RequestContext, id string, record *FileModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return TrashedFileFindOne(id, record, scope)
+}
+
+// requestImageFindOne - Find one image in the request tenant, expired images return one 410 Gone error
+func requestImageFindOne(ctx *bolo.RequestContext, id string, record *ImageModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = ImageFindOne(id, record, scope)
+	if err != nil {
+		return err
+	}
+
+	if record.IsExpired() {
+		return expiredHTTPError()
+	}
+
+	return nil
+}
+
+// requestTrashedImageFindOne - Find one trashed image in the request tenant
+func requestTrashedImageFindOne(ctx *bolo.RequestContext, id string, record *ImageModel) error {
+	scope, err := getTenantScope(ctx)
+	if err != nil {
+		return err
+	}
+
+	return TrashedImageFindOne(id, record, scope)
+}
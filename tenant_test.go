@@ -0,0 +1,163 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-bolo/bolo"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/file", nil)
+	req.Host = "Tenant-A.example.com:8080"
+	req.Header.Set("X-Tenant-ID", "tenant-b")
+	ctx, _ := GetRequestContextStub(app, req, "authenticated")
+
+	t.Run("Should get the tenant from the host", func(t *testing.T) {
+		tenantID, err := (&HostTenantResolver{}).GetTenantID(ctx)
+		assert.Nil(err)
+		assert.Equal("tenant-a.example.com", tenantID)
+
+		tenantID, err = (&HostTenantResolver{Hosts: map[string]string{"tenant-a.example.com": "a"}}).GetTenantID(ctx)
+		assert.Nil(err)
+		assert.Equal("a", tenantID)
+	})
+
+	t.Run("Should get the tenant from the header", func(t *testing.T) {
+		tenantID, err := (&HeaderTenantResolver{}).GetTenantID(ctx)
+		assert.Nil(err)
+		assert.Equal("tenant-b", tenantID)
+	})
+
+	t.Run("Should use the first resolver with one tenant", func(t *testing.T) {
+		userResolver := &UserTenantResolver{GetUserTenantID: func(user bolo.UserInterface) (string, error) {
+			return "tenant-" + user.GetID(), nil
+		}}
+		resolver := FirstTenantResolver{userResolver, &HeaderTenantResolver{}}
+
+		tenantID, err := resolver.GetTenantID(ctx)
+		assert.Nil(err)
+		assert.Equal("tenant-b", tenantID)
+
+		ctx.IsAuthenticated = true
+		ctx.AuthenticatedUser = &UserStub{ID: "7"}
+		defer func() { ctx.IsAuthenticated = false }()
+
+		tenantID, err = resolver.GetTenantID(ctx)
+		assert.Nil(err)
+		assert.Equal("tenant-7", tenantID)
+	})
+}
+
+func TestTenantIsolation(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.FileController
+
+	filePlugin.TenantResolver = &HeaderTenantResolver{}
+	defer func() {
+		filePlugin.TenantResolver = nil
+		filePlugin.TenantStorages = nil
+	}()
+
+	newCtx := func(method, url, tenantID string, body *bytes.Buffer, contentType string) (*bolo.RequestContext, *httptest.ResponseRecorder) {
+		var req *http.Request
+		if body != nil {
+			req = httptest.NewRequest(method, url, body)
+			req.Header.Set("Content-Type", contentType)
+		} else {
+			req = httptest.NewRequest(method, url, nil)
+		}
+		req.Header.Set("X-Tenant-ID", tenantID)
+
+		return GetRequestContextStub(app, req, "administrator")
+	}
+
+	upload := func(tenantID string) *FileModel {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "tenant.txt")
+		part.Write([]byte("tenant file"))
+		w.Close()
+
+		ctx, rec := newCtx(http.MethodPost, "/api/v1/file", tenantID, &body, w.FormDataContentType())
+
+		err := ctl.UploadFile(ctx)
+		assert.Nil(err)
+
+		resp := FileFindOneJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		return resp.Record
+	}
+
+	first := upload("tenant-a")
+	second := upload("tenant-b")
+
+	t.Run("Should save the tenant and prefix the storage path", func(t *testing.T) {
+		record := FileModel{}
+		err := FileFindOne(first.GetIDString(), &record)
+		assert.Nil(err)
+		assert.Equal("tenant-a", record.TenantID)
+
+		storage := filePlugin.GetStorage(record.StorageName)
+		dest, err := storage.GetUploadPathFromFile("original", "", &record)
+		assert.Nil(err)
+		assert.True(strings.HasPrefix(dest, "tenant-a/"))
+	})
+
+	t.Run("Should only query records of the request tenant", func(t *testing.T) {
+		ctx, rec := newCtx(http.MethodGet, "/api/v1/file?limit=1000", "tenant-a", nil, "")
+
+		err := ctl.Query(ctx)
+		assert.Nil(err)
+
+		resp := FileListJSONResponse{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Equal(int64(1), resp.Meta.Count)
+		assert.Equal(first.ID, (*resp.Records)[0].ID)
+	})
+
+	t.Run("Should not find records of other tenants", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodGet, "/api/v1/file/"+second.GetIDString(), "tenant-a", nil, "")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(second.GetIDString())
+
+		err := ctl.FindOne(ctx)
+		assert.ErrorIs(err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("Should reject invalid tenant ids", func(t *testing.T) {
+		ctx, _ := newCtx(http.MethodGet, "/api/v1/file", "../other", nil, "")
+
+		err := ctl.Query(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should use the tenant storage", func(t *testing.T) {
+		filePlugin.TenantStorages = map[string]TenantStorageCfg{
+			"tenant-c": {FileStorageName: "file"},
+		}
+
+		assert.Equal("file", filePlugin.GetTenantFileStorageName("tenant-c"))
+		assert.Equal(filePlugin.FileStorageName, filePlugin.GetTenantFileStorageName("tenant-a"))
+		assert.Equal(filePlugin.ImageStorageName, filePlugin.GetTenantImageStorageName("tenant-c"))
+
+		record := upload("tenant-c")
+		assert.Equal("file", record.StorageName)
+	})
+}
@@ -0,0 +1,116 @@
+package files
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-bolo/bolo"
+	"github.com/sirupsen/logrus"
+)
+
+var trashPurgeBatchSize = 100
+
+// PurgeTrash - Permanently delete all files and images trashed before trashedBefore, including
+// the stored objects and associations
+func PurgeTrash(app bolo.App, trashedBefore time.Time) error {
+	err := purgeTrashedFiles(app, trashedBefore)
+	if err != nil {
+		return fmt.Errorf("PurgeTrash: %w", err)
+	}
+
+	err = purgeTrashedImages(app, trashedBefore)
+	if err != nil {
+		return fmt.Errorf("PurgeTrash: %w", err)
+	}
+
+	return nil
+}
+
+func purgeTrashedFiles(app bolo.App, trashedBefore time.Time) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		var records []FileModel
+		err := db.Unscoped().
+			Where("deletedAt IS NOT NULL AND deletedAt < ? AND id > ?", trashedBefore, lastID).
+			Order("id ASC").
+			Limit(trashPurgeBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("error on find trashed files: %w", err)
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+
+			err = DestroyFileRecord(app, record)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"id":    record.ID,
+					"error": err,
+				}).Error("purgeTrashedFiles error on destroy file")
+			}
+		}
+
+		if len(records) < trashPurgeBatchSize {
+			return nil
+		}
+	}
+}
+
+func purgeTrashedImages(app bolo.App, trashedBefore time.Time) error {
+	db := app.GetDB()
+
+	var lastID uint64
+	for {
+		var records []ImageModel
+		err := db.Unscoped().
+			Where("deletedAt IS NOT NULL AND deletedAt < ? AND id > ?", trashedBefore, lastID).
+			Order("id ASC").
+			Limit(trashPurgeBatchSize).
+			Find(&records).Error
+		if err != nil {
+			return fmt.Errorf("error on find trashed images: %w", err)
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+
+			err = DestroyImageRecord(app, record)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"id":    record.ID,
+					"error": err,
+				}).Error("purgeTrashedImages error on destroy image")
+			}
+		}
+
+		if len(records) < trashPurgeBatchSize {
+			return nil
+		}
+	}
+}
+
+// StartTrashPurgeJob - Run PurgeTrash in background every TrashPurgeInterval
+func (p *FilePlugin) StartTrashPurgeJob(app bolo.App) {
+	if p.TrashPurgeInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.TrashPurgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			err := PurgeTrash(app, time.Now().Add(-p.TrashRetention))
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": fmt.Sprintf("%+v\n", err),
+				}).Error("FilePlugin.StartTrashPurgeJob error on purge trash")
+			}
+		}
+	}()
+}
@@ -0,0 +1,97 @@
+package files
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+
+	t.Run("Should move a file to trash and restore it", func(t *testing.T) {
+		record := GetFileModelStub()
+		err := record.Save()
+		assert.Nil(err)
+
+		err = record.Delete()
+		assert.Nil(err)
+
+		found := FileModel{}
+		err = FileFindOne(record.GetIDString(), &found)
+		assert.NotNil(err)
+
+		trashed := FileModel{}
+		err = TrashedFileFindOne(record.GetIDString(), &trashed)
+		assert.Nil(err)
+		assert.True(trashed.IsTrashed())
+
+		err = trashed.Restore()
+		assert.Nil(err)
+		assert.False(trashed.IsTrashed())
+
+		err = FileFindOne(record.GetIDString(), &found)
+		assert.Nil(err)
+		assert.Equal(record.ID, found.ID)
+	})
+
+	t.Run("Should not move images to trash in updates", func(t *testing.T) {
+		record := GetImageModelStub()
+		err := record.Save()
+		assert.Nil(err)
+
+		body := `{"image": {"deletedAt": "` + time.Now().Format(time.RFC3339) + `"}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/image/"+record.GetIDString(), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		ctx.SetParamNames("id")
+		ctx.SetParamValues(record.GetIDString())
+
+		err = app.GetPlugin("files").(*FilePlugin).ImageController.Update(ctx)
+		assert.Nil(err)
+
+		found := ImageModel{}
+		err = ImageFindOne(record.GetIDString(), &found)
+		assert.Nil(err)
+		assert.False(found.IsTrashed())
+	})
+
+	t.Run("Should purge trashed images and their assocs", func(t *testing.T) {
+		cfg := NewImageFieldConfiguration("content", "trash")
+		modelId := "21"
+
+		record := GetImageModelStub()
+		err := record.Save()
+		assert.Nil(err)
+
+		err = AddImagesInFieldByIDs(modelId, []string{record.GetIDString()}, cfg)
+		assert.Nil(err)
+
+		err = record.Delete()
+		assert.Nil(err)
+
+		// still in retention period:
+		err = PurgeTrash(app, time.Now().Add(-time.Hour))
+		assert.Nil(err)
+
+		trashed := ImageModel{}
+		err = TrashedImageFindOne(record.GetIDString(), &trashed)
+		assert.Nil(err)
+
+		err = PurgeTrash(app, time.Now().Add(time.Hour))
+		assert.Nil(err)
+
+		err = TrashedImageFindOne(record.GetIDString(), &trashed)
+		assert.NotNil(err)
+
+		var assocsCount int64
+		err = app.GetDB().Model(&ImageAssocsModel{}).Where("imageId = ?", record.ID).Count(&assocsCount).Error
+		assert.Nil(err)
+		assert.Equal(int64(0), assocsCount)
+	})
+}
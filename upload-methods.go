@@ -1,7 +1,9 @@
 package files
 
 import (
+	"image"
 	"mime"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -11,16 +13,37 @@ import (
 	files_helpers "github.com/go-bolo/files/helpers"
 	files_processor "github.com/go-bolo/files/processor"
 	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 )
 
-var defaultExtension = "webp"
-var defaultMime = "image/webp"
+const defaultExtension = "webp"
+const defaultMime = "image/webp"
 
+// UploadFileFromLocalhost - Store one local file as the record contents, the record is not saved. The before
+// upload event listeners can change or reject the upload
 func UploadFileFromLocalhost(fileName string, description string, filePath string, storageName string, record *FileModel, app bolo.App) error {
-	var err error
+	before := BeforeUploadEvent{
+		RecordType:  AccessRecordTypeFile,
+		File:        record,
+		FileName:    fileName,
+		Description: description,
+		FilePath:    filePath,
+		StorageName: storageName,
+	}
+
+	err := triggerVetoEvent(app, EventBeforeUpload, &before)
+	if err != nil {
+		return err
+	}
+
+	fileName, description, storageName = before.FileName, before.Description, before.StorageName
+
 	filePlugin := app.GetPlugin("files").(*FilePlugin)
-	storage := filePlugin.GetStorage(storageName)
+	storage, err := getUploadStorage(filePlugin, storageName)
+	if err != nil {
+		return err
+	}
 
 	fileUUID := uuid.New().String()
 
@@ -44,8 +67,14 @@ func UploadFileFromLocalhost(fileName string, description string, filePath strin
 
 	size := fileStatus.Size()
 
+	checksum, err := files_helpers.FileChecksum(filePath)
+	if err != nil {
+		return errors.Wrap(err, "UploadFileFromLocalhost Error on get file checksum")
+	}
+
 	record.Active = true
 	record.Name = fileUUID
+	record.Checksum = checksum
 	record.Description = &description
 	record.Size = &size
 	record.Originalname = fileName
@@ -58,6 +87,8 @@ func UploadFileFromLocalhost(fileName string, description string, filePath strin
 		return errors.Wrap(err, "UploadFileFromLocalhost Error on upload file")
 	}
 
+	record.extractedText = extractSearchText(filePlugin, filePath, mimeType)
+
 	urls := files_database.ImageURLsField{}
 	urls["original"], _ = storage.GetUrlFromFile("original", record)
 
@@ -66,39 +97,74 @@ func UploadFileFromLocalhost(fileName string, description string, filePath strin
 	return nil
 }
 
+// UploadImageFromLocalhost - Process and store one local image as the record contents, the record is not
+// saved. The before upload event listeners can change or reject the upload
 func UploadImageFromLocalhost(fileName string, description string, filePath string, storageName string, record *ImageModel, app bolo.App) error {
-	var err error
-	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	before := BeforeUploadEvent{
+		RecordType:  AccessRecordTypeImage,
+		Image:       record,
+		FileName:    fileName,
+		Description: description,
+		FilePath:    filePath,
+		StorageName: storageName,
+	}
+
+	err := triggerVetoEvent(app, EventBeforeUpload, &before)
+	if err != nil {
+		return err
+	}
+
+	return uploadImageFromLocalhost(before.FileName, before.Description, filePath, before.StorageName, record, app, "")
+}
+
+// getUploadStorage - Get the upload storage, the name can be changed by before upload listeners so unknown
+// names are returned as one error
+func getUploadStorage(filePlugin *FilePlugin, storageName string) (Storager, error) {
 	storage := filePlugin.GetStorage(storageName)
-	processor := filePlugin.Processor
-	fileUUID := uuid.New().String()
-	styles := filePlugin.ImageStyles
+	if storage == nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "unknown storage "+storageName)
+	}
+
+	return storage, nil
+}
 
-	_, originalExtension, _ := files_helpers.GetFileExtensionAndMimeType(filePath)
-	if originalExtension == "" {
+// getImageUploadExtension - Get the extension of one uploaded image, from the file contents or the file name
+func getImageUploadExtension(fileName, filePath string) string {
+	_, extension, _ := files_helpers.GetFileExtensionAndMimeType(filePath)
+	if extension == "" {
 		// Fallback to filename extension if detection fails
 		fileNameSplits := strings.Split(fileName, ".")
 		if len(fileNameSplits) > 1 {
-			originalExtension = fileNameSplits[len(fileNameSplits)-1]
+			extension = fileNameSplits[len(fileNameSplits)-1]
 		}
 	}
 
-	// Check if original format should be ignored
-	shouldIgnoreFormat := false
-	if filePlugin.ImageFormatToIgnore != "" && originalExtension != "" {
-		ignoreFormats := strings.Split(filePlugin.ImageFormatToIgnore, ",")
-		for _, ignoreFormat := range ignoreFormats {
-			ignoreFormat = strings.TrimSpace(ignoreFormat)
-			if strings.EqualFold(originalExtension, ignoreFormat) {
-				shouldIgnoreFormat = true
-				break
-			}
-		}
+	return extension
+}
+
+// uploadImageFromLocalhost - Process and upload one image, name keeps the stored name in content
+// replacements and is generated if empty
+func uploadImageFromLocalhost(fileName string, description string, filePath string, storageName string, record *ImageModel, app bolo.App, name string) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	storage, err := getUploadStorage(filePlugin, storageName)
+	if err != nil {
+		return err
 	}
 
+	processor := filePlugin.Processor
+	fileUUID := uuid.New().String()
+	styles := filePlugin.ImageStyles
+
+	originalExtension := getImageUploadExtension(fileName, filePath)
+
+	// Check if original format should be ignored
+	shouldIgnoreFormat := filePlugin.IsFormatIgnored(originalExtension)
+
+	// locals, images are uploaded concurrently and each record has its own extension and mime
+	extension, mimeType := defaultExtension, defaultMime
 	if filePlugin.ImageFormat != "" && !shouldIgnoreFormat {
-		defaultExtension = filePlugin.ImageFormat
-		defaultMime = mime.TypeByExtension("." + filePlugin.ImageFormat)
+		extension = filePlugin.ImageFormat
+		mimeType = mime.TypeByExtension("." + filePlugin.ImageFormat)
 	}
 
 	fileStatus, err := os.Stat(filePath)
@@ -122,10 +188,13 @@ func UploadImageFromLocalhost(fileName string, description string, filePath stri
 		}
 		record.Mime = &originalMime
 	} else {
-		record.Extension = &defaultExtension
-		record.Mime = &defaultMime
+		record.Extension = &extension
+		record.Mime = &mimeType
 	}
 
+	// dimensions of the source, used if the processed format can not be decoded, like webp
+	sourceWidth, sourceHeight, _ := getImageDimensions(filePath)
+
 	var resizeOpts files_processor.Options
 
 	// ORIGINAL:
@@ -152,11 +221,15 @@ func UploadImageFromLocalhost(fileName string, description string, filePath stri
 		record.Name = fileUUID
 	}
 
+	if name != "" {
+		record.Name = name
+	}
+
 	if resizeOpts["format"] == "" {
 		if shouldIgnoreFormat && originalExtension != "" {
 			resizeOpts["format"] = originalExtension
 		} else {
-			resizeOpts["format"] = defaultExtension
+			resizeOpts["format"] = extension
 		}
 	}
 
@@ -190,7 +263,72 @@ func UploadImageFromLocalhost(fileName string, description string, filePath stri
 		}
 	}
 
+	// size and checksum of the stored original, after processing:
+	fileStatus, err = os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	size = fileStatus.Size()
+	record.Size = &size
+
+	record.Checksum, err = files_helpers.FileChecksum(filePath)
+	if err != nil {
+		return errors.Wrap(err, "UploadImageFromLocalhost Error on get file checksum")
+	}
+
+	record.Width, record.Height, err = getImageDimensions(filePath)
+	if err != nil {
+		maxWidth, _ := strconv.Atoi(resizeOpts["width"])
+		maxHeight, _ := strconv.Atoi(resizeOpts["height"])
+		if shouldIgnoreFormat {
+			maxWidth, maxHeight = 0, 0
+		}
+		record.Width, record.Height = fitImageDimensions(sourceWidth, sourceHeight, maxWidth, maxHeight)
+	}
+
 	record.ResetURLs(app)
 
 	return nil
 }
+
+// getImageDimensions - Get the width and height of one gif, jpeg or png image without decoding it
+func getImageDimensions(filePath string) (int, int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return cfg.Width, cfg.Height, nil
+}
+
+// fitImageDimensions - Scale down the dimensions to fit in the max width and height, keeping the aspect
+// ratio. Max values <= 0 are not limited
+func fitImageDimensions(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return 0, 0
+	}
+
+	ratio := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		ratio = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*ratio > float64(maxHeight) {
+		ratio = float64(maxHeight) / float64(height)
+	}
+
+	w, h := int(float64(width)*ratio+0.5), int(float64(height)*ratio+0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	return w, h
+}
@@ -0,0 +1,201 @@
+package files
+
+import (
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// UploadItemError - Structured error of one item in one multiple upload
+type UploadItemError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// UploadItemResult - Result of one item in one multiple upload, results keep the request order
+type UploadItemResult struct {
+	Index        int              `json:"index"`
+	Originalname string           `json:"originalname"`
+	Success      bool             `json:"success"`
+	Record       interface{}      `json:"record,omitempty"`
+	Error        *UploadItemError `json:"error,omitempty"`
+}
+
+type MultipleUploadJSONResponse struct {
+	Results          []*UploadItemResult `json:"results"`
+	AssociationError *UploadItemError    `json:"associationError,omitempty"`
+}
+
+type multipleUploadItem struct {
+	index       int
+	file        *multipart.FileHeader
+	label       string
+	description string
+}
+
+type uploadedRecord interface {
+	GetIDString() string
+}
+
+// multipleUploadAssociation - Optional model field to associate the uploaded records
+type multipleUploadAssociation struct {
+	ModelName string
+	ModelID   string
+	Field     string
+}
+
+// isMultipleUpload - Check if the request has files in the multiple upload field, like images[]
+func isMultipleUpload(c echo.Context, field string) bool {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return false
+	}
+
+	return len(form.File[field+"[]"]) > 0
+}
+
+// getMultipleUploadItems - Get the uploaded files with the labels[] and descriptions[] in same order
+func getMultipleUploadItems(c echo.Context, field string, maxItems int) ([]*multipleUploadItem, error) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid multipart form")
+	}
+
+	files := form.File[field+"[]"]
+	if len(files) == 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, field+"[] is required")
+	}
+
+	if maxItems > 0 && len(files) > maxItems {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "too many files, the limit is "+strconv.Itoa(maxItems))
+	}
+
+	labels := form.Value["labels[]"]
+	descriptions := form.Value["descriptions[]"]
+
+	items := []*multipleUploadItem{}
+	for i, file := range files {
+		item := multipleUploadItem{index: i, file: file}
+
+		if i < len(labels) {
+			item.label = labels[i]
+		}
+
+		if i < len(descriptions) {
+			item.description = descriptions[i]
+		}
+
+		items = append(items, &item)
+	}
+
+	return items, nil
+}
+
+// getMultipleUploadAssociation - Get the modelName, modelId and field form values, returns nil if not set
+func getMultipleUploadAssociation(ctx *bolo.RequestContext) (*multipleUploadAssociation, error) {
+	a := multipleUploadAssociation{
+		ModelName: ctx.FormValue("modelName"),
+		ModelID:   ctx.FormValue("modelId"),
+		Field:     ctx.FormValue("field"),
+	}
+
+	if a.ModelName == "" && a.ModelID == "" && a.Field == "" {
+		return nil, nil
+	}
+
+	if a.ModelName == "" || a.ModelID == "" || a.Field == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "modelName, modelId and field are required to associate the uploads")
+	}
+
+	// users can only add files in records they can update
+	if !ctx.Can("update_" + a.ModelName) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "Forbidden")
+	}
+
+	return &a, nil
+}
+
+// checkMultipleUploadQuota - Check the quota with the size of all items once, the items are uploaded
+// concurrently so each upload can't see the usage of the others
+func checkMultipleUploadQuota(ctx *bolo.RequestContext, items []*multipleUploadItem) error {
+	var size int64
+	for _, item := range items {
+		size += item.file.Size
+	}
+
+	return quotaHTTPError(CheckUploadQuota(ctx, size))
+}
+
+// runMultipleUpload - Copy each item to a tmp file and call upload with bounded concurrency
+func runMultipleUpload(c echo.Context, concurrency int, items []*multipleUploadItem, upload func(item *multipleUploadItem, tmpFilePath string) (uploadedRecord, *UploadItemError)) []*UploadItemResult {
+	results := make([]*UploadItemResult, len(items))
+
+	files_helpers.RunConcurrently(c.Request().Context(), len(items), concurrency, func(i int) {
+		item := items[i]
+		result := UploadItemResult{
+			Index:        item.index,
+			Originalname: item.file.Filename,
+		}
+		results[i] = &result
+
+		tmpFilePath := path.Join(os.TempDir(), uuid.New().String())
+		defer os.Remove(tmpFilePath)
+
+		err := files_helpers.CopyMultipartFileToTMP(item.file, tmpFilePath)
+		if err != nil {
+			result.Error = &UploadItemError{Code: "invalid_file", Message: err.Error()}
+			return
+		}
+
+		record, uploadErr := upload(item, tmpFilePath)
+		if uploadErr != nil {
+			result.Error = uploadErr
+			return
+		}
+
+		result.Success = true
+		result.Record = record
+	})
+
+	// items not started because the request was canceled:
+	for i, result := range results {
+		if result == nil {
+			results[i] = &UploadItemResult{
+				Index:        items[i].index,
+				Originalname: items[i].file.Filename,
+				Error:        &UploadItemError{Code: "canceled", Message: "request canceled"},
+			}
+		}
+	}
+
+	return results
+}
+
+// getUploadedIDs - Get the ids of the successful uploads in the request order
+func getUploadedIDs(results []*UploadItemResult) []string {
+	ids := []string{}
+	for _, result := range results {
+		if result.Success {
+			ids = append(ids, result.Record.(uploadedRecord).GetIDString())
+		}
+	}
+
+	return ids
+}
+
+func getOptionalString(v string) *string {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+
+	return &v
+}
@@ -0,0 +1,175 @@
+package files
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileControllerUploadFiles(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	ctl := app.GetPlugin("files").(*FilePlugin).FileController
+
+	newRequest := func(files map[string]string, values map[string][]string) *http.Request {
+		body := bytes.Buffer{}
+		w := multipart.NewWriter(&body)
+
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			content, ok := files[name]
+			if !ok {
+				continue
+			}
+			part, _ := w.CreateFormFile("files[]", name)
+			part.Write([]byte(content))
+		}
+
+		for key, list := range values {
+			for _, v := range list {
+				w.WriteField(key, v)
+			}
+		}
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/file", &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req
+	}
+
+	t.Run("Should upload all files and return one result for each", func(t *testing.T) {
+		req := newRequest(map[string]string{
+			"a.txt": "first file",
+			"b.txt": "second file",
+			"c.txt": "third file",
+		}, map[string][]string{
+			"labels[]":       {"First", "Second"},
+			"descriptions[]": {"first description", "", "third description"},
+			"modelName":      {"content"},
+			"modelId":        {"33"},
+			"field":          {"multiple-upload"},
+		})
+
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		err := ctl.UploadFile(ctx)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, rec.Code)
+
+		resp := struct {
+			Results []struct {
+				Index        int              `json:"index"`
+				Originalname string           `json:"originalname"`
+				Success      bool             `json:"success"`
+				Record       FileModel        `json:"record"`
+				Error        *UploadItemError `json:"error"`
+			} `json:"results"`
+			AssociationError *UploadItemError `json:"associationError"`
+		}{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Nil(resp.AssociationError)
+		assert.Len(resp.Results, 3)
+
+		for i, result := range resp.Results {
+			assert.Equal(i, result.Index)
+			assert.True(result.Success)
+			assert.NotZero(result.Record.ID)
+		}
+
+		assert.Equal("a.txt", resp.Results[0].Originalname)
+		assert.Equal("First", *resp.Results[0].Record.Label)
+		assert.Nil(resp.Results[2].Record.Label)
+		assert.Equal("third description", *resp.Results[2].Record.Description)
+
+		var associated []FileModel
+		err = FileFindManyInRecord("content", "multiple-upload", "33", &associated)
+		assert.Nil(err)
+		assert.Len(associated, 3)
+	})
+
+	t.Run("Should return forbidden without permission", func(t *testing.T) {
+		req := newRequest(map[string]string{"a.txt": "first file"}, nil)
+
+		ctx, _ := GetRequestContextStub(app, req)
+		err := ctl.UploadFile(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should return bad request with incomplete association", func(t *testing.T) {
+		req := newRequest(map[string]string{"a.txt": "first file"}, map[string][]string{
+			"modelName": {"content"},
+		})
+
+		ctx, _ := GetRequestContextStub(app, req, "administrator")
+		err := ctl.UploadFile(ctx)
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}
+
+func TestImageControllerUploadFiles(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+	ctl := filePlugin.ImageController
+
+	processor := filePlugin.Processor
+	filePlugin.Processor = &copyProcessorStub{}
+	defer func() { filePlugin.Processor = processor }()
+
+	src := filepath.Join(os.TempDir(), "multiple-upload.png")
+	writeTestPNG(t, src, 30, 20)
+	defer os.Remove(src)
+	data, _ := os.ReadFile(src)
+
+	body := bytes.Buffer{}
+	w := multipart.NewWriter(&body)
+	for _, name := range []string{"a.png", "b.png", "c.png", "d.png", "e.png"} {
+		part, _ := w.CreateFormFile("images[]", name)
+		part.Write(data)
+	}
+	w.WriteField("modelName", "content")
+	w.WriteField("modelId", "34")
+	w.WriteField("field", "multiple-upload")
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/image", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	t.Run("Should upload all images with their own extension and mime", func(t *testing.T) {
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		err := ctl.UploadFile(ctx)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, rec.Code)
+
+		resp := struct {
+			Results []struct {
+				Success bool       `json:"success"`
+				Record  ImageModel `json:"record"`
+			} `json:"results"`
+			AssociationError *UploadItemError `json:"associationError"`
+		}{}
+		err = json.Unmarshal(rec.Body.Bytes(), &resp)
+		assert.Nil(err)
+		assert.Nil(resp.AssociationError)
+		assert.Len(resp.Results, 5)
+
+		for _, result := range resp.Results {
+			assert.True(result.Success)
+			assert.Equal(filePlugin.ImageFormat, *result.Record.Extension)
+			assert.Equal(30, result.Record.Width)
+		}
+
+		associated, err := GetImagesInField("content", "multiple-upload", "34", 10)
+		assert.Nil(err)
+		assert.Len(associated, 5)
+	})
+}
@@ -1,12 +1,15 @@
 package files
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 
 	"github.com/brianvoe/gofakeit"
 	"github.com/go-bolo/bolo"
 	files_database "github.com/go-bolo/files/database"
 	files_storages "github.com/go-bolo/files/storages"
+	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
 )
 
@@ -66,6 +69,11 @@ func GetAppInstance() bolo.App {
 		&ImageAssocsModel{},
 		&FileModel{},
 		&FileAssocsModel{},
+		&FolderModel{},
+		&TagModel{},
+		&FileTagModel{},
+		&ImageTagModel{},
+		&RevisionModel{},
 	)
 
 	if err != nil {
@@ -75,6 +83,20 @@ func GetAppInstance() bolo.App {
 	return app
 }
 
+// GetRequestContextStub - Create one request context for controller tests, authenticated with roles if set
+func GetRequestContextStub(app bolo.App, req *http.Request, roles ...string) (*bolo.RequestContext, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	ctx := bolo.NewRequestContext(&bolo.RequestContextOpts{App: app, EchoContext: c})
+	if len(roles) > 0 {
+		ctx.IsAuthenticated = true
+		ctx.Roles = roles
+	}
+
+	return ctx, rec
+}
+
 type ContentModelStub struct {
 	ID         uint64 `json:"id"`
 	Title      string `json:"title"`
@@ -151,3 +173,38 @@ func GetFileModelStub() FileModel {
 
 	return r
 }
+
+// UserStub - Authenticated user used in controller tests
+type UserStub struct {
+	ID          string
+	Roles       []string
+	Email       string
+	Username    string
+	DisplayName string
+	FullName    string
+	Language    string
+	Active      bool
+	Blocked     bool
+}
+
+func (u *UserStub) GetID() string                 { return u.ID }
+func (u *UserStub) SetID(id string) error         { u.ID = id; return nil }
+func (u *UserStub) GetRoles() []string            { return u.Roles }
+func (u *UserStub) SetRoles(v []string) error     { u.Roles = v; return nil }
+func (u *UserStub) AddRole(role string) error     { u.Roles = append(u.Roles, role); return nil }
+func (u *UserStub) RemoveRole(role string) error  { return nil }
+func (u *UserStub) GetEmail() string              { return u.Email }
+func (u *UserStub) SetEmail(v string) error       { u.Email = v; return nil }
+func (u *UserStub) GetUsername() string           { return u.Username }
+func (u *UserStub) SetUsername(v string) error    { u.Username = v; return nil }
+func (u *UserStub) GetDisplayName() string        { return u.DisplayName }
+func (u *UserStub) SetDisplayName(v string) error { u.DisplayName = v; return nil }
+func (u *UserStub) GetFullName() string           { return u.FullName }
+func (u *UserStub) SetFullName(v string) error    { u.FullName = v; return nil }
+func (u *UserStub) GetLanguage() string           { return u.Language }
+func (u *UserStub) SetLanguage(v string) error    { u.Language = v; return nil }
+func (u *UserStub) IsActive() bool                { return u.Active }
+func (u *UserStub) SetActive(v bool) error        { u.Active = v; return nil }
+func (u *UserStub) IsBlocked() bool               { return u.Blocked }
+func (u *UserStub) SetBlocked(v bool) error       { u.Blocked = v; return nil }
+func (u *UserStub) FillById(ID string) error      { u.ID = ID; return nil }
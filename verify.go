@@ -0,0 +1,329 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/go-bolo/bolo"
+	files_dtos "github.com/go-bolo/files/dtos"
+	files_helpers "github.com/go-bolo/files/helpers"
+)
+
+const (
+	VerifyProblemMissing            = "missing"
+	VerifyProblemSizeMismatch       = "size-mismatch"
+	VerifyProblemChecksumMismatch   = "checksum-mismatch"
+	VerifyProblemUnsupportedStorage = "unsupported-storage"
+	VerifyProblemError              = "error"
+)
+
+type VerifyOptions struct {
+	// "files", "images" or empty to verify both
+	RecordType string
+	// Read the original objects to compare checksums
+	Checksum bool
+	// Generate missing image styles from the original
+	Regenerate bool
+	// Default 100
+	BatchSize int
+}
+
+type VerifyIssue struct {
+	RecordType  string `json:"recordType"`
+	RecordID    uint64 `json:"recordId"`
+	StorageName string `json:"storageName"`
+	Style       string `json:"style"`
+	Path        string `json:"path"`
+	Problem     string `json:"problem"`
+	Expected    string `json:"expected,omitempty"`
+	Actual      string `json:"actual,omitempty"`
+	Regenerated bool   `json:"regenerated"`
+}
+
+type VerifyReport struct {
+	CheckedRecords int           `json:"checkedRecords"`
+	CheckedObjects int           `json:"checkedObjects"`
+	Issues         []VerifyIssue `json:"issues"`
+}
+
+func (r *VerifyReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *VerifyReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "TYPE\tID\tSTORAGE\tSTYLE\tPROBLEM\tEXPECTED\tACTUAL\tREGENERATED\tPATH")
+	for _, issue := range r.Issues {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n",
+			issue.RecordType, issue.RecordID, issue.StorageName, issue.Style, issue.Problem,
+			issue.Expected, issue.Actual, issue.Regenerated, issue.Path,
+		)
+	}
+
+	fmt.Fprintf(tw, "\n%d records, %d objects checked, %d issues\n", r.CheckedRecords, r.CheckedObjects, len(r.Issues))
+
+	return tw.Flush()
+}
+
+// VerifyStorage - Check if every stored object referenced in file and image URLs exists with
+// the expected size and checksum
+func VerifyStorage(ctx context.Context, app bolo.App, opts *VerifyOptions) (*VerifyReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	report := VerifyReport{Issues: []VerifyIssue{}}
+
+	if opts.RecordType == "" || opts.RecordType == "files" {
+		err := verifyFiles(ctx, app, opts, &report)
+		if err != nil {
+			return &report, fmt.Errorf("VerifyStorage error on verify files: %w", err)
+		}
+	}
+
+	if opts.RecordType == "" || opts.RecordType == "images" {
+		err := verifyImages(ctx, app, opts, &report)
+		if err != nil {
+			return &report, fmt.Errorf("VerifyStorage error on verify images: %w", err)
+		}
+	}
+
+	return &report, nil
+}
+
+func verifyFiles(ctx context.Context, app bolo.App, opts *VerifyOptions, report *VerifyReport) error {
+	db := app.GetDB()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	var lastID uint64
+	for {
+		var records []FileModel
+		err := db.Where("id > ?", lastID).Order("id ASC").Limit(opts.BatchSize).Find(&records).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+			report.CheckedRecords++
+
+			target := verifyTarget{
+				RecordType:  "files",
+				RecordID:    record.ID,
+				StorageName: record.StorageName,
+				File:        record,
+				Size:        record.Size,
+				Checksum:    record.Checksum,
+			}
+
+			storage := filePlugin.GetFileStorage(record)
+
+			for _, style := range sortedStyles(record.URLs) {
+				issue := verifyObject(ctx, storage, target, style, "", opts)
+				report.CheckedObjects++
+				if issue != nil {
+					report.Issues = append(report.Issues, *issue)
+				}
+			}
+		}
+
+		if len(records) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+func verifyImages(ctx context.Context, app bolo.App, opts *VerifyOptions, report *VerifyReport) error {
+	db := app.GetDB()
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	var lastID uint64
+	for {
+		var records []ImageModel
+		err := db.Where("id > ?", lastID).Order("id ASC").Limit(opts.BatchSize).Find(&records).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastID = record.ID
+			report.CheckedRecords++
+
+			target := verifyTarget{
+				RecordType:  "images",
+				RecordID:    record.ID,
+				StorageName: record.StorageName,
+				File:        record,
+				Checksum:    record.Checksum,
+			}
+			// images uploaded before checksums were stored have the size before processing
+			if record.Checksum != "" {
+				target.Size = record.Size
+			}
+
+			storage := filePlugin.GetImageStorage(record)
+			originalOK := true
+			missingStyles := []string{}
+
+			for _, style := range sortedStyles(record.URLs) {
+				if IsPendingStyleURL(record, style) {
+					continue
+				}
+
+				issue := verifyObject(ctx, storage, target, style, filePlugin.ImageFormat, opts)
+				report.CheckedObjects++
+				if issue == nil {
+					continue
+				}
+
+				if style == "original" {
+					originalOK = issue.Problem != VerifyProblemMissing
+				} else if issue.Problem == VerifyProblemMissing {
+					missingStyles = append(missingStyles, style)
+				}
+
+				report.Issues = append(report.Issues, *issue)
+			}
+
+			if !opts.Regenerate || !originalOK || len(missingStyles) == 0 {
+				continue
+			}
+
+			regenerated := map[string]bool{}
+			for _, style := range missingStyles {
+				err = GenerateImageStyle(app, record, style)
+				if err != nil {
+					report.Issues = append(report.Issues, VerifyIssue{
+						RecordType:  "images",
+						RecordID:    record.ID,
+						StorageName: record.StorageName,
+						Style:       style,
+						Problem:     VerifyProblemError,
+						Actual:      "regenerate: " + err.Error(),
+					})
+					continue
+				}
+				regenerated[style] = true
+			}
+
+			if len(regenerated) == 0 {
+				continue
+			}
+
+			err = record.Save()
+			if err != nil {
+				return fmt.Errorf("error on save regenerated image %d: %w", record.ID, err)
+			}
+
+			for j := range report.Issues {
+				issue := &report.Issues[j]
+				if issue.RecordType == "images" && issue.RecordID == record.ID && issue.Problem == VerifyProblemMissing && regenerated[issue.Style] {
+					issue.Regenerated = true
+				}
+			}
+		}
+
+		if len(records) < opts.BatchSize {
+			return nil
+		}
+	}
+}
+
+type verifyTarget struct {
+	RecordType  string
+	RecordID    uint64
+	StorageName string
+	File        files_dtos.FileDTO
+	// Expected original size and checksum, skipped if empty
+	Size     *int64
+	Checksum string
+}
+
+func verifyObject(ctx context.Context, storage Storager, target verifyTarget, style, format string, opts *VerifyOptions) *VerifyIssue {
+	issue := VerifyIssue{
+		RecordType:  target.RecordType,
+		RecordID:    target.RecordID,
+		StorageName: target.StorageName,
+		Style:       style,
+	}
+
+	objectStorage, ok := storage.(ObjectStorager)
+	if !ok {
+		issue.Problem = VerifyProblemUnsupportedStorage
+		return &issue
+	}
+
+	issue.Path, _ = storage.GetUploadPathFromFile(style, format, target.File)
+
+	obj, err := objectStorage.StatObject(ctx, issue.Path)
+	if err != nil {
+		if errors.Is(err, files_dtos.ErrObjectNotFound) {
+			issue.Problem = VerifyProblemMissing
+		} else {
+			issue.Problem = VerifyProblemError
+			issue.Actual = err.Error()
+		}
+		return &issue
+	}
+
+	if style != "original" {
+		return nil
+	}
+
+	if target.Size != nil && *target.Size != obj.Size {
+		issue.Problem = VerifyProblemSizeMismatch
+		issue.Expected = strconv.FormatInt(*target.Size, 10)
+		issue.Actual = strconv.FormatInt(obj.Size, 10)
+		return &issue
+	}
+
+	if opts.Checksum && target.Checksum != "" {
+		r, err := objectStorage.OpenObject(ctx, issue.Path)
+		if err != nil {
+			issue.Problem = VerifyProblemError
+			issue.Actual = err.Error()
+			return &issue
+		}
+		defer r.Close()
+
+		checksum, err := files_helpers.ReaderChecksum(r)
+		if err != nil {
+			issue.Problem = VerifyProblemError
+			issue.Actual = err.Error()
+			return &issue
+		}
+
+		if checksum != target.Checksum {
+			issue.Problem = VerifyProblemChecksumMismatch
+			issue.Expected = target.Checksum
+			issue.Actual = checksum
+			return &issue
+		}
+	}
+
+	return nil
+}
+
+func sortedStyles(urls map[string]string) []string {
+	styles := []string{}
+	for style := range urls {
+		if style == "" {
+			continue
+		}
+		styles = append(styles, style)
+	}
+	sort.Strings(styles)
+
+	return styles
+}
@@ -0,0 +1,72 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	files_database "github.com/go-bolo/files/database"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyStorage(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	storage := app.GetPlugin("files").(*FilePlugin).GetStorage("file")
+
+	tmpFilePath := filepath.Join(os.TempDir(), "verify-test.txt")
+	err := os.WriteFile(tmpFilePath, []byte("verify content"), 0644)
+	assert.Nil(err)
+	defer os.Remove(tmpFilePath)
+
+	checksum, err := files_helpers.FileChecksum(tmpFilePath)
+	assert.Nil(err)
+
+	newStoredFile := func(name string, size int64, upload bool) *FileModel {
+		record := GetFileModelStub()
+		record.Name = name
+		record.StorageName = "file"
+		record.CreatedAt = time.Now()
+		record.Size = &size
+		record.Checksum = checksum
+		record.SetURLs(files_database.ImageURLsField{"original": "original"})
+
+		if upload {
+			dest, _ := storage.GetUploadPathFromFile("original", "", &record)
+			err := storage.UploadFile(&record, tmpFilePath, dest)
+			assert.Nil(err)
+		}
+
+		err := record.Save()
+		assert.Nil(err)
+
+		return &record
+	}
+
+	okFile := newStoredFile("verify-ok.txt", 14, true)
+	wrongSizeFile := newStoredFile("verify-size.txt", 99, true)
+	missingFile := newStoredFile("verify-missing.txt", 14, false)
+	// files uploaded before the storage name was saved use the default file storage
+	legacyFile := newStoredFile("verify-legacy.txt", 14, true)
+	err = app.GetDB().Model(legacyFile).Update("storageName", "").Error
+	assert.Nil(err)
+
+	report, err := VerifyStorage(context.Background(), app, &VerifyOptions{
+		RecordType: "files",
+		Checksum:   true,
+	})
+	assert.Nil(err)
+
+	problems := map[uint64]string{}
+	for _, issue := range report.Issues {
+		problems[issue.RecordID] = issue.Problem
+	}
+
+	assert.Equal("", problems[okFile.ID])
+	assert.Equal("", problems[legacyFile.ID])
+	assert.Equal(VerifyProblemSizeMismatch, problems[wrongSizeFile.ID])
+	assert.Equal(VerifyProblemMissing, problems[missingFile.ID])
+}
@@ -0,0 +1,158 @@
+package files
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/go-bolo/bolo"
+	files_helpers "github.com/go-bolo/files/helpers"
+	"github.com/sirupsen/logrus"
+)
+
+// zipEntryNames - Unique names for zip entries, "a.pdf" becomes "a (1).pdf" in the second use
+type zipEntryNames map[string]bool
+
+func (names zipEntryNames) unique(name string) string {
+	name = files_helpers.SanitizeFileName(name)
+	if name == "" {
+		name = "file"
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 1; names[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+
+	names[strings.ToLower(candidate)] = true
+
+	return candidate
+}
+
+// zipMethodForMime - Store files that are already compressed, like images and videos
+func zipMethodForMime(mimeType *string) uint16 {
+	if mimeType == nil {
+		return zip.Deflate
+	}
+
+	m := *mimeType
+	if strings.HasPrefix(m, "image/") || strings.HasPrefix(m, "video/") || strings.HasPrefix(m, "audio/") ||
+		m == "application/zip" || m == "application/pdf" || m == "application/gzip" {
+		return zip.Store
+	}
+
+	return zip.Deflate
+}
+
+// zipPartialEntryError - The object read failed after the entry was created, so the entry is incomplete
+type zipPartialEntryError struct {
+	Entry string
+	Err   error
+}
+
+func (e *zipPartialEntryError) Error() string {
+	return fmt.Sprintf("incomplete zip entry %s: %s", e.Entry, e.Err)
+}
+
+func (e *zipPartialEntryError) Unwrap() error {
+	return e.Err
+}
+
+// writeFilesZip - Stream the original file objects to one zip archive. The response is already sent
+// when objects are read, so missing objects and incomplete entries are listed in one _missing-files.txt entry
+func writeFilesZip(ctx context.Context, app bolo.App, w io.Writer, records []FileModel) error {
+	filePlugin := app.GetPlugin("files").(*FilePlugin)
+
+	zw := zip.NewWriter(w)
+	names := zipEntryNames{}
+	missing := []string{}
+
+	for i := range records {
+		record := &records[i]
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		name := record.Originalname
+		if name == "" {
+			name = record.Name
+		}
+
+		err := writeFileZipEntry(ctx, filePlugin, zw, names, name, record)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"id":    record.ID,
+				"error": err,
+			}).Warn("writeFilesZip error on add file")
+
+			var partialErr *zipPartialEntryError
+			if errors.As(err, &partialErr) {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				missing = append(missing, partialErr.Entry+" (incomplete, the zip entry is truncated)")
+				continue
+			}
+
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		entry, err := zw.Create(names.unique("_missing-files.txt"))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(entry, strings.Join(missing, "\n")+"\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeFileZipEntry(ctx context.Context, filePlugin *FilePlugin, zw *zip.Writer, names zipEntryNames, name string, record *FileModel) error {
+	storage := filePlugin.GetFileStorage(record)
+
+	objects, ok := storage.(ObjectStorager)
+	if !ok {
+		return fmt.Errorf("storage %s can't open objects", record.StorageName)
+	}
+
+	objectPath, _ := storage.GetUploadPathFromFile("original", "", record)
+
+	r, err := objects.OpenObject(ctx, objectPath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	entryName := names.unique(name)
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     entryName,
+		Method:   zipMethodForMime(record.Mime),
+		Modified: record.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(entry, r)
+	if err != nil {
+		return &zipPartialEntryError{Entry: entryName, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package files
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/go-bolo/bolo"
+	"github.com/go-bolo/bolo/acl"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type denyAccessPolicyStub struct {
+	AllowAllAccessPolicy
+	DeniedID uint64
+}
+
+func (p *denyAccessPolicyStub) CanAccess(ctx *bolo.RequestContext, action AccessAction, record *AccessRecord) (bool, error) {
+	return record.ID != p.DeniedID, nil
+}
+
+// brokenObjectStorageStub - Objects fail after the first bytes are read
+type brokenObjectStorageStub struct {
+	Storager
+	ObjectStorager
+}
+
+func (s *brokenObjectStorageStub) OpenObject(ctx context.Context, objectPath string) (io.ReadCloser, error) {
+	return io.NopCloser(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))), nil
+}
+
+func TestFileControllerDownloadZip(t *testing.T) {
+	assert := assert.New(t)
+	app := GetAppInstance()
+	ctl := app.GetPlugin("files").(*FilePlugin).FileController
+
+	newFile := func(originalname, content string, removeObject bool) *FileModel {
+		tmpFilePath := filepath.Join(os.TempDir(), "zip-test-file")
+		err := os.WriteFile(tmpFilePath, []byte(content), 0644)
+		assert.Nil(err)
+		defer os.Remove(tmpFilePath)
+
+		record := NewFileModel()
+		err = UploadFileFromLocalhost(originalname, "", tmpFilePath, "file", record, app)
+		assert.Nil(err)
+		err = record.Save()
+		assert.Nil(err)
+
+		if removeObject {
+			p, _ := app.GetPlugin("files").(*FilePlugin).GetStorage("file").GetUploadPathFromFile("original", "", record)
+			os.Remove(filepath.Join("/tmp/_test_files", p))
+		}
+
+		return record
+	}
+
+	first := newFile("report.txt", "first report", false)
+	second := newFile("Report.txt", "second report", false)
+	missing := newFile("missing.txt", "missing", true)
+
+	cfg := NewFileFieldConfiguration("content", "zip-attachments")
+	err := AddFilesInFieldByIDs("77", []string{first.GetIDString(), second.GetIDString()}, cfg)
+	assert.Nil(err)
+
+	readZip := func(rec *httptest.ResponseRecorder) map[string]string {
+		zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+		assert.Nil(err)
+
+		entries := map[string]string{}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			assert.Nil(err)
+			data, _ := io.ReadAll(r)
+			r.Close()
+			entries[f.Name] = string(data)
+		}
+
+		return entries
+	}
+
+	download := func(query string, roles ...string) (*httptest.ResponseRecorder, error) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/file/zip?"+query, nil)
+		ctx, rec := GetRequestContextStub(app, req, roles...)
+		return rec, ctl.DownloadZip(ctx)
+	}
+
+	t.Run("Should zip files by id with unique names", func(t *testing.T) {
+		rec, err := download("ids="+first.GetIDString()+","+second.GetIDString()+","+missing.GetIDString()+"&name=reports", "administrator")
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, rec.Code)
+		assert.Equal("application/zip", rec.Header().Get("Content-Type"))
+		assert.Contains(rec.Header().Get("Content-Disposition"), `filename="reports.zip"`)
+
+		entries := readZip(rec)
+		assert.Equal("first report", entries["report.txt"])
+		assert.Equal("second report", entries["Report (1).txt"])
+		assert.Equal("missing.txt\n", entries["_missing-files.txt"])
+	})
+
+	t.Run("Should list the incomplete entries", func(t *testing.T) {
+		filePlugin := app.GetPlugin("files").(*FilePlugin)
+		storage := filePlugin.GetStorage("file")
+		filePlugin.SetStorage("zip-broken", &brokenObjectStorageStub{Storager: storage, ObjectStorager: storage.(ObjectStorager)})
+		defer delete(filePlugin.Storages, "zip-broken")
+
+		broken := newFile("broken.txt", "broken report", false)
+		err := app.GetDB().Model(broken).Update("storageName", "zip-broken").Error
+		assert.Nil(err)
+
+		rec, err := download("ids="+broken.GetIDString()+","+first.GetIDString(), "administrator")
+		assert.Nil(err)
+
+		entries := readZip(rec)
+		assert.Equal("first report", entries["report.txt"])
+		assert.Equal("broken.txt (incomplete, the zip entry is truncated)\n", entries["_missing-files.txt"])
+	})
+
+	t.Run("Should zip the files of one record field", func(t *testing.T) {
+		rec, err := download("modelName=content&modelId=77&field=zip-attachments", "administrator")
+		assert.Nil(err)
+
+		entries := readZip(rec)
+		assert.Len(entries, 2)
+	})
+
+	t.Run("Should only zip the record files of the request tenant", func(t *testing.T) {
+		filePlugin := app.GetPlugin("files").(*FilePlugin)
+		filePlugin.TenantResolver = &HeaderTenantResolver{}
+		defer func() { filePlugin.TenantResolver = nil }()
+
+		tmpFilePath := filepath.Join(os.TempDir(), "zip-test-tenant-file")
+		err := os.WriteFile(tmpFilePath, []byte("tenant report"), 0644)
+		assert.Nil(err)
+		defer os.Remove(tmpFilePath)
+
+		record := NewFileModel()
+		record.TenantID = "zip-tenant-a"
+		err = UploadFileFromLocalhost("tenant.txt", "", tmpFilePath, "file", record, app)
+		assert.Nil(err)
+		err = record.Save()
+		assert.Nil(err)
+
+		err = AddFilesInFieldByIDs("77", []string{record.GetIDString()}, NewFileFieldConfiguration("content", "zip-tenant"))
+		assert.Nil(err)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/file/zip?modelName=content&modelId=77", nil)
+		req.Header.Set("X-Tenant-ID", "zip-tenant-a")
+		ctx, rec := GetRequestContextStub(app, req, "administrator")
+		err = ctl.DownloadZip(ctx)
+		assert.Nil(err)
+		assert.Equal(map[string]string{"tenant.txt": "tenant report"}, readZip(rec))
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v2/file/zip?modelName=content&modelId=77&field=zip-tenant", nil)
+		req.Header.Set("X-Tenant-ID", "zip-tenant-b")
+		ctx, _ = GetRequestContextStub(app, req, "administrator")
+		err = ctl.DownloadZip(ctx)
+		assert.Equal(http.StatusNotFound, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should skip the record files denied by the access policy", func(t *testing.T) {
+		filePlugin := app.GetPlugin("files").(*FilePlugin)
+		policy := filePlugin.AccessPolicy
+		filePlugin.AccessPolicy = &denyAccessPolicyStub{DeniedID: second.ID}
+		defer func() { filePlugin.AccessPolicy = policy }()
+
+		for _, query := range []string{"modelName=content&modelId=77&field=zip-attachments", "ids=" + first.GetIDString() + "," + second.GetIDString()} {
+			rec, err := download(query, "administrator")
+			assert.Nil(err)
+			assert.Equal(map[string]string{"report.txt": "first report"}, readZip(rec))
+		}
+	})
+
+	t.Run("Should check the record permission", func(t *testing.T) {
+		role, _ := acl.NewRole(&acl.NewRoleOpts{Name: "zip-tester", Permissions: []string{"find_file"}})
+		app.SetRole("zip-tester", *role)
+
+		_, err := download("modelName=content&modelId=77", "zip-tester")
+		assert.NotNil(err)
+		assert.Equal(http.StatusForbidden, err.(*echo.HTTPError).Code)
+	})
+
+	t.Run("Should return bad request without files", func(t *testing.T) {
+		_, err := download("", "administrator")
+		assert.NotNil(err)
+		assert.Equal(http.StatusBadRequest, err.(*echo.HTTPError).Code)
+	})
+}